@@ -1,33 +1,312 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"dmmak/simple-rest-crud/internal/cache"
+	"dmmak/simple-rest-crud/internal/config"
 	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/idgen"
+	"dmmak/simple-rest-crud/internal/logging"
+	"dmmak/simple-rest-crud/internal/metrics"
+	"dmmak/simple-rest-crud/internal/middleware"
+	"dmmak/simple-rest-crud/internal/migrate"
 	"dmmak/simple-rest-crud/internal/repo"
+	"dmmak/simple-rest-crud/internal/server"
+	"dmmak/simple-rest-crud/internal/validation"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
-	var connStr string
-	flag.StringVar(&connStr, "pgConn", "", "PostgresSQL connection string")
-	db, err := sql.Open("pgx", connStr)
+	cfg, args, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		slog.Error("can't load config", logging.KeyErr, err)
+		os.Exit(1)
+	}
+	// the level is validated by config.Load
+	level := new(slog.LevelVar)
+	initial, _ := logging.ParseLevel(cfg.Log.Level)
+	level.Set(initial)
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, level)
+	if err != nil {
+		slog.Error("can't create logger", logging.KeyErr, err)
+		os.Exit(1)
+	}
+	// packages logging without an injected logger, log included, write through it too
+	slog.SetDefault(logger)
+	// run returns instead of exiting, so deferred cleanups happen before os.Exit
+	if err := run(cfg, args, logger, level); err != nil {
+		logger.Error("app failed", logging.KeyErr, err)
+		os.Exit(1)
+	}
+}
+
+func run(cfg *config.Config, args []string, logger *slog.Logger, level *slog.LevelVar) error {
+	ids, err := idgen.New(cfg.IDFormat)
+	if err != nil {
+		return err
+	}
+
+	if len(args) > 0 && args[0] == "migrate" {
+		if cfg.Storage != config.StorageDB {
+			return fmt.Errorf("migrate needs %v storage", config.StorageDB)
+		}
+		db, driver, err := openDB(cfg)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return runMigrate(db, driver, args[1:])
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	var (
+		postsRepo    handler.RedditPostsRepo
+		commentsRepo handler.CommentsRepo
+		// closeDB is nil for the in-memory storage
+		closeDB func() error
+	)
+	switch cfg.Storage {
+	case config.StorageMemory:
+		store := repo.NewMemStore()
+		postsRepo = repo.NewMemRepo(store)
+		commentsRepo = repo.NewMemCommentsRepo(store)
+	default:
+		db, driver, err := openDB(cfg)
+		if err != nil {
+			return err
+		}
+		if cfg.DB.AutoMigrate {
+			if err := runMigrate(db, driver, []string{"up"}); err != nil {
+				db.Close()
+				return err
+			}
+		}
+		// the pgx pool replaces db below, its stats aren't exported
+		if !cfg.DB.PGX {
+			reg.MustRegister(collectors.NewDBStatsCollector(db, driver))
+		}
+		switch {
+		case driver == repo.DriverSQLite:
+			postsRepo = repo.NewSQLiteRepo(db, logger)
+			commentsRepo = repo.NewSQLiteCommentsRepo(db, logger)
+			closeDB = db.Close
+		case cfg.DB.PGX:
+			// migrations run over database/sql, the pool replaces it afterwards
+			db.Close()
+			pool, err := openPGX(cfg)
+			if err != nil {
+				return err
+			}
+			postsRepo = repo.NewPGXRepo(pool, logger)
+			commentsRepo = repo.NewPGXCommentsRepo(pool, logger)
+			closeDB = func() error { pool.Close(); return nil }
+		default:
+			postsRepo = repo.NewPGRepo(db, logger)
+			commentsRepo = repo.NewPGCommentsRepo(db, logger)
+			closeDB = db.Close
+		}
+	}
+
+	// instrumented below the cache, so cache hits aren't taken for fast storage calls
+	postsRepo = metrics.NewPostsRepo(postsRepo, reg)
+
+	// closeCache is nil unless the cache is kept in Redis
+	var closeCache func() error
+	if cfg.Cache.Enabled {
+		cacheOpts := cache.Options{
+			TTL:         cfg.Cache.TTL,
+			MaxEntries:  cfg.Cache.MaxEntries,
+			MaxComments: cfg.Cache.MaxComments,
+		}
+		store := cache.NewLRU(cacheOpts)
+		if cfg.Cache.RedisURL != "" {
+			redis, err := cache.NewRedis(cfg.Cache.RedisURL, cacheOpts)
+			if err != nil {
+				if closeDB != nil {
+					closeDB()
+				}
+				return err
+			}
+			store, closeCache = redis, redis.Close
+		}
+		cached := cache.NewPostsRepo(postsRepo, store)
+		postsRepo = cached
+		commentsRepo = cache.NewCommentsRepo(commentsRepo, cached)
+		reg.MustRegister(metrics.NewCacheCollector(cached.Stats))
+	}
+
+	rules := validation.Rules{
+		MaxTitleLen:        cfg.Validation.MaxTitleLen,
+		MaxBodyLen:         cfg.Validation.MaxBodyLen,
+		MaxCommentsPerPost: cfg.Validation.MaxCommentsPerPost,
+	}
+	opts := handler.Options{
+		RepoTimeout:   cfg.Timeouts.Repo,
+		RouteTimeouts: cfg.Timeouts.Routes,
+		Likes:         cfg.Features.Likes,
+		Comments:      cfg.Features.Comments,
+		CacheControl:  cfg.CacheControl,
+	}
+	httpHandler := handler.New(postsRepo, commentsRepo, ids, validation.New(rules, ids), opts, logger)
+
+	mux := http.NewServeMux()
+	// panics are recovered within the access log and metrics, so their 500 is logged and counted too
+	mux.Handle("/", middleware.Chain(httpHandler.Routes(),
+		middleware.RequestID(idgen.NewULID().New),
+		middleware.Metrics(reg),
+		middleware.AccessLog(logger),
+		middleware.Recover(logger, handler.InternalError),
+	))
+	// runtime, storage and cache stats for monitoring
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}))
+
+	srv := server.New(httpServer(cfg, mux), cfg.Timeouts.Shutdown)
+	if cfg.TLS.CertFile != "" {
+		srv.WithTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	}
+	// closers run in reverse order, so the DB registered first is closed last
+	if closeDB != nil {
+		srv.OnShutdown("db", func(ctx context.Context) error { return closeDB() })
+	}
+	if closeCache != nil {
+		srv.OnShutdown("cache", func(ctx context.Context) error { return closeCache() })
+	}
+
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		if closeDB != nil {
+			closeDB()
+		}
+		return fmt.Errorf("can't listen on %v: %w", cfg.Listen, err)
+	}
+	logger.Info("listening", "addr", ln.Addr().String())
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if cfg.AdminListen == "" {
+		return srv.Run(ctx, ln)
+	}
+
+	// admin endpoints aren't authenticated, so they're kept off the public listener
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/admin/log-level", handler.LogLevelHandler(level, logger))
+	adminSrv := server.New(httpServer(cfg, adminMux), cfg.Timeouts.Shutdown)
+	adminLn, err := net.Listen("tcp", cfg.AdminListen)
 	if err != nil {
-		log.Fatal(err)
+		ln.Close()
+		if closeDB != nil {
+			closeDB()
+		}
+		return fmt.Errorf("can't listen on %v: %w", cfg.AdminListen, err)
 	}
-	defer db.Close()
-	db.SetMaxIdleConns(5)
-	db.SetMaxOpenConns(10)
+	logger.Info("admin listening", "addr", adminLn.Addr().String())
 
-	pgRepo := repo.NewPGRepo(db)
-	httpHandler := handler.New(pgRepo)
+	// either server stopping stops the other one too
+	adminErr := make(chan error, 1)
+	go func() {
+		adminErr <- adminSrv.Run(ctx, adminLn)
+		stop()
+	}()
+	err = srv.Run(ctx, ln)
+	stop()
+	return errors.Join(err, <-adminErr)
+}
 
-	http.HandleFunc("/post", httpHandler.Route(http.MethodPost))
-	http.HandleFunc("/post/", httpHandler.Route(http.MethodGet, http.MethodDelete))
+func httpServer(cfg *config.Config, h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: cfg.Timeouts.ReadHeader,
+		ReadTimeout:       cfg.Timeouts.Read,
+		WriteTimeout:      cfg.Timeouts.Write,
+		IdleTimeout:       cfg.Timeouts.Idle,
+	}
+}
 
-	log.Fatal(http.ListenAndServe(":8080", nil))
+func openDB(cfg *config.Config) (*sql.DB, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return repo.Open(ctx, cfg.DB.URL, dbPool(cfg))
+}
+
+func openPGX(cfg *config.Config) (*pgxpool.Pool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return repo.OpenPGX(ctx, cfg.DB.URL, dbPool(cfg))
+}
+
+func dbPool(cfg *config.Config) repo.Pool {
+	return repo.Pool{
+		MaxOpenConns:    cfg.DB.MaxOpenConns,
+		MaxIdleConns:    cfg.DB.MaxIdleConns,
+		ConnMaxLifetime: cfg.DB.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.DB.ConnMaxIdleTime,
+	}
+}
+
+// runMigrate handles "migrate up", "migrate down [steps]" and "migrate version".
+func runMigrate(db *sql.DB, driver string, args []string) error {
+	dialect := migrate.Postgres
+	if driver == repo.DriverSQLite {
+		dialect = migrate.SQLite
+	}
+	migrator, err := migrate.New(db, dialect)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	cmd := "up"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	switch cmd {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		slog.Info("applied migrations", "versions", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("migrate down expects a positive number of steps, got %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		slog.Info("reverted migrations", "versions", reverted)
+	case "version":
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		slog.Info("schema version", "version", version)
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or version", cmd)
+	}
+	return nil
 }
@@ -0,0 +1,63 @@
+// Package cache keeps recently read posts in front of a handler.RedditPostsRepo,
+// either in process or in a Redis server shared by all instances.
+package cache
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/entity"
+	"time"
+)
+
+// Store keeps posts for PostsRepo, it's safe for concurrent use.
+//
+// A post loaded from the repository may be already stale when it's stored, if it was
+// changed meanwhile. Set drops it when Invalidate was called for the post since
+// Generation returned gen, so a load racing with a write can't hide the write.
+type Store interface {
+	Generation(ctx context.Context, postID string) (gen uint64, err error)
+	// Get returns a post the caller must not change.
+	Get(ctx context.Context, postID string) (post *entity.RedditPost, found bool, err error)
+	// Set keeps the post until it's invalidated or expires, post must not be changed afterwards.
+	Set(ctx context.Context, post *entity.RedditPost, gen uint64) error
+	Invalidate(ctx context.Context, postID string) error
+}
+
+// genTTL is how long a Store keeps the generation of a post after its last invalidation.
+// It outlives any load of a post, an expired generation restarts from zero and could match
+// a post loaded before it expired otherwise.
+const genTTL = time.Hour
+
+// Options bound a Store, see DefaultOptions.
+type Options struct {
+	// TTL bounds how long a post is served from the cache, changes made around it,
+	// e.g. by another instance sharing the database, are visible after TTL at the latest.
+	TTL time.Duration
+	// MaxEntries and MaxComments bound the number of posts kept in process and of their
+	// comments in total. Posts with more than MaxComments comments aren't cached.
+	// A Redis server is bounded by its own maxmemory setting instead.
+	MaxEntries  int
+	MaxComments int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		TTL:         30 * time.Second,
+		MaxEntries:  10000,
+		MaxComments: 1000000,
+	}
+}
+
+// Stats are counters of a cache since it was created.
+type Stats struct {
+	Hits          uint64
+	Misses        uint64
+	Invalidations uint64
+	// Errors counts failed Store calls, reads and writes fall back to the repository then.
+	Errors uint64
+	// Evictions, Expirations, Entries and Comments are reported by the in-process store only,
+	// Entries and Comments are its current size.
+	Evictions   uint64
+	Expirations uint64
+	Entries     int
+	Comments    int
+}
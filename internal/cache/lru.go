@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"dmmak/simple-rest-crud/internal/entity"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key     string
+	post    *entity.RedditPost
+	expires time.Time
+}
+
+type generation struct {
+	postID  string
+	gen     uint64
+	expires time.Time
+}
+
+// lru keeps posts up to a number of entries and of their comments in total,
+// evicting the least recently used first. Entries expire after a TTL.
+type lru struct {
+	ttl         time.Duration
+	maxEntries  int
+	maxComments int
+	now         func() time.Time
+
+	mu       sync.Mutex
+	ll       *list.List
+	items    map[string]*list.Element
+	comments int
+	// gens are generations of invalidated posts, ordered by their last invalidation
+	// in genList, so expired ones are dropped from its front
+	gens    map[string]*list.Element
+	genList *list.List
+	stats   Stats
+}
+
+// NewLRU returns a Store keeping posts in process, invalidations aren't seen by other instances.
+func NewLRU(opts Options) Store {
+	return newLRU(opts, time.Now)
+}
+
+func newLRU(opts Options, now func() time.Time) *lru {
+	return &lru{
+		ttl:         opts.TTL,
+		maxEntries:  opts.MaxEntries,
+		maxComments: opts.MaxComments,
+		now:         now,
+		ll:          list.New(),
+		items:       map[string]*list.Element{},
+		gens:        map[string]*list.Element{},
+		genList:     list.New(),
+	}
+}
+
+func (c *lru) Generation(ctx context.Context, postID string) (gen uint64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation(postID), nil
+}
+
+// generation returns the generation of postID, zero when it wasn't invalidated lately.
+func (c *lru) generation(postID string) uint64 {
+	now := c.now()
+	for el := c.genList.Front(); el != nil && !now.Before(el.Value.(*generation).expires); el = c.genList.Front() {
+		delete(c.gens, c.genList.Remove(el).(*generation).postID)
+	}
+	if el, ok := c.gens[postID]; ok {
+		return el.Value.(*generation).gen
+	}
+	return 0
+}
+
+func (c *lru) Get(ctx context.Context, postID string) (post *entity.RedditPost, found bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[postID]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*entry)
+	if !c.now().Before(e.expires) {
+		c.removeElement(el)
+		c.stats.Expirations++
+		return nil, false, nil
+	}
+	c.ll.MoveToFront(el)
+	return e.post, true, nil
+}
+
+func (c *lru) Set(ctx context.Context, post *entity.RedditPost, gen uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.generation(post.UUID) || len(post.Comments) > c.maxComments {
+		return nil
+	}
+	if el, ok := c.items[post.UUID]; ok {
+		c.removeElement(el)
+	}
+	c.items[post.UUID] = c.ll.PushFront(&entry{key: post.UUID, post: post, expires: c.now().Add(c.ttl)})
+	c.comments += len(post.Comments)
+	for c.ll.Len() > c.maxEntries || c.comments > c.maxComments {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+	}
+	return nil
+}
+
+func (c *lru) Invalidate(ctx context.Context, postID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	gen := c.generation(postID) + 1
+	if el, ok := c.gens[postID]; ok {
+		c.genList.Remove(el)
+	}
+	c.gens[postID] = c.genList.PushBack(&generation{postID: postID, gen: gen, expires: c.now().Add(genTTL)})
+	if el, ok := c.items[postID]; ok {
+		c.removeElement(el)
+	}
+	return nil
+}
+
+// Stats reports evictions, expirations and the current size.
+func (c *lru) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.ll.Len()
+	stats.Comments = c.comments
+	return stats
+}
+
+func (c *lru) removeElement(el *list.Element) {
+	e := c.ll.Remove(el).(*entry)
+	delete(c.items, e.key)
+	c.comments -= len(e.post.Comments)
+}
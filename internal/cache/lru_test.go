@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/entity"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newTestLRU(opts Options) (*lru, *clock) {
+	clk := &clock{now: time.Unix(1700000000, 0)}
+	return newLRU(opts, clk.Now), clk
+}
+
+func post(id string, comments int) *entity.RedditPost {
+	post := &entity.RedditPost{UUID: id}
+	for i := 0; i < comments; i++ {
+		post.Comments = append(post.Comments, &entity.Comment{})
+	}
+	return post
+}
+
+var ctx = context.Background()
+
+func get(c *lru, postID string) (*entity.RedditPost, bool) {
+	post, found, _ := c.Get(ctx, postID)
+	return post, found
+}
+
+func gen(c *lru, postID string) uint64 {
+	gen, _ := c.Generation(ctx, postID)
+	return gen
+}
+
+func keys(c *lru) []string {
+	var keys []string
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		keys = append(keys, el.Value.(*entry).key)
+	}
+	return keys
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c, _ := newTestLRU(Options{TTL: time.Minute, MaxEntries: 2, MaxComments: 10})
+	c.Set(ctx, post("p1", 0), 0)
+	c.Set(ctx, post("p2", 0), 0)
+	_, ok := get(c, "p1")
+	assert.True(t, ok)
+	c.Set(ctx, post("p3", 0), 0)
+
+	assert.Equal(t, []string{"p3", "p1"}, keys(c))
+	assert.Equal(t, Stats{Evictions: 1, Entries: 2}, c.Stats())
+}
+
+func TestLRUCommentsLimit(t *testing.T) {
+	c, _ := newTestLRU(Options{TTL: time.Minute, MaxEntries: 10, MaxComments: 5})
+	c.Set(ctx, post("p1", 2), 0)
+	c.Set(ctx, post("p2", 2), 0)
+	c.Set(ctx, post("p3", 2), 0)
+	assert.Equal(t, []string{"p3", "p2"}, keys(c))
+
+	// a post over the limit on its own isn't cached and evicts nothing
+	c.Set(ctx, post("p4", 6), 0)
+	assert.Equal(t, []string{"p3", "p2"}, keys(c))
+
+	// replacing an entry accounts for its old comments
+	c.Set(ctx, post("p3", 3), 0)
+	assert.Equal(t, []string{"p3", "p2"}, keys(c))
+	assert.Equal(t, Stats{Evictions: 1, Entries: 2, Comments: 5}, c.Stats())
+}
+
+func TestLRUExpires(t *testing.T) {
+	c, clk := newTestLRU(Options{TTL: time.Minute, MaxEntries: 10, MaxComments: 10})
+	c.Set(ctx, post("p1", 1), 0)
+
+	clk.now = clk.now.Add(time.Minute - time.Nanosecond)
+	_, ok := get(c, "p1")
+	assert.True(t, ok)
+
+	clk.now = clk.now.Add(time.Nanosecond)
+	_, ok = get(c, "p1")
+	assert.False(t, ok)
+	assert.Equal(t, Stats{Expirations: 1}, c.Stats())
+}
+
+func TestLRUInvalidate(t *testing.T) {
+	c, _ := newTestLRU(Options{TTL: time.Minute, MaxEntries: 10, MaxComments: 10})
+	c.Set(ctx, post("p1", 1), gen(c, "p1"))
+	before := gen(c, "p1")
+	beforeP3 := gen(c, "p3")
+	c.Invalidate(ctx, "p1")
+	c.Invalidate(ctx, "p2")
+
+	// a post loaded before the invalidation is dropped
+	c.Set(ctx, post("p1", 1), before)
+	_, ok := get(c, "p1")
+	assert.False(t, ok)
+
+	c.Set(ctx, post("p1", 1), gen(c, "p1"))
+	_, ok = get(c, "p1")
+	assert.True(t, ok)
+
+	// invalidations of other posts don't drop a load
+	c.Set(ctx, post("p3", 1), beforeP3)
+	_, ok = get(c, "p3")
+	assert.True(t, ok)
+	assert.Equal(t, Stats{Entries: 2, Comments: 2}, c.Stats())
+}
+
+func TestLRUGenerationExpires(t *testing.T) {
+	c, clk := newTestLRU(Options{TTL: time.Minute, MaxEntries: 10, MaxComments: 10})
+	c.Invalidate(ctx, "p1")
+	clk.now = clk.now.Add(genTTL / 2)
+	c.Invalidate(ctx, "p2")
+	c.Invalidate(ctx, "p1")
+	assert.Equal(t, uint64(2), gen(c, "p1"))
+
+	clk.now = clk.now.Add(genTTL / 2)
+	assert.Equal(t, uint64(2), gen(c, "p1"), "expiry is extended by invalidations")
+	assert.Equal(t, uint64(1), gen(c, "p2"))
+
+	clk.now = clk.now.Add(genTTL / 2)
+	assert.Equal(t, uint64(0), gen(c, "p1"))
+	assert.Empty(t, c.gens)
+	assert.Equal(t, 0, c.genList.Len())
+}
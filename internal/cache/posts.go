@@ -0,0 +1,227 @@
+package cache
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/logging"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// loadTimeout bounds loads of missing posts, they aren't bound by the request of the caller
+// that started them, since callers waiting for the same load may outlive it.
+const loadTimeout = 30 * time.Second
+
+// invalidateTimeout bounds invalidations, they aren't bound by the request made the change,
+// since a write may succeed while its request times out.
+const invalidateTimeout = 5 * time.Second
+
+// PostsRepo is a read-through cache of posts returned by Get. Writes made through it
+// invalidate the post, so do comment writes made through NewCommentsRepo.
+// Concurrent misses of a post share a single load from the wrapped repository.
+type PostsRepo struct {
+	repo  handler.RedditPostsRepo
+	store Store
+	loads singleflight.Group
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	invalidations atomic.Uint64
+	errors        atomic.Uint64
+}
+
+func NewPostsRepo(repo handler.RedditPostsRepo, store Store) *PostsRepo {
+	return &PostsRepo{repo: repo, store: store}
+}
+
+// Stats is safe to call concurrently, e.g. from a monitoring endpoint.
+func (c *PostsRepo) Stats() Stats {
+	var stats Stats
+	if s, ok := c.store.(interface{ Stats() Stats }); ok {
+		stats = s.Stats()
+	}
+	stats.Hits = c.hits.Load()
+	stats.Misses = c.misses.Load()
+	stats.Invalidations = c.invalidations.Load()
+	stats.Errors = c.errors.Load()
+	return stats
+}
+
+func (c *PostsRepo) Save(ctx context.Context, post *entity.RedditPost, onConflict handler.ConflictPolicy, version uint64) (created bool, err error) {
+	// invalidated on failures too, the write may have happened before e.g. a timeout
+	defer c.invalidate(ctx, post.UUID)
+	return c.repo.Save(ctx, post, onConflict, version)
+}
+
+// Get loads a missing post once for concurrent callers, who share its result and error.
+// The load isn't bound by the context of the caller that started it, so that caller going
+// away doesn't fail the others, each of them waits for it only as long as its own ctx allows.
+func (c *PostsRepo) Get(ctx context.Context, postID string) (post *entity.RedditPost, found bool, err error) {
+	if cached, ok := c.cached(ctx, postID); ok {
+		return copyPost(cached), true, nil
+	}
+	gen, err := c.store.Generation(ctx, postID)
+	if err != nil {
+		c.failed(ctx, "can't get generation of cached post", postID, err)
+	}
+	cacheable := err == nil
+	// a load started before the last invalidation isn't shared with later callers
+	loads := c.loads.DoChan(postID+"@"+strconv.FormatUint(gen, 10), func() (any, error) {
+		// ctx is kept for its log fields only
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+		post, found, err := c.repo.Get(ctx, postID)
+		if err != nil || !found {
+			return nil, err
+		}
+		if cacheable {
+			if err := c.store.Set(ctx, post, gen); err != nil {
+				c.failed(ctx, "can't cache post", postID, err)
+			}
+		}
+		return post, nil
+	})
+	var loaded singleflight.Result
+	select {
+	case loaded = <-loads:
+	case <-ctx.Done():
+		return &entity.RedditPost{}, false, contextError(ctx.Err())
+	}
+	if loaded.Err != nil {
+		return &entity.RedditPost{}, false, loaded.Err
+	}
+	if loaded.Val == nil {
+		return &entity.RedditPost{}, false, nil
+	}
+	return copyPost(loaded.Val.(*entity.RedditPost)), true, nil
+}
+
+// contextError wraps an error of a caller's context the way repositories do.
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("can't wait for post load: %w: %w", handler.ErrTimeout, err)
+	}
+	return fmt.Errorf("can't wait for post load: %w: %w", handler.ErrCanceled, err)
+}
+
+// Revision is served from a cached post, misses are passed through without loading it.
+func (c *PostsRepo) Revision(ctx context.Context, postID string) (rev handler.Revision, found bool, err error) {
+	if cached, ok := c.lookup(ctx, postID); ok {
+		return handler.Revision{Version: cached.Version, UpdatedAt: cached.UpdatedAt}, true, nil
+	}
+	return c.repo.Revision(ctx, postID)
+}
+
+func (c *PostsRepo) Delete(ctx context.Context, postID string, version uint64) (found bool, err error) {
+	defer c.invalidate(ctx, postID)
+	return c.repo.Delete(ctx, postID, version)
+}
+
+func (c *PostsRepo) Update(ctx context.Context, post *entity.RedditPost, version uint64) (found bool, err error) {
+	defer c.invalidate(ctx, post.UUID)
+	return c.repo.Update(ctx, post, version)
+}
+
+// List isn't cached, pages are rarely read twice before one of their posts changes.
+func (c *PostsRepo) List(ctx context.Context, afterID string, limit int) (posts []*entity.RedditPost, err error) {
+	return c.repo.List(ctx, afterID, limit)
+}
+
+func (c *PostsRepo) Like(ctx context.Context, postID string, delta int) (likes uint32, found bool, err error) {
+	defer c.invalidate(ctx, postID)
+	return c.repo.Like(ctx, postID, delta)
+}
+
+// cached returns the stored post counting a hit or a miss, they're counted by Get only,
+// so a conditional GET checking the revision first isn't counted twice.
+func (c *PostsRepo) cached(ctx context.Context, postID string) (*entity.RedditPost, bool) {
+	post, found := c.lookup(ctx, postID)
+	if found {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return post, found
+}
+
+// lookup returns the stored post, a failing store is treated as a miss.
+func (c *PostsRepo) lookup(ctx context.Context, postID string) (*entity.RedditPost, bool) {
+	post, found, err := c.store.Get(ctx, postID)
+	if err != nil {
+		c.failed(ctx, "can't get cached post", postID, err)
+		return nil, false
+	}
+	return post, found
+}
+
+func (c *PostsRepo) invalidate(ctx context.Context, postID string) {
+	c.invalidations.Add(1)
+	// ctx is kept for its log fields only, a write the client went away from is invalidated too
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), invalidateTimeout)
+	defer cancel()
+	if err := c.store.Invalidate(ctx, postID); err != nil {
+		// the post is served stale until it expires
+		c.failed(ctx, "can't invalidate cached post", postID, err)
+	}
+}
+
+// failed counts and logs an error of the store with the default logger, requests are still
+// served by the repository, so it's logged as a warning.
+func (c *PostsRepo) failed(ctx context.Context, msg string, postID string, err error) {
+	c.errors.Add(1)
+	slog.WarnContext(ctx, msg, logging.KeyPostID, postID, logging.KeyErr, err)
+}
+
+type commentsRepo struct {
+	repo  handler.CommentsRepo
+	posts *PostsRepo
+}
+
+// NewCommentsRepo invalidates posts cached by posts when their comments are changed through repo.
+func NewCommentsRepo(repo handler.CommentsRepo, posts *PostsRepo) handler.CommentsRepo {
+	return &commentsRepo{repo: repo, posts: posts}
+}
+
+func (c *commentsRepo) Save(ctx context.Context, postID string, comment *entity.Comment, version uint64) (postVersion uint64, found bool, err error) {
+	defer c.posts.invalidate(ctx, postID)
+	return c.repo.Save(ctx, postID, comment, version)
+}
+
+func (c *commentsRepo) Get(ctx context.Context, postID string, commentID string) (comment *entity.Comment, found bool, err error) {
+	return c.repo.Get(ctx, postID, commentID)
+}
+
+func (c *commentsRepo) Update(ctx context.Context, postID string, comment *entity.Comment, version uint64) (postVersion uint64, found bool, err error) {
+	defer c.posts.invalidate(ctx, postID)
+	return c.repo.Update(ctx, postID, comment, version)
+}
+
+func (c *commentsRepo) Delete(ctx context.Context, postID string, commentID string, version uint64) (postVersion uint64, found bool, err error) {
+	defer c.posts.invalidate(ctx, postID)
+	return c.repo.Delete(ctx, postID, commentID, version)
+}
+
+func (c *commentsRepo) Like(ctx context.Context, postID string, commentID string, delta int) (likes uint32, found bool, err error) {
+	defer c.posts.invalidate(ctx, postID)
+	return c.repo.Like(ctx, postID, commentID, delta)
+}
+
+// copyPost keeps cached posts apart from ones changed by callers.
+func copyPost(post *entity.RedditPost) *entity.RedditPost {
+	copied := *post
+	if post.Comments != nil {
+		copied.Comments = make([]*entity.Comment, 0, len(post.Comments))
+		for _, c := range post.Comments {
+			comment := *c
+			copied.Comments = append(copied.Comments, &comment)
+		}
+	}
+	return &copied
+}
@@ -0,0 +1,201 @@
+package cache_test
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/cache"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/repo"
+	"dmmak/simple-rest-crud/internal/repo/repotest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingRepo counts Get calls of the wrapped repository, which wait for release when it's set.
+type countingRepo struct {
+	handler.RedditPostsRepo
+	gets    atomic.Int32
+	release chan struct{}
+}
+
+func (r *countingRepo) Get(ctx context.Context, postID string) (*entity.RedditPost, bool, error) {
+	r.gets.Add(1)
+	if r.release != nil {
+		<-r.release
+	}
+	return r.RedditPostsRepo.Get(ctx, postID)
+}
+
+func newCached() (*cache.PostsRepo, handler.CommentsRepo, *countingRepo) {
+	store := repo.NewMemStore()
+	counting := &countingRepo{RedditPostsRepo: repo.NewMemRepo(store)}
+	posts := cache.NewPostsRepo(counting, cache.NewLRU(cache.DefaultOptions()))
+	return posts, cache.NewCommentsRepo(repo.NewMemCommentsRepo(store), posts), counting
+}
+
+func TestCachedRepoContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) handler.RedditPostsRepo {
+		return cache.NewPostsRepo(repo.NewMemRepo(repo.NewMemStore()), cache.NewLRU(cache.DefaultOptions()))
+	})
+}
+
+func TestCachedGet(t *testing.T) {
+	ctx := context.Background()
+	posts, _, counting := newCached()
+	_, err := posts.Save(ctx, &entity.RedditPost{UUID: "p1", Title: "Title", Comments: []*entity.Comment{{UUID: "c1"}}}, handler.ConflictReject, 0)
+	assert.Nil(t, err)
+
+	first, found, err := posts.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	first.Title = "Changed by caller"
+	first.Comments[0].Body = "Changed by caller"
+
+	second, found, err := posts.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "Title", second.Title)
+	assert.Equal(t, "", second.Comments[0].Body)
+
+	rev, found, err := posts.Revision(ctx, "p1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, second.Version, rev.Version)
+
+	_, found, err = posts.Get(ctx, "missing")
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	assert.Equal(t, int32(2), counting.gets.Load())
+	// the revision isn't counted, only gets are
+	assert.Equal(t, cache.Stats{Hits: 1, Misses: 2, Invalidations: 1, Entries: 1, Comments: 1}, posts.Stats())
+}
+
+func TestCachedInvalidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(ctx context.Context, posts handler.RedditPostsRepo, comments handler.CommentsRepo) error
+	}{
+		{
+			name: "save",
+			write: func(ctx context.Context, posts handler.RedditPostsRepo, _ handler.CommentsRepo) error {
+				_, err := posts.Save(ctx, &entity.RedditPost{UUID: "p1", Title: "New"}, handler.ConflictMerge, 0)
+				return err
+			},
+		},
+		{
+			name: "update",
+			write: func(ctx context.Context, posts handler.RedditPostsRepo, _ handler.CommentsRepo) error {
+				_, err := posts.Update(ctx, &entity.RedditPost{UUID: "p1", Title: "New"}, 0)
+				return err
+			},
+		},
+		{
+			name: "delete",
+			write: func(ctx context.Context, posts handler.RedditPostsRepo, _ handler.CommentsRepo) error {
+				_, err := posts.Delete(ctx, "p1", 0)
+				return err
+			},
+		},
+		{
+			name: "like",
+			write: func(ctx context.Context, posts handler.RedditPostsRepo, _ handler.CommentsRepo) error {
+				_, _, err := posts.Like(ctx, "p1", 1)
+				return err
+			},
+		},
+		{
+			name: "save comment",
+			write: func(ctx context.Context, _ handler.RedditPostsRepo, comments handler.CommentsRepo) error {
+				_, _, err := comments.Save(ctx, "p1", &entity.Comment{UUID: "c1", Body: "New"}, 0)
+				return err
+			},
+		},
+		{
+			name: "like comment",
+			write: func(ctx context.Context, _ handler.RedditPostsRepo, comments handler.CommentsRepo) error {
+				_, _, err := comments.Like(ctx, "p1", "c0", 1)
+				return err
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			posts, comments, counting := newCached()
+			_, err := posts.Save(ctx, &entity.RedditPost{UUID: "p1", Title: "Old", Comments: []*entity.Comment{{UUID: "c0"}}}, handler.ConflictReject, 0)
+			assert.Nil(t, err)
+			cached, _, err := posts.Get(ctx, "p1")
+			assert.Nil(t, err)
+
+			assert.Nil(t, test.write(ctx, posts, comments))
+
+			got, found, err := posts.Get(ctx, "p1")
+			assert.Nil(t, err)
+			if found {
+				assert.Greater(t, got.Version, cached.Version)
+			}
+			assert.Equal(t, int32(2), counting.gets.Load())
+			assert.Equal(t, uint64(2), posts.Stats().Invalidations)
+		})
+	}
+}
+
+func TestCachedConcurrentMisses(t *testing.T) {
+	ctx := context.Background()
+	posts, _, counting := newCached()
+	_, err := posts.Save(ctx, &entity.RedditPost{UUID: "p1"}, handler.ConflictReject, 0)
+	assert.Nil(t, err)
+	counting.release = make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, found, err := posts.Get(ctx, "p1")
+			assert.Nil(t, err)
+			assert.True(t, found)
+		}()
+	}
+	// let the callers queue up behind the first load
+	time.Sleep(50 * time.Millisecond)
+	close(counting.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), counting.gets.Load())
+	assert.Equal(t, uint64(10), posts.Stats().Misses)
+}
+
+func TestCachedLoadOutlivesCanceledCaller(t *testing.T) {
+	posts, _, counting := newCached()
+	_, err := posts.Save(context.Background(), &entity.RedditPost{UUID: "p1"}, handler.ConflictReject, 0)
+	assert.Nil(t, err)
+	counting.release = make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, _, err := posts.Get(ctx, "p1")
+		first <- err
+	}()
+	// the first caller starts the load, the second one waits for it
+	time.Sleep(20 * time.Millisecond)
+	second := make(chan bool)
+	go func() {
+		_, found, err := posts.Get(context.Background(), "p1")
+		assert.Nil(t, err)
+		second <- found
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-first, handler.ErrCanceled)
+	close(counting.release)
+	assert.True(t, <-second)
+	assert.Equal(t, int32(1), counting.gets.Load())
+}
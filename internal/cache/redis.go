@@ -0,0 +1,309 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"dmmak/simple-rest-crud/internal/entity"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisPostPrefix = "post:"
+	redisGenPrefix  = "post-gen:"
+	// redisMaxIdleConns bounds connections kept open between calls
+	redisMaxIdleConns = 16
+)
+
+// Redis is a Store keeping posts in a Redis server, so all instances using the server
+// share cached posts and see each other's invalidations.
+//
+// Every post has a generation key increased by Invalidate. Posts are stored along with
+// the generation they were loaded at and are misses once it doesn't match anymore.
+type Redis struct {
+	addr     string
+	password string
+	db       int
+	ttl      time.Duration
+	dialer   net.Dialer
+	idle     chan *redisConn
+}
+
+// redisPost is the stored value of a post.
+type redisPost struct {
+	Gen  uint64
+	Post *entity.RedditPost
+}
+
+// NewRedis returns a Store using a Redis server at rawURL, redis://[:password@]host[:port][/db].
+// Connections are made on demand, the server isn't contacted here.
+func NewRedis(rawURL string, opts Options) (*Redis, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse Redis URL: %w", err)
+	}
+	if u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("Redis URL must look like redis://host:port/db, got %q", rawURL)
+	}
+	c := &Redis{
+		addr: u.Host,
+		ttl:  opts.TTL,
+		idle: make(chan *redisConn, redisMaxIdleConns),
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if password, ok := u.User.Password(); ok {
+		c.password = password
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		c.db, err = strconv.Atoi(db)
+		if err != nil || c.db < 0 {
+			return nil, fmt.Errorf("Redis database must be a non-negative number, got %q", db)
+		}
+	}
+	return c, nil
+}
+
+func (c *Redis) Generation(ctx context.Context, postID string) (gen uint64, err error) {
+	replies, err := c.do(ctx, []string{"GET", redisGenPrefix + postID})
+	if err != nil {
+		return 0, fmt.Errorf("can't get post generation: %w", err)
+	}
+	return parseGen(replies[0])
+}
+
+func (c *Redis) Get(ctx context.Context, postID string) (post *entity.RedditPost, found bool, err error) {
+	replies, err := c.do(ctx, []string{"MGET", redisPostPrefix + postID, redisGenPrefix + postID})
+	if err != nil {
+		return nil, false, fmt.Errorf("can't get cached post: %w", err)
+	}
+	values, ok := replies[0].([]any)
+	if !ok || len(values) != 2 {
+		return nil, false, fmt.Errorf("unexpected MGET reply %v", replies[0])
+	}
+	value, ok := values[0].(string)
+	if !ok {
+		return nil, false, nil
+	}
+	gen, err := parseGen(values[1])
+	if err != nil {
+		return nil, false, err
+	}
+	var stored redisPost
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return nil, false, fmt.Errorf("can't decode cached post: %w", err)
+	}
+	if stored.Gen != gen || stored.Post == nil {
+		return nil, false, nil
+	}
+	return stored.Post, true, nil
+}
+
+func (c *Redis) Set(ctx context.Context, post *entity.RedditPost, gen uint64) error {
+	value, err := json.Marshal(redisPost{Gen: gen, Post: post})
+	if err != nil {
+		return fmt.Errorf("can't encode post: %w", err)
+	}
+	ttl := strconv.FormatInt(c.ttl.Milliseconds(), 10)
+	if _, err := c.do(ctx, []string{"SET", redisPostPrefix + post.UUID, string(value), "PX", ttl}); err != nil {
+		return fmt.Errorf("can't cache post: %w", err)
+	}
+	return nil
+}
+
+func (c *Redis) Invalidate(ctx context.Context, postID string) error {
+	genKey := redisGenPrefix + postID
+	_, err := c.do(ctx,
+		[]string{"INCR", genKey},
+		[]string{"PEXPIRE", genKey, strconv.FormatInt(genTTL.Milliseconds(), 10)},
+		[]string{"DEL", redisPostPrefix + postID},
+	)
+	if err != nil {
+		return fmt.Errorf("can't invalidate cached post: %w", err)
+	}
+	return nil
+}
+
+// Close closes idle connections, it's called once the store isn't used anymore.
+func (c *Redis) Close() error {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func parseGen(reply any) (uint64, error) {
+	switch reply := reply.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		gen, err := strconv.ParseUint(reply, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("can't parse post generation %q: %w", reply, err)
+		}
+		return gen, nil
+	default:
+		return 0, fmt.Errorf("unexpected post generation %v", reply)
+	}
+}
+
+// do sends cmds in a single round trip and returns their replies. It fails with
+// the first error reply, a connection is reused unless it failed itself.
+func (c *Redis) do(ctx context.Context, cmds ...[]string) ([]any, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replies, err := conn.do(ctx, cmds)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.Close()
+		return nil, err
+	}
+	c.release(conn)
+	return replies, err
+}
+
+func (c *Redis) conn(ctx context.Context) (*redisConn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+	netConn, err := c.dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to Redis: %w", err)
+	}
+	conn := &redisConn{Conn: netConn, r: bufio.NewReader(netConn), w: bufio.NewWriter(netConn)}
+	var setup [][]string
+	if c.password != "" {
+		setup = append(setup, []string{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	if len(setup) > 0 {
+		if _, err := conn.do(ctx, setup); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("can't set up Redis connection: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (c *Redis) release(conn *redisConn) {
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// redisError is an error reply, it leaves the connection usable.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (conn *redisConn) do(ctx context.Context, cmds [][]string) ([]any, error) {
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	for _, args := range cmds {
+		fmt.Fprintf(conn.w, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(conn.w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := conn.w.Flush(); err != nil {
+		return nil, err
+	}
+	// every reply is read even after an error reply, so the connection stays in sync
+	var firstErr error
+	replies := make([]any, 0, len(cmds))
+	for range cmds {
+		reply, err := readReply(conn.r)
+		var replyErr redisError
+		if err != nil && !errors.As(err, &replyErr) {
+			return nil, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		replies = append(replies, reply)
+	}
+	return replies, firstErr
+}
+
+// readReply reads a RESP2 reply: a string, an int64, nil or a slice of those,
+// error replies within a slice are redisError values.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty RESP reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, 0, n)
+		for i := 0; i < n; i++ {
+			item, err := readReply(r)
+			var replyErr redisError
+			if errors.As(err, &replyErr) {
+				item = replyErr
+			} else if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected RESP reply %q", line)
+	}
+}
@@ -0,0 +1,152 @@
+package cache_test
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/cache"
+	"dmmak/simple-rest-crud/internal/cache/resptest"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/repo"
+	"dmmak/simple-rest-crud/internal/repo/repotest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRedis(t *testing.T, url string) *cache.Redis {
+	store, err := cache.NewRedis(url, cache.DefaultOptions())
+	if err != nil {
+		t.Fatalf("can't create Redis store: %s", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestRedisRepoContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) handler.RedditPostsRepo {
+		store := newRedis(t, resptest.NewServer(t).URL())
+		return cache.NewPostsRepo(repo.NewMemRepo(repo.NewMemStore()), store)
+	})
+}
+
+func TestNewRedis(t *testing.T) {
+	tests := []struct {
+		url    string
+		expErr string
+	}{
+		{url: "redis://localhost"},
+		{url: "redis://:secret@localhost:6380/2"},
+		{url: "localhost:6379", expErr: "Redis URL must look like"},
+		{url: "http://localhost", expErr: "Redis URL must look like"},
+		{url: "redis://localhost/db", expErr: "Redis database must be a non-negative number"},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			_, err := cache.NewRedis(test.url, cache.DefaultOptions())
+			if test.expErr == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorContains(t, err, test.expErr)
+			}
+		})
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	server := resptest.NewServer(t)
+	store := newRedis(t, server.URL())
+	post := &entity.RedditPost{
+		UUID:      "p1",
+		Title:     "Title",
+		Likes:     3,
+		Version:   2,
+		UpdatedAt: time.UnixMilli(1700000000123).UTC(),
+		Comments:  []*entity.Comment{{UUID: "c1", Body: "Body", Likes: 1}},
+	}
+
+	gen, err := store.Generation(ctx, "p1")
+	assert.Nil(t, err)
+	assert.Nil(t, store.Set(ctx, post, gen))
+	got, found, err := store.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, post, got)
+
+	// a post loaded before an invalidation is dropped
+	assert.Nil(t, store.Invalidate(ctx, "p1"))
+	assert.Nil(t, store.Set(ctx, post, gen))
+	_, found, err = store.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	gen, err = store.Generation(ctx, "p1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), gen)
+	assert.Nil(t, store.Set(ctx, post, gen))
+	_, found, err = store.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+
+	server.Advance(cache.DefaultOptions().TTL)
+	_, found, err = store.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+func TestRedisSharedByInstances(t *testing.T) {
+	ctx := context.Background()
+	server := resptest.NewServer(t)
+	// both instances use the same database
+	backend := repo.NewMemStore()
+	first := cache.NewPostsRepo(repo.NewMemRepo(backend), newRedis(t, server.URL()))
+	second := cache.NewPostsRepo(repo.NewMemRepo(backend), newRedis(t, server.URL()))
+	secondComments := cache.NewCommentsRepo(repo.NewMemCommentsRepo(backend), second)
+
+	_, err := first.Save(ctx, &entity.RedditPost{UUID: "p1", Title: "Old"}, handler.ConflictReject, 0)
+	assert.Nil(t, err)
+	_, _, err = first.Get(ctx, "p1")
+	assert.Nil(t, err)
+
+	// loaded by the first instance
+	got, _, err := second.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.Equal(t, "Old", got.Title)
+	assert.Equal(t, uint64(1), second.Stats().Hits)
+
+	_, err = second.Update(ctx, &entity.RedditPost{UUID: "p1", Title: "New"}, 0)
+	assert.Nil(t, err)
+	got, _, err = first.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.Equal(t, "New", got.Title)
+
+	_, _, err = secondComments.Save(ctx, "p1", &entity.Comment{UUID: "c1", Body: "Body"}, 0)
+	assert.Nil(t, err)
+	got, _, err = first.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.Len(t, got.Comments, 1)
+
+	_, err = second.Delete(ctx, "p1", 0)
+	assert.Nil(t, err)
+	_, found, err := first.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+func TestRedisUnavailable(t *testing.T) {
+	ctx := context.Background()
+	server := resptest.NewServer(t)
+	posts := cache.NewPostsRepo(repo.NewMemRepo(repo.NewMemStore()), newRedis(t, server.URL()))
+	_, err := posts.Save(ctx, &entity.RedditPost{UUID: "p1"}, handler.ConflictReject, 0)
+	assert.Nil(t, err)
+	server.Close()
+
+	// reads and writes fall back to the repository
+	_, found, err := posts.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	_, err = posts.Delete(ctx, "p1", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), posts.Stats().Errors)
+}
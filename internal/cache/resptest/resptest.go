@@ -0,0 +1,270 @@
+// Package resptest serves a subset of Redis commands over RESP in process,
+// so Redis clients are tested without a Redis server.
+package resptest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Server understands PING, AUTH, SELECT, GET, MGET, SET with PX, DEL, INCR, PEXPIRE and KEYS *,
+// all databases share the same keys.
+type Server struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu     sync.Mutex
+	data   map[string]item
+	conns  map[net.Conn]struct{}
+	closed bool
+	// skew is added to the time keys expire by, see Advance
+	skew time.Duration
+}
+
+type item struct {
+	value string
+	// expires is zero for keys without a TTL
+	expires time.Time
+}
+
+// NewServer starts a server closed at the end of the test.
+func NewServer(t testing.TB) *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can't listen: %s", err)
+	}
+	s := &Server{ln: ln, data: map[string]item{}, conns: map[net.Conn]struct{}{}}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// URL is a redis:// URL of the server.
+func (s *Server) URL() string {
+	return "redis://" + s.ln.Addr().String()
+}
+
+// Advance moves the server's clock forward, so keys expire without waiting.
+func (s *Server) Advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skew += d
+}
+
+// Close stops the server and drops open connections, later commands fail.
+func (s *Server) Close() {
+	s.ln.Close()
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				fmt.Fprintf(w, "-ERR %s\r\n", err)
+				w.Flush()
+			}
+			return
+		}
+		s.exec(w, args)
+		// replies of pipelined commands are sent together
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readCommand reads an array of bulk strings, the form clients send commands in.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	n, err := readHeader(r, '*')
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		size, err := readHeader(r, '$')
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func readHeader(r *bufio.Reader, kind byte) (int, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) < 2 || line[0] != kind {
+		return 0, fmt.Errorf("protocol error, expected '%c', got %q", kind, line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("protocol error, invalid length %q", line)
+	}
+	return n, nil
+}
+
+func (s *Server) exec(w *bufio.Writer, args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(w, "-ERR empty command\r\n")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().Add(s.skew)
+	switch cmd, args := strings.ToUpper(args[0]), args[1:]; {
+	case cmd == "PING":
+		fmt.Fprint(w, "+PONG\r\n")
+	case cmd == "AUTH" && len(args) == 1, cmd == "SELECT" && len(args) == 1:
+		fmt.Fprint(w, "+OK\r\n")
+	case cmd == "GET" && len(args) == 1:
+		value, ok := s.get(args[0], now)
+		writeBulk(w, value, ok)
+	case cmd == "MGET" && len(args) > 0:
+		fmt.Fprintf(w, "*%d\r\n", len(args))
+		for _, key := range args {
+			value, ok := s.get(key, now)
+			writeBulk(w, value, ok)
+		}
+	case cmd == "SET" && len(args) == 2:
+		s.data[args[0]] = item{value: args[1]}
+		fmt.Fprint(w, "+OK\r\n")
+	case cmd == "SET" && len(args) == 4 && strings.ToUpper(args[2]) == "PX":
+		ms, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil || ms <= 0 {
+			fmt.Fprint(w, "-ERR invalid expire time in 'set' command\r\n")
+			return
+		}
+		s.data[args[0]] = item{value: args[1], expires: now.Add(time.Duration(ms) * time.Millisecond)}
+		fmt.Fprint(w, "+OK\r\n")
+	case cmd == "DEL" && len(args) > 0:
+		deleted := 0
+		for _, key := range args {
+			if _, ok := s.get(key, now); ok {
+				delete(s.data, key)
+				deleted++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", deleted)
+	case cmd == "INCR" && len(args) == 1:
+		value, _ := s.get(args[0], now)
+		n := int64(0)
+		if value != "" {
+			var err error
+			if n, err = strconv.ParseInt(value, 10, 64); err != nil {
+				fmt.Fprint(w, "-ERR value is not an integer or out of range\r\n")
+				return
+			}
+		}
+		n++
+		// INCR keeps the TTL of an existing key
+		it := s.data[args[0]]
+		it.value = strconv.FormatInt(n, 10)
+		s.data[args[0]] = it
+		fmt.Fprintf(w, ":%d\r\n", n)
+	case cmd == "PEXPIRE" && len(args) == 2:
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			fmt.Fprint(w, "-ERR value is not an integer or out of range\r\n")
+			return
+		}
+		if _, ok := s.get(args[0], now); !ok {
+			fmt.Fprint(w, ":0\r\n")
+			return
+		}
+		it := s.data[args[0]]
+		it.expires = now.Add(time.Duration(ms) * time.Millisecond)
+		s.data[args[0]] = it
+		fmt.Fprint(w, ":1\r\n")
+	case cmd == "KEYS" && len(args) == 1 && args[0] == "*":
+		var keys []string
+		for key := range s.data {
+			if _, ok := s.get(key, now); ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(w, "*%d\r\n", len(keys))
+		for _, key := range keys {
+			writeBulk(w, key, true)
+		}
+	default:
+		fmt.Fprintf(w, "-ERR unknown command or wrong number of arguments for '%s'\r\n", strings.ToLower(cmd))
+	}
+}
+
+// get returns a live key, expired ones are deleted.
+func (s *Server) get(key string, now time.Time) (string, bool) {
+	it, ok := s.data[key]
+	if !ok {
+		return "", false
+	}
+	if !it.expires.IsZero() && !now.Before(it.expires) {
+		delete(s.data, key)
+		return "", false
+	}
+	return it.value, true
+}
+
+func writeBulk(w *bufio.Writer, value string, ok bool) {
+	if !ok {
+		fmt.Fprint(w, "$-1\r\n")
+		return
+	}
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(value), value)
+}
@@ -0,0 +1,547 @@
+package config
+
+import (
+	"bytes"
+	"dmmak/simple-rest-crud/internal/cache"
+	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/idgen"
+	"dmmak/simple-rest-crud/internal/logging"
+	"dmmak/simple-rest-crud/internal/repo"
+	"dmmak/simple-rest-crud/internal/validation"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds all settings of cmd/app. Values are taken, from lowest to highest precedence,
+// from Default, the config file, APP_* environment variables and command line flags.
+type Config struct {
+	// Storage is either StorageDB or StorageMemory, the latter needs no DB settings.
+	Storage string `yaml:"storage" toml:"storage"`
+	Listen  string `yaml:"listen" toml:"listen"`
+	// AdminListen is the address of the server of /admin/ endpoints, e.g. changing the
+	// log level, an empty value disables them. They aren't authenticated, so it's meant
+	// to be kept off public networks.
+	AdminListen string     `yaml:"adminListen" toml:"adminListen"`
+	TLS         TLS        `yaml:"tls" toml:"tls"`
+	DB          DB         `yaml:"db" toml:"db"`
+	Timeouts    Timeouts   `yaml:"timeouts" toml:"timeouts"`
+	IDFormat    string     `yaml:"idFormat" toml:"idFormat"`
+	Validation  Validation `yaml:"validation" toml:"validation"`
+	Features    Features   `yaml:"features" toml:"features"`
+	// CacheControl sets Cache-Control headers of routes named by handler.CacheableRoutes,
+	// an empty value sends none.
+	CacheControl map[string]string `yaml:"cacheControl" toml:"cacheControl"`
+	Cache        Cache             `yaml:"cache" toml:"cache"`
+	Log          Log               `yaml:"log" toml:"log"`
+}
+
+// TLS is enabled when both files are set.
+type TLS struct {
+	CertFile string `yaml:"certFile" toml:"certFile"`
+	KeyFile  string `yaml:"keyFile" toml:"keyFile"`
+}
+
+type DB struct {
+	// URL is a DSN, its scheme selects the database as described by repo.DriverOf.
+	URL             string        `yaml:"url" toml:"url"`
+	MaxOpenConns    int           `yaml:"maxOpenConns" toml:"maxOpenConns"`
+	MaxIdleConns    int           `yaml:"maxIdleConns" toml:"maxIdleConns"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime" toml:"connMaxLifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"connMaxIdleTime" toml:"connMaxIdleTime"`
+	// AutoMigrate applies pending migrations at startup.
+	AutoMigrate bool `yaml:"autoMigrate" toml:"autoMigrate"`
+	// PGX serves PostgreSQL DSNs with a native pgx pool instead of database/sql.
+	PGX bool `yaml:"pgx" toml:"pgx"`
+}
+
+type Timeouts struct {
+	// Repo bounds every repository call made while handling a request.
+	Repo time.Duration `yaml:"repo" toml:"repo"`
+	// Routes overrides Repo for routes named by handler.RouteNames.
+	Routes map[string]time.Duration `yaml:"routes" toml:"routes"`
+	// ReadHeader, Read, Write and Idle are the http.Server timeouts.
+	ReadHeader time.Duration `yaml:"readHeader" toml:"readHeader"`
+	Read       time.Duration `yaml:"read" toml:"read"`
+	Write      time.Duration `yaml:"write" toml:"write"`
+	Idle       time.Duration `yaml:"idle" toml:"idle"`
+	// Shutdown bounds draining of in-flight requests and closing of resources on exit.
+	Shutdown time.Duration `yaml:"shutdown" toml:"shutdown"`
+}
+
+type Validation struct {
+	MaxTitleLen        int `yaml:"maxTitleLen" toml:"maxTitleLen"`
+	MaxBodyLen         int `yaml:"maxBodyLen" toml:"maxBodyLen"`
+	MaxCommentsPerPost int `yaml:"maxCommentsPerPost" toml:"maxCommentsPerPost"`
+}
+
+// Cache keeps posts in front of the storage. The in-process cache may serve posts changed
+// by other instances sharing the storage for up to TTL, a Redis server shared by them doesn't.
+type Cache struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// RedisURL selects a Redis server, redis://[:password@]host[:port][/db], instead of the
+	// in-process cache. MaxEntries and MaxComments bound the in-process cache only.
+	RedisURL    string        `yaml:"redisURL" toml:"redisURL"`
+	TTL         time.Duration `yaml:"ttl" toml:"ttl"`
+	MaxEntries  int           `yaml:"maxEntries" toml:"maxEntries"`
+	MaxComments int           `yaml:"maxComments" toml:"maxComments"`
+}
+
+// Features switch optional endpoints on and off.
+type Features struct {
+	Likes    bool `yaml:"likes" toml:"likes"`
+	Comments bool `yaml:"comments" toml:"comments"`
+}
+
+type Log struct {
+	// Level is the initial level, debug, info, warn or error, it may be changed
+	// at runtime with the admin endpoint.
+	Level string `yaml:"level" toml:"level"`
+	// Format is either logging.FormatText or logging.FormatJSON.
+	Format string `yaml:"format" toml:"format"`
+}
+
+const (
+	StorageDB     = "db"
+	StorageMemory = "memory"
+)
+
+func Default() *Config {
+	rules := validation.DefaultRules()
+	cacheOpts := cache.DefaultOptions()
+	return &Config{
+		Storage: StorageDB,
+		Listen:  ":8080",
+		DB: DB{
+			MaxOpenConns: 10,
+			MaxIdleConns: 5,
+		},
+		Timeouts: Timeouts{
+			Repo:       5 * time.Second,
+			ReadHeader: 5 * time.Second,
+			Read:       15 * time.Second,
+			Write:      30 * time.Second,
+			Idle:       60 * time.Second,
+			Shutdown:   20 * time.Second,
+		},
+		IDFormat: idgen.FormatBase36,
+		Validation: Validation{
+			MaxTitleLen:        rules.MaxTitleLen,
+			MaxBodyLen:         rules.MaxBodyLen,
+			MaxCommentsPerPost: rules.MaxCommentsPerPost,
+		},
+		Features: Features{
+			Likes:    true,
+			Comments: true,
+		},
+		CacheControl: handler.DefaultOptions().CacheControl,
+		Cache: Cache{
+			TTL:         cacheOpts.TTL,
+			MaxEntries:  cacheOpts.MaxEntries,
+			MaxComments: cacheOpts.MaxComments,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: logging.FormatText,
+		},
+	}
+}
+
+// setting binds a Config field to a command line flag and an environment variable.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	bind  func(fs *flag.FlagSet, c *Config, usage string)
+	// clear empties the map a map-valued setting is bound to, it's nil for other settings
+	clear func(c *Config)
+}
+
+func stringSetting(name string, env string, usage string, field func(c *Config) *string) setting {
+	return setting{flag: name, env: env, usage: usage, bind: func(fs *flag.FlagSet, c *Config, usage string) {
+		p := field(c)
+		fs.StringVar(p, name, *p, usage)
+	}}
+}
+
+func intSetting(name string, env string, usage string, field func(c *Config) *int) setting {
+	return setting{flag: name, env: env, usage: usage, bind: func(fs *flag.FlagSet, c *Config, usage string) {
+		p := field(c)
+		fs.IntVar(p, name, *p, usage)
+	}}
+}
+
+func boolSetting(name string, env string, usage string, field func(c *Config) *bool) setting {
+	return setting{flag: name, env: env, usage: usage, bind: func(fs *flag.FlagSet, c *Config, usage string) {
+		p := field(c)
+		fs.BoolVar(p, name, *p, usage)
+	}}
+}
+
+func durationMapSetting(name string, env string, usage string, field func(c *Config) *map[string]time.Duration) setting {
+	return setting{flag: name, env: env, usage: usage, bind: func(fs *flag.FlagSet, c *Config, usage string) {
+		fs.Var((*durationMap)(field(c)), name, usage)
+	}, clear: func(c *Config) { *field(c) = nil }}
+}
+
+// durationMap is a flag.Value of comma separated key=duration pairs, e.g. "GetPost=1s,SavePost=10s".
+// Set adds the pairs to the map, so each source overrides only the keys it mentions.
+type durationMap map[string]time.Duration
+
+func (m *durationMap) String() string {
+	if m == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*m))
+	for _, k := range m.keys() {
+		pairs = append(pairs, k+"="+(*m)[k].String())
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m durationMap) keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *durationMap) Set(value string) error {
+	if *m == nil {
+		*m = durationMap{}
+	}
+	for _, pair := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || k == "" {
+			return fmt.Errorf("%q isn't a key=duration pair", pair)
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		(*m)[k] = d
+	}
+	return nil
+}
+
+func stringMapSetting(name string, env string, usage string, field func(c *Config) *map[string]string) setting {
+	return setting{flag: name, env: env, usage: usage, bind: func(fs *flag.FlagSet, c *Config, usage string) {
+		fs.Var((*stringMap)(field(c)), name, usage)
+	}, clear: func(c *Config) { *field(c) = nil }}
+}
+
+// stringMap is a flag.Value of semicolon separated key=value pairs, as values like
+// Cache-Control policies contain commas. Set adds the pairs to the map like durationMap.Set.
+type stringMap map[string]string
+
+func (m *stringMap) String() string {
+	if m == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*m))
+	for _, k := range m.keys() {
+		pairs = append(pairs, k+"="+(*m)[k])
+	}
+	return strings.Join(pairs, ";")
+}
+
+func (m stringMap) keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *stringMap) Set(value string) error {
+	if *m == nil {
+		*m = stringMap{}
+	}
+	for _, pair := range strings.Split(value, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || k == "" {
+			return fmt.Errorf("%q isn't a key=value pair", pair)
+		}
+		(*m)[k] = strings.TrimSpace(v)
+	}
+	return nil
+}
+
+func durationSetting(name string, env string, usage string, field func(c *Config) *time.Duration) setting {
+	return setting{flag: name, env: env, usage: usage, bind: func(fs *flag.FlagSet, c *Config, usage string) {
+		p := field(c)
+		fs.DurationVar(p, name, *p, usage)
+	}}
+}
+
+var settings = []setting{
+	stringSetting("storage", "APP_STORAGE", "where posts are stored: db or memory",
+		func(c *Config) *string { return &c.Storage }),
+	stringSetting("listen", "APP_LISTEN", "address the HTTP server listens on",
+		func(c *Config) *string { return &c.Listen }),
+	stringSetting("adminListen", "APP_ADMIN_LISTEN", "address the server of unauthenticated /admin/ endpoints, e.g. /admin/log-level, listens on, empty disables them",
+		func(c *Config) *string { return &c.AdminListen }),
+	stringSetting("tlsCert", "APP_TLS_CERT", "TLS certificate file, enables HTTPS together with -tlsKey",
+		func(c *Config) *string { return &c.TLS.CertFile }),
+	stringSetting("tlsKey", "APP_TLS_KEY", "TLS private key file",
+		func(c *Config) *string { return &c.TLS.KeyFile }),
+	stringSetting("dsn", "APP_DSN", "database DSN: postgres://..., a PostgreSQL connection string or sqlite://<file>",
+		func(c *Config) *string { return &c.DB.URL }),
+	// pgConn predates SQLite support and is kept as an alias of dsn
+	stringSetting("pgConn", "APP_PG_CONN", "alias of -dsn",
+		func(c *Config) *string { return &c.DB.URL }),
+	intSetting("dbMaxOpenConns", "APP_DB_MAX_OPEN_CONNS", "max number of open DB connections",
+		func(c *Config) *int { return &c.DB.MaxOpenConns }),
+	intSetting("dbMaxIdleConns", "APP_DB_MAX_IDLE_CONNS", "max number of idle DB connections",
+		func(c *Config) *int { return &c.DB.MaxIdleConns }),
+	durationSetting("dbConnMaxLifetime", "APP_DB_CONN_MAX_LIFETIME", "max time a DB connection may be reused, 0 means forever",
+		func(c *Config) *time.Duration { return &c.DB.ConnMaxLifetime }),
+	durationSetting("dbConnMaxIdleTime", "APP_DB_CONN_MAX_IDLE_TIME", "max time a DB connection may be idle, 0 means forever",
+		func(c *Config) *time.Duration { return &c.DB.ConnMaxIdleTime }),
+	boolSetting("autoMigrate", "APP_AUTO_MIGRATE", "apply pending schema migrations at startup",
+		func(c *Config) *bool { return &c.DB.AutoMigrate }),
+	boolSetting("pgx", "APP_DB_PGX", "use a native pgx pool instead of database/sql for PostgreSQL",
+		func(c *Config) *bool { return &c.DB.PGX }),
+	durationSetting("repoTimeout", "APP_REPO_TIMEOUT", "timeout of repository calls made by a request",
+		func(c *Config) *time.Duration { return &c.Timeouts.Repo }),
+	durationMapSetting("routeTimeouts", "APP_ROUTE_TIMEOUTS", "per-route repo timeouts, e.g. GetPost=1s,SavePost=10s",
+		func(c *Config) *map[string]time.Duration { return &c.Timeouts.Routes }),
+	durationSetting("readHeaderTimeout", "APP_READ_HEADER_TIMEOUT", "max time to read request headers",
+		func(c *Config) *time.Duration { return &c.Timeouts.ReadHeader }),
+	durationSetting("readTimeout", "APP_READ_TIMEOUT", "max time to read a whole request",
+		func(c *Config) *time.Duration { return &c.Timeouts.Read }),
+	durationSetting("writeTimeout", "APP_WRITE_TIMEOUT", "max time from the end of request headers to the end of response",
+		func(c *Config) *time.Duration { return &c.Timeouts.Write }),
+	durationSetting("idleTimeout", "APP_IDLE_TIMEOUT", "max time a keep-alive connection may be idle",
+		func(c *Config) *time.Duration { return &c.Timeouts.Idle }),
+	durationSetting("shutdownTimeout", "APP_SHUTDOWN_TIMEOUT", "max time to drain in-flight requests and close resources on exit",
+		func(c *Config) *time.Duration { return &c.Timeouts.Shutdown }),
+	stringSetting("idFormat", "APP_ID_FORMAT", "format of generated post and comment ids: base36, ulid or uuidv7",
+		func(c *Config) *string { return &c.IDFormat }),
+	intSetting("maxTitleLen", "APP_MAX_TITLE_LEN", "max length of post title",
+		func(c *Config) *int { return &c.Validation.MaxTitleLen }),
+	intSetting("maxBodyLen", "APP_MAX_BODY_LEN", "max length of comment body",
+		func(c *Config) *int { return &c.Validation.MaxBodyLen }),
+	intSetting("maxCommentsPerPost", "APP_MAX_COMMENTS_PER_POST", "max number of comments in a post payload",
+		func(c *Config) *int { return &c.Validation.MaxCommentsPerPost }),
+	boolSetting("likes", "APP_FEATURE_LIKES", "enable like/unlike endpoints",
+		func(c *Config) *bool { return &c.Features.Likes }),
+	boolSetting("comments", "APP_FEATURE_COMMENTS", "enable comments sub-resource endpoints",
+		func(c *Config) *bool { return &c.Features.Comments }),
+	stringMapSetting("cacheControl", "APP_CACHE_CONTROL", "per-route Cache-Control headers, e.g. GetPost=public, max-age=60;ListPosts=no-cache",
+		func(c *Config) *map[string]string { return &c.CacheControl }),
+	boolSetting("cache", "APP_CACHE", "cache posts in memory in front of the storage",
+		func(c *Config) *bool { return &c.Cache.Enabled }),
+	stringSetting("cacheRedis", "APP_CACHE_REDIS_URL", "Redis URL of a cache shared by instances, the cache is in-process when empty",
+		func(c *Config) *string { return &c.Cache.RedisURL }),
+	durationSetting("cacheTTL", "APP_CACHE_TTL", "max time a cached post is served for",
+		func(c *Config) *time.Duration { return &c.Cache.TTL }),
+	intSetting("cacheMaxEntries", "APP_CACHE_MAX_ENTRIES", "max number of cached posts",
+		func(c *Config) *int { return &c.Cache.MaxEntries }),
+	intSetting("cacheMaxComments", "APP_CACHE_MAX_COMMENTS", "max number of comments of all cached posts",
+		func(c *Config) *int { return &c.Cache.MaxComments }),
+	stringSetting("logLevel", "APP_LOG_LEVEL", "min level of logged records: debug, info, warn or error",
+		func(c *Config) *string { return &c.Log.Level }),
+	stringSetting("logFormat", "APP_LOG_FORMAT", "format of logged records: text or json",
+		func(c *Config) *string { return &c.Log.Format }),
+}
+
+const (
+	configFlag = "config"
+	configEnv  = "APP_CONFIG"
+)
+
+// Load builds a validated Config from args (without the program name), environment variables
+// looked up with getenv and the YAML or TOML file named by -config or APP_CONFIG.
+// It returns args left after flags, e.g. a subcommand.
+func Load(args []string, getenv func(string) string) (cfg *Config, rest []string, err error) {
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	var configPath string
+	fs.StringVar(&configPath, configFlag, getenv(configEnv), "YAML or TOML config file, also set with "+configEnv)
+	for _, s := range settings {
+		parsed := Default()
+		s.bind(fs, parsed, fmt.Sprintf("%s (%s)", s.usage, s.env))
+		// maps are cleared once their defaults are shown by -help, so values replayed below
+		// hold only the pairs of flags, not defaults overriding the file and env
+		if s.clear != nil {
+			s.clear(parsed)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg = Default()
+	if configPath != "" {
+		if err := loadFile(configPath, cfg); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// values of env and flags are both parsed by a flag set bound to cfg
+	target := flag.NewFlagSet("app", flag.ContinueOnError)
+	for _, s := range settings {
+		s.bind(target, cfg, s.usage)
+	}
+	for _, s := range settings {
+		if v := getenv(s.env); v != "" {
+			if err := target.Set(s.flag, v); err != nil {
+				return nil, nil, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == configFlag || err != nil {
+			return
+		}
+		if setErr := target.Set(f.Name, f.Value.String()); setErr != nil {
+			err = fmt.Errorf("invalid -%s: %w", f.Name, setErr)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// loadFile decodes path over cfg, so settings missing from the file keep their values.
+// Unknown keys are rejected to catch typos.
+func loadFile(path string, cfg *Config) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("can't read config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("can't parse config file %v: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(b), cfg)
+		if err != nil {
+			return fmt.Errorf("can't parse config file %v: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown keys in config file %v: %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("config file %v must have .yaml, .yml or .toml extension", path)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Listen == "" {
+		errs = append(errs, errors.New("listen address must be set"))
+	}
+	if c.AdminListen != "" && c.AdminListen == c.Listen {
+		errs = append(errs, errors.New("admin listen address must differ from listen address"))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("TLS certificate and key files must be set together"))
+	}
+	switch c.Storage {
+	case StorageDB:
+		if c.DB.URL == "" {
+			errs = append(errs, errors.New("DB connection string must be set"))
+		} else if driver, err := repo.DriverOf(c.DB.URL); err != nil {
+			errs = append(errs, err)
+		} else if c.DB.PGX && driver != repo.DriverPostgres {
+			errs = append(errs, errors.New("pgx pool needs a PostgreSQL DSN"))
+		}
+	case StorageMemory:
+	default:
+		errs = append(errs, fmt.Errorf("unknown storage %q", c.Storage))
+	}
+	if c.DB.MaxOpenConns < 1 {
+		errs = append(errs, errors.New("max open DB connections must be positive"))
+	}
+	if c.DB.MaxIdleConns < 0 || c.DB.MaxIdleConns > c.DB.MaxOpenConns {
+		errs = append(errs, errors.New("max idle DB connections must be between 0 and max open connections"))
+	}
+	if c.DB.ConnMaxLifetime < 0 || c.DB.ConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("DB connection lifetimes must not be negative"))
+	}
+	if c.Timeouts.Repo <= 0 {
+		errs = append(errs, errors.New("repo timeout must be positive"))
+	}
+	routes := map[string]bool{}
+	for _, name := range handler.RouteNames() {
+		routes[name] = true
+	}
+	for _, name := range durationMap(c.Timeouts.Routes).keys() {
+		timeout := c.Timeouts.Routes[name]
+		switch {
+		case !routes[name]:
+			errs = append(errs, fmt.Errorf("unknown route %q in route timeouts", name))
+		case timeout <= 0:
+			errs = append(errs, fmt.Errorf("timeout of route %v must be positive", name))
+		case timeout > c.Timeouts.Write:
+			errs = append(errs, fmt.Errorf("timeout of route %v must not be longer than write timeout", name))
+		}
+	}
+	cacheable := map[string]bool{}
+	for _, name := range handler.CacheableRoutes() {
+		cacheable[name] = true
+	}
+	for _, name := range stringMap(c.CacheControl).keys() {
+		if !cacheable[name] {
+			errs = append(errs, fmt.Errorf("route %q in cache control isn't cacheable", name))
+		}
+	}
+	if c.Cache.Enabled && (c.Cache.TTL <= 0 || c.Cache.MaxEntries < 1 || c.Cache.MaxComments < 0) {
+		errs = append(errs, errors.New("cache TTL and max entries must be positive, max comments must not be negative"))
+	}
+	if c.Cache.Enabled && c.Cache.RedisURL != "" {
+		if _, err := cache.NewRedis(c.Cache.RedisURL, cache.Options{}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	t := c.Timeouts
+	if t.ReadHeader <= 0 || t.Read <= 0 || t.Write <= 0 || t.Idle <= 0 || t.Shutdown <= 0 {
+		errs = append(errs, errors.New("server timeouts must be positive"))
+	}
+	if t.Write < t.Repo {
+		errs = append(errs, errors.New("write timeout must not be shorter than repo timeout"))
+	}
+	switch c.IDFormat {
+	case idgen.FormatBase36, idgen.FormatULID, idgen.FormatUUIDv7:
+	default:
+		errs = append(errs, fmt.Errorf("unknown id format %q", c.IDFormat))
+	}
+	if c.Validation.MaxTitleLen < 1 || c.Validation.MaxBodyLen < 1 || c.Validation.MaxCommentsPerPost < 0 {
+		errs = append(errs, errors.New("validation limits must be positive"))
+	}
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, err)
+	}
+	switch c.Log.Format {
+	case logging.FormatText, logging.FormatJSON:
+	default:
+		errs = append(errs, fmt.Errorf("unknown log format %q", c.Log.Format))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package config_test
+
+import (
+	"dmmak/simple-rest-crud/internal/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("can't write config file: %s", err)
+	}
+	return path
+}
+
+func envOf(env map[string]string) func(string) string {
+	return func(key string) string { return env[key] }
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeFile(t, "app.yaml", `
+listen: ":9000"
+db:
+  url: postgres://file
+  maxOpenConns: 20
+timeouts:
+  repo: 2s
+features:
+  likes: false
+`)
+	tomlFile := writeFile(t, "app.toml", `
+listen = ":9000"
+[db]
+url = "postgres://file"
+maxOpenConns = 20
+[timeouts]
+repo = "2s"
+[features]
+likes = false
+`)
+
+	for _, file := range []string{yamlFile, tomlFile} {
+		t.Run(filepath.Ext(file), func(t *testing.T) {
+			env := map[string]string{
+				"APP_CONFIG":  file,
+				"APP_LISTEN":  ":9100",
+				"APP_PG_CONN": "postgres://env",
+			}
+			cfg, rest, err := config.Load([]string{"-pgConn", "postgres://flag", "migrate", "up"}, envOf(env))
+			if err != nil {
+				t.Fatalf("can't load config: %s", err)
+			}
+
+			assert.Equal(t, ":9100", cfg.Listen, "env overrides file")
+			assert.Equal(t, "postgres://flag", cfg.DB.URL, "flag overrides env")
+			assert.Equal(t, 20, cfg.DB.MaxOpenConns, "file overrides default")
+			assert.Equal(t, config.Default().DB.MaxIdleConns, cfg.DB.MaxIdleConns, "default is kept")
+			assert.Equal(t, 2*time.Second, cfg.Timeouts.Repo)
+			assert.False(t, cfg.Features.Likes)
+			assert.True(t, cfg.Features.Comments)
+			assert.Equal(t, []string{"migrate", "up"}, rest)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{
+			name: "missing connection string",
+			args: []string{},
+		},
+		{
+			name: "unknown storage",
+			args: []string{"-storage", "mongo"},
+		},
+		{
+			name: "unsupported DSN scheme",
+			args: []string{"-dsn", "mysql://localhost/posts"},
+		},
+		{
+			name: "pgx pool with SQLite DSN",
+			args: []string{"-dsn", "sqlite://posts.db", "-pgx"},
+		},
+		{
+			name: "unknown flag",
+			args: []string{"-pgConn", "postgres://flag", "-nope"},
+		},
+		{
+			name: "invalid env value",
+			args: []string{"-pgConn", "postgres://flag"},
+			env:  map[string]string{"APP_DB_MAX_OPEN_CONNS": "many"},
+		},
+		{
+			name: "unknown file key",
+			args: []string{"-pgConn", "postgres://flag", "-config", writeFile(t, "typo.yaml", "listne: ':9000'\n")},
+		},
+		{
+			name: "unsupported file format",
+			args: []string{"-pgConn", "postgres://flag", "-config", writeFile(t, "app.json", "{}")},
+		},
+		{
+			name: "tls key without certificate",
+			args: []string{"-pgConn", "postgres://flag", "-tlsKey", "key.pem"},
+		},
+		{
+			name: "idle conns above open conns",
+			args: []string{"-pgConn", "postgres://flag", "-dbMaxOpenConns", "2", "-dbMaxIdleConns", "3"},
+		},
+		{
+			name: "unknown id format",
+			args: []string{"-pgConn", "postgres://flag", "-idFormat", "serial"},
+		},
+		{
+			name: "zero repo timeout",
+			args: []string{"-pgConn", "postgres://flag", "-repoTimeout", "0s"},
+		},
+		{
+			name: "unknown log level",
+			args: []string{"-pgConn", "postgres://flag", "-logLevel", "verbose"},
+		},
+		{
+			name: "unknown log format",
+			args: []string{"-pgConn", "postgres://flag"},
+			env:  map[string]string{"APP_LOG_FORMAT": "logfmt"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := config.Load(test.args, envOf(test.env))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadRouteTimeouts(t *testing.T) {
+	file := writeFile(t, "app.yaml", `
+timeouts:
+  routes:
+    GetPost: 1s
+    SavePost: 10s
+`)
+	cfg, _, err := config.Load([]string{"-pgConn", "postgres://flag", "-config", file, "-routeTimeouts", "GetPost=2s,ListPosts=3s"}, envOf(nil))
+	if err != nil {
+		t.Fatalf("can't load config: %s", err)
+	}
+	assert.Equal(t, map[string]time.Duration{
+		"GetPost":   2 * time.Second,
+		"SavePost":  10 * time.Second,
+		"ListPosts": 3 * time.Second,
+	}, cfg.Timeouts.Routes, "flag overrides only the routes it mentions")
+
+	_, _, err = config.Load([]string{"-pgConn", "postgres://flag", "-routeTimeouts", "GetPosts=2s"}, envOf(nil))
+	assert.ErrorContains(t, err, `unknown route "GetPosts"`)
+}
+
+func TestLoadMemoryStorageNeedsNoDB(t *testing.T) {
+	cfg, _, err := config.Load(nil, envOf(map[string]string{"APP_STORAGE": "memory"}))
+	if err != nil {
+		t.Fatalf("can't load config: %s", err)
+	}
+	assert.Equal(t, config.StorageMemory, cfg.Storage)
+}
+
+func TestLoadSQLiteDSN(t *testing.T) {
+	cfg, _, err := config.Load([]string{"-dsn", "sqlite://posts.db"}, envOf(nil))
+	assert.Nil(t, err)
+	assert.Equal(t, config.StorageDB, cfg.Storage)
+	assert.Equal(t, "sqlite://posts.db", cfg.DB.URL)
+
+	cfg, _, err = config.Load(nil, envOf(map[string]string{"APP_DSN": "sqlite://env.db"}))
+	assert.Nil(t, err)
+	assert.Equal(t, "sqlite://env.db", cfg.DB.URL)
+}
+
+func TestLoadCacheControl(t *testing.T) {
+	file := writeFile(t, "app.toml", `
+[cacheControl]
+GetPost = "private, max-age=10"
+`)
+	cfg, _, err := config.Load([]string{"-pgConn", "postgres://flag", "-config", file}, envOf(map[string]string{
+		"APP_CACHE_CONTROL": "ListPosts=public, max-age=60, stale-while-revalidate=30",
+	}))
+	if err != nil {
+		t.Fatalf("can't load config: %s", err)
+	}
+	assert.Equal(t, map[string]string{
+		"GetPost":   "private, max-age=10",
+		"ListPosts": "public, max-age=60, stale-while-revalidate=30",
+	}, cfg.CacheControl)
+
+	_, _, err = config.Load([]string{"-pgConn", "postgres://flag", "-cacheControl", "SavePost=no-store"}, envOf(nil))
+	assert.ErrorContains(t, err, `route "SavePost" in cache control isn't cacheable`)
+}
+
+func TestLoadCache(t *testing.T) {
+	cfg, _, err := config.Load([]string{"-pgConn", "postgres://flag", "-cache", "-cacheTTL", "5s"}, envOf(map[string]string{
+		"APP_CACHE_MAX_ENTRIES": "100",
+	}))
+	if err != nil {
+		t.Fatalf("can't load config: %s", err)
+	}
+	assert.Equal(t, config.Cache{Enabled: true, TTL: 5 * time.Second, MaxEntries: 100, MaxComments: 1000000}, cfg.Cache)
+
+	_, _, err = config.Load([]string{"-pgConn", "postgres://flag", "-cache", "-cacheTTL", "0s"}, envOf(nil))
+	assert.ErrorContains(t, err, "cache TTL and max entries must be positive")
+
+	cfg, _, err = config.Load([]string{"-pgConn", "postgres://flag", "-cache"}, envOf(map[string]string{
+		"APP_CACHE_REDIS_URL": "redis://cache:6379/1",
+	}))
+	if err != nil {
+		t.Fatalf("can't load config: %s", err)
+	}
+	assert.Equal(t, "redis://cache:6379/1", cfg.Cache.RedisURL)
+
+	_, _, err = config.Load([]string{"-pgConn", "postgres://flag", "-cache", "-cacheRedis", "cache:6379"}, envOf(nil))
+	assert.ErrorContains(t, err, "Redis URL must look like")
+}
+
+func TestLoadLog(t *testing.T) {
+	cfg, _, err := config.Load([]string{"-pgConn", "postgres://flag"}, envOf(nil))
+	if err != nil {
+		t.Fatalf("can't load config: %s", err)
+	}
+	assert.Equal(t, config.Log{Level: "info", Format: "text"}, cfg.Log)
+	assert.Empty(t, cfg.AdminListen)
+
+	cfg, _, err = config.Load([]string{"-pgConn", "postgres://flag", "-logLevel", "debug", "-adminListen", "127.0.0.1:9090"}, envOf(map[string]string{
+		"APP_LOG_FORMAT": "json",
+	}))
+	if err != nil {
+		t.Fatalf("can't load config: %s", err)
+	}
+	assert.Equal(t, config.Log{Level: "debug", Format: "json"}, cfg.Log)
+	assert.Equal(t, "127.0.0.1:9090", cfg.AdminListen)
+
+	_, _, err = config.Load([]string{"-pgConn", "postgres://flag", "-adminListen", ":8080"}, envOf(nil))
+	assert.ErrorContains(t, err, "admin listen address must differ")
+}
+
+func TestLoadMapPrecedence(t *testing.T) {
+	file := writeFile(t, "app.yaml", `
+cacheControl:
+  ListPosts: "public, max-age=5"
+timeouts:
+  routes:
+    GetPost: 1s
+    ListPosts: 2s
+`)
+	cfg, _, err := config.Load([]string{"-pgConn", "postgres://flag", "-config", file,
+		"-cacheControl", "GetPost=private", "-routeTimeouts", "ListPosts=4s"}, envOf(map[string]string{
+		"APP_ROUTE_TIMEOUTS": "GetPost=3s,SavePost=3s",
+	}))
+	if err != nil {
+		t.Fatalf("can't load config: %s", err)
+	}
+	assert.Equal(t, map[string]string{
+		"GetPost":   "private",
+		"ListPosts": "public, max-age=5",
+	}, cfg.CacheControl)
+	assert.Equal(t, map[string]time.Duration{
+		"GetPost":   3 * time.Second,
+		"ListPosts": 4 * time.Second,
+		"SavePost":  3 * time.Second,
+	}, cfg.Timeouts.Routes)
+}
@@ -1,10 +1,17 @@
 package entity
 
+import "time"
+
 type RedditPost struct {
-	UUID     string
-	Title    string
-	Likes    uint32
-	Comments []*Comment
+	UUID  string
+	Title string
+	Likes uint32
+	// Version is increased by every change of the post, its comments or likes.
+	// It's assigned by repositories, the one sent by clients is ignored.
+	Version uint64
+	// UpdatedAt is the time Version was last increased at.
+	UpdatedAt time.Time
+	Comments  []*Comment
 }
 
 type Comment struct {
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"bytes"
+	"dmmak/simple-rest-crud/internal/logging"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// LogLevel is the representation of the level records are logged from.
+type LogLevel struct {
+	Level string
+}
+
+// LogLevelHandler reports level of logger on GET and changes it to the one of the payload on PUT,
+// e.g. {"Level": "debug"}, so verbose logging can be turned on without a restart.
+// It's an admin endpoint, it isn't meant to be reachable by clients of the API.
+func LogLevelHandler(level *slog.LevelVar, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var payload LogLevel
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				writeProblem(w, http.StatusBadRequest, CodeMalformedBody, err.Error())
+				return
+			}
+			parsed, err := logging.ParseLevel(payload.Level)
+			if err != nil {
+				writeProblem(w, http.StatusUnprocessableEntity, CodeValidationFailed, err.Error())
+				return
+			}
+			if old := level.Level(); parsed != old {
+				level.Set(parsed)
+				// logged at the higher of both levels, so it's kept whichever way the level went
+				logger.Log(r.Context(), max(parsed, old), "log level changed", "from", old, "to", parsed)
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			writeProblem(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, fmt.Sprintf("method %v isn't allowed for %v", r.Method, r.URL.Path))
+			return
+		}
+		b := new(bytes.Buffer)
+		if err := json.NewEncoder(b).Encode(&LogLevel{Level: level.Level().String()}); err != nil {
+			logger.ErrorContext(r.Context(), "can't encode log level response body", logging.KeyErr, err)
+			writeProblem(w, http.StatusInternalServerError, CodeInternal, "")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(b.Bytes()); err != nil {
+			logger.WarnContext(r.Context(), "can't write log level response body", logging.KeyErr, err)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package handler_test
+
+import (
+	"dmmak/simple-rest-crud/internal/handler"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevelHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		body          string
+		expStatusCode int
+		expBody       string
+		expLevel      slog.Level
+	}{
+		{
+			name:          "get",
+			method:        http.MethodGet,
+			expStatusCode: http.StatusOK,
+			expBody:       `{"Level":"INFO"}`,
+			expLevel:      slog.LevelInfo,
+		},
+		{
+			name:          "set",
+			method:        http.MethodPut,
+			body:          `{"Level":"debug"}`,
+			expStatusCode: http.StatusOK,
+			expBody:       `{"Level":"DEBUG"}`,
+			expLevel:      slog.LevelDebug,
+		},
+		{
+			name:          "unknown level",
+			method:        http.MethodPut,
+			body:          `{"Level":"verbose"}`,
+			expStatusCode: http.StatusUnprocessableEntity,
+			expLevel:      slog.LevelInfo,
+		},
+		{
+			name:          "malformed body",
+			method:        http.MethodPut,
+			body:          `{"Level":`,
+			expStatusCode: http.StatusBadRequest,
+			expLevel:      slog.LevelInfo,
+		},
+		{
+			name:          "method not allowed",
+			method:        http.MethodDelete,
+			expStatusCode: http.StatusMethodNotAllowed,
+			expLevel:      slog.LevelInfo,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			level := new(slog.LevelVar)
+			rr := httptest.NewRecorder()
+			handler.LogLevelHandler(level, discardLogger).ServeHTTP(rr,
+				httptest.NewRequest(test.method, "/admin/log-level", strings.NewReader(test.body)))
+
+			assert.Equal(t, test.expStatusCode, rr.Code)
+			if test.expBody != "" {
+				assert.JSONEq(t, test.expBody, rr.Body.String())
+			}
+			assert.Equal(t, test.expLevel, level.Level())
+		})
+	}
+}
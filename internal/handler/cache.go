@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CacheableRoutes returns names of routes Options.CacheControl applies to.
+func CacheableRoutes() []string {
+	return []string{RouteGetPost, RouteListPosts}
+}
+
+// bodyETag returns a weak entity tag of an encoded response body.
+func bodyETag(body []byte) string {
+	h := fnv.New64a()
+	h.Write(body)
+	return fmt.Sprintf(`W/"%x"`, h.Sum64())
+}
+
+func isConditional(r *http.Request) bool {
+	return r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != ""
+}
+
+// notModified tells if the client's copy described by conditional headers of r is still
+// the current one. If-None-Match takes precedence over If-Modified-Since (RFC 9110, 13.2.2),
+// which is ignored when lastModified is zero.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etagListed(header, etag)
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+	// Last-Modified has a resolution of seconds
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// etagListed compares tags of an If-None-Match header with etag weakly, ignoring W/ prefixes.
+func etagListed(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// setValidators sets ETag, Last-Modified unless lastModified is zero, and the Cache-Control
+// policy of route unless it's empty.
+func (h *HttpHandler) setValidators(w http.ResponseWriter, route string, etag string, lastModified time.Time) {
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if policy := h.opts.CacheControl[route]; policy != "" {
+		w.Header().Set("Cache-Control", policy)
+	}
+}
+
+// writeNotModified responds with 304 carrying the validators a 200 would.
+func (h *HttpHandler) writeNotModified(w http.ResponseWriter, route string, etag string, lastModified time.Time) {
+	h.setValidators(w, route, etag, lastModified)
+	w.WriteHeader(http.StatusNotModified)
+}
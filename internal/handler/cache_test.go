@@ -0,0 +1,127 @@
+package handler_test
+
+import (
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/idgen"
+	"dmmak/simple-rest-crud/internal/validation"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestGetPostConditional(t *testing.T) {
+	updatedAt := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	tests := []struct {
+		name          string
+		header        http.Header
+		expStatusCode int
+	}{
+		{
+			name:          "unconditional",
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "etag matches",
+			header:        http.Header{"If-None-Match": {`"1", "3"`}},
+			expStatusCode: http.StatusNotModified,
+		},
+		{
+			name:          "weak etag matches",
+			header:        http.Header{"If-None-Match": {`W/"3"`}},
+			expStatusCode: http.StatusNotModified,
+		},
+		{
+			name:          "etag changed",
+			header:        http.Header{"If-None-Match": {`"2"`}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "not modified since",
+			header:        http.Header{"If-Modified-Since": {updatedAt.Format(http.TimeFormat)}},
+			expStatusCode: http.StatusNotModified,
+		},
+		{
+			name:          "modified since",
+			header:        http.Header{"If-Modified-Since": {updatedAt.Add(-time.Second).Format(http.TimeFormat)}},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name: "etag takes precedence",
+			header: http.Header{
+				"If-None-Match":     {`"2"`},
+				"If-Modified-Since": {updatedAt.Format(http.TimeFormat)},
+			},
+			expStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockRedditPostsRepo(mockCtrl)
+			if test.header != nil {
+				mockRepo.EXPECT().Revision(gomock.Any(), "p1000000").Return(handler.Revision{Version: 3, UpdatedAt: updatedAt}, true, nil)
+			}
+			if test.expStatusCode == http.StatusOK {
+				mockRepo.EXPECT().Get(gomock.Any(), "p1000000").Return(&entity.RedditPost{UUID: "p1000000", Version: 3, UpdatedAt: updatedAt}, true, nil)
+			}
+
+			h := newHandler(mockRepo, nil)
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/post/p1000000", nil)
+			for k, v := range test.header {
+				req.Header[k] = v
+			}
+			h.Routes().ServeHTTP(rr, req)
+
+			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+			assert.Equal(t, `"3"`, rr.Result().Header.Get("ETag"))
+			assert.Equal(t, "Wed, 01 May 2024 12:00:00 GMT", rr.Result().Header.Get("Last-Modified"))
+			assert.Equal(t, "no-cache", rr.Result().Header.Get("Cache-Control"))
+			if test.expStatusCode == http.StatusNotModified {
+				assert.Empty(t, rr.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestListPostsConditional(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepo := NewMockRedditPostsRepo(mockCtrl)
+	mockRepo.EXPECT().List(gomock.Any(), "", gomock.Any()).Return([]*entity.RedditPost{{UUID: "p1000000", Version: 1}}, nil).Times(2)
+
+	h := newHandler(mockRepo, nil)
+	rr := httptest.NewRecorder()
+	h.ListPosts(rr, httptest.NewRequest(http.MethodGet, "/post", nil))
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+	tag := rr.Result().Header.Get("ETag")
+	assert.Regexp(t, `^W/".+"$`, tag)
+
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/post", nil)
+	req.Header.Set("If-None-Match", tag)
+	h.ListPosts(rr, req)
+	assert.Equal(t, http.StatusNotModified, rr.Result().StatusCode)
+	assert.Equal(t, tag, rr.Result().Header.Get("ETag"))
+}
+
+func TestCacheControlOption(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepo := NewMockRedditPostsRepo(mockCtrl)
+	mockRepo.EXPECT().Get(gomock.Any(), "p1000000").Return(&entity.RedditPost{UUID: "p1000000", Version: 1}, true, nil)
+
+	opts := handler.DefaultOptions()
+	opts.CacheControl = map[string]string{handler.RouteGetPost: "public, max-age=60"}
+	ids := idgen.NewBase36()
+	h := handler.New(mockRepo, nil, ids, validation.New(validation.DefaultRules(), ids), opts, discardLogger)
+	rr := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/post/p1000000", nil))
+
+	assert.Equal(t, "public, max-age=60", rr.Result().Header.Get("Cache-Control"))
+	assert.Empty(t, rr.Result().Header.Get("Last-Modified"), "unknown modification time isn't sent")
+}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"bytes"
+	"dmmak/simple-rest-crud/internal/logging"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+func (h *HttpHandler) SaveComment(w http.ResponseWriter, r *http.Request) {
+	postID := postIDParam.Value(r)
+
+	comment, err := h.validator.DecodeComment(r.Body)
+	if err != nil {
+		h.logger.InfoContext(r.Context(), "can't decode save comment request body", logging.KeyErr, err)
+		writeInvalidPayload(w, err)
+		return
+	}
+	comment.Likes = 0
+	h.assignCommentID(comment)
+	r = r.WithContext(logging.With(r.Context(), slog.String(logging.KeyCommentID, comment.UUID)))
+
+	ctx, cancel := h.repoContext(r, RouteSaveComment)
+	defer cancel()
+	version, ok := h.ifMatch(ctx, w, r, postID, true)
+	if !ok {
+		return
+	}
+	postVersion, found, err := h.commentsRepo.Save(ctx, postID, comment, version)
+	if err != nil {
+		h.logRepoError(r.Context(), "error while saving comment", err)
+		writeRepoError(w, err)
+		return
+	}
+	if !found {
+		errMsg := fmt.Sprintf("can't find post with uuid=%v", postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusNotFound, CodeNotFound, errMsg)
+		return
+	}
+	w.Header().Set("ETag", etag(postVersion))
+	h.writeCreated(w, r, "/post/"+postID+"/comments/"+comment.UUID, comment)
+}
+
+func (h *HttpHandler) GetComment(w http.ResponseWriter, r *http.Request) {
+	postID, commentID := postIDParam.Value(r), commentIDParam.Value(r)
+
+	ctx, cancel := h.repoContext(r, RouteGetComment)
+	defer cancel()
+	comment, found, err := h.commentsRepo.Get(ctx, postID, commentID)
+	if err != nil {
+		h.logRepoError(r.Context(), "error while getting comment", err)
+		writeRepoError(w, err)
+		return
+	}
+	if !found {
+		errMsg := fmt.Sprintf("can't find comment with uuid=%v in post with uuid=%v", commentID, postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusNotFound, CodeNotFound, errMsg)
+		return
+	}
+
+	b := new(bytes.Buffer)
+	err = json.NewEncoder(b).Encode(comment)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "can't encode get comment response body", logging.KeyErr, err)
+		writeProblem(w, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(b.Bytes())
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "can't write get comment response body", logging.KeyErr, err)
+	}
+}
+
+// PatchComment applies a JSON Merge Patch (RFC 7386) to the stored comment.
+func (h *HttpHandler) PatchComment(w http.ResponseWriter, r *http.Request) {
+	postID, commentID := postIDParam.Value(r), commentIDParam.Value(r)
+
+	var patch any
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		h.logger.InfoContext(r.Context(), "can't decode patch comment request body", logging.KeyErr, err)
+		writeProblem(w, http.StatusBadRequest, CodeMalformedBody, err.Error())
+		return
+	}
+
+	ctx, cancel := h.repoContext(r, RoutePatchComment)
+	defer cancel()
+	version, ok := h.ifMatch(ctx, w, r, postID, true)
+	if !ok {
+		return
+	}
+	comment, found, err := h.commentsRepo.Get(ctx, postID, commentID)
+	if err != nil {
+		h.logRepoError(r.Context(), "error while getting comment for patch", err)
+		writeRepoError(w, err)
+		return
+	}
+	if !found {
+		errMsg := fmt.Sprintf("can't find comment with uuid=%v in post with uuid=%v", commentID, postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusNotFound, CodeNotFound, errMsg)
+		return
+	}
+
+	storedLikes := comment.Likes
+	patched, err := applyMergePatch(comment, patch)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "can't apply patch to comment", logging.KeyErr, err)
+		writeProblem(w, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	// the stored ID stays valid after a change of the ID format
+	comment, err = h.validator.Stored(commentID).DecodeComment(bytes.NewReader(patched))
+	if err != nil {
+		h.logger.InfoContext(r.Context(), "invalid patched comment", logging.KeyErr, err)
+		writeInvalidPayload(w, err)
+		return
+	}
+	if comment.UUID != commentID {
+		errMsg := fmt.Sprintf("comment uuid=%v can't be changed by patch", commentID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusBadRequest, CodeInvalidID, errMsg)
+		return
+	}
+	comment.Likes = storedLikes
+
+	postVersion, found, err := h.commentsRepo.Update(ctx, postID, comment, version)
+	if err != nil {
+		h.logRepoError(r.Context(), "error while updating comment", err)
+		writeRepoError(w, err)
+		return
+	}
+	if !found {
+		errMsg := fmt.Sprintf("can't find comment with uuid=%v in post with uuid=%v", commentID, postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusNotFound, CodeNotFound, errMsg)
+		return
+	}
+
+	b := new(bytes.Buffer)
+	err = json.NewEncoder(b).Encode(comment)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "can't encode patch comment response body", logging.KeyErr, err)
+		writeProblem(w, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	w.Header().Set("ETag", etag(postVersion))
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(b.Bytes())
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "can't write patch comment response body", logging.KeyErr, err)
+	}
+}
+
+func (h *HttpHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	postID, commentID := postIDParam.Value(r), commentIDParam.Value(r)
+
+	ctx, cancel := h.repoContext(r, RouteDeleteComment)
+	defer cancel()
+	version, ok := h.ifMatch(ctx, w, r, postID, true)
+	if !ok {
+		return
+	}
+	postVersion, found, err := h.commentsRepo.Delete(ctx, postID, commentID, version)
+	if err != nil {
+		h.logRepoError(r.Context(), "error while deleting comment", err)
+		writeRepoError(w, err)
+		return
+	}
+	if !found {
+		errMsg := fmt.Sprintf("can't find comment with uuid=%v in post with uuid=%v", commentID, postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusNotFound, CodeNotFound, errMsg)
+		return
+	}
+	w.Header().Set("ETag", etag(postVersion))
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,326 @@
+package handler_test
+
+import (
+	"bytes"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSaveComment(t *testing.T) {
+	tests := []struct {
+		name          string
+		expStatusCode int
+	}{
+		{
+			name:          "success",
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name:          "post not found",
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "version mismatch",
+			expStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:          "error",
+			expStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requestEntity := &entity.Comment{
+				UUID:  "c0000001",
+				Body:  "Some comment text 1",
+				Likes: 1,
+			}
+			savedEntity := &entity.Comment{
+				UUID: "c0000001",
+				Body: "Some comment text 1",
+			}
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockCommentsRepo(mockCtrl)
+			mockRecorder := mockRepo.EXPECT().Save(gomock.Any(), gomock.Eq("p1000000"), gomock.Eq(savedEntity), gomock.Eq(uint64(3)))
+
+			switch test.name {
+			case "success":
+				mockRecorder.Return(uint64(4), true, nil)
+			case "post not found":
+				mockRecorder.Return(uint64(0), false, nil)
+			case "version mismatch":
+				mockRecorder.Return(uint64(0), true, fmt.Errorf("can't insert comment: %w", handler.ErrVersionMismatch))
+			case "error":
+				mockRecorder.Return(uint64(0), false, fmt.Errorf("some repo internal error"))
+			}
+
+			h := newHandler(nil, mockRepo)
+			rr := httptest.NewRecorder()
+			reqBody := new(bytes.Buffer)
+			err := json.NewEncoder(reqBody).Encode(requestEntity)
+			if err != nil {
+				log.Fatal(err)
+			}
+			req, err := http.NewRequest(http.MethodPost, "/post/p1000000/comments", reqBody)
+			if err != nil {
+				log.Fatal(err)
+			}
+			h.Routes().ServeHTTP(rr, withIfMatch(req, `"3"`))
+
+			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+			if test.expStatusCode == http.StatusCreated {
+				assert.Equal(t, "/post/p1000000/comments/c0000001", rr.Result().Header.Get("Location"))
+				assert.Equal(t, `"4"`, rr.Result().Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestGetComment(t *testing.T) {
+	responseEntity := &entity.Comment{
+		UUID:  "c0000001",
+		Body:  "Some comment text 1",
+		Likes: 1,
+	}
+	tests := []struct {
+		name          string
+		expStatusCode int
+	}{
+		{
+			name:          "success",
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "not found",
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "error",
+			expStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockCommentsRepo(mockCtrl)
+			mockRecorder := mockRepo.EXPECT().Get(gomock.Any(), gomock.Eq("p1000000"), gomock.Eq("c0000001"))
+
+			switch test.name {
+			case "success":
+				mockRecorder.Return(responseEntity, true, nil)
+			case "not found":
+				mockRecorder.Return(nil, false, nil)
+			case "error":
+				mockRecorder.Return(nil, false, fmt.Errorf("some repo internal error"))
+			}
+
+			h := newHandler(nil, mockRepo)
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/post/p1000000/comments/c0000001", nil)
+			if err != nil {
+				log.Fatal(err)
+			}
+			h.Routes().ServeHTTP(rr, req)
+
+			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+			if test.expStatusCode == http.StatusOK {
+				actualComment := &entity.Comment{}
+				err = json.NewDecoder(rr.Body).Decode(actualComment)
+				if err != nil {
+					t.Fatalf("can't decode response body: %s", err)
+				}
+				assert.Equal(t, responseEntity, actualComment)
+			}
+		})
+	}
+}
+
+func TestPatchComment(t *testing.T) {
+	storedComment := func() *entity.Comment {
+		return &entity.Comment{
+			UUID:  "c0000001",
+			Body:  "Some coment text",
+			Likes: 1,
+		}
+	}
+	tests := []struct {
+		name          string
+		patch         string
+		expComment    *entity.Comment
+		expStatusCode int
+	}{
+		{
+			name:          "success",
+			patch:         `{"Body": "Some comment text"}`,
+			expComment:    &entity.Comment{UUID: "c0000001", Body: "Some comment text", Likes: 1},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "not found",
+			patch:         `{"Body": "Some comment text"}`,
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "uuid change",
+			patch:         `{"UUID": "c9999999"}`,
+			expStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockCommentsRepo(mockCtrl)
+
+			switch test.name {
+			case "success":
+				mockRepo.EXPECT().Get(gomock.Any(), gomock.Eq("p1000000"), gomock.Eq("c0000001")).Return(storedComment(), true, nil)
+				mockRepo.EXPECT().Update(gomock.Any(), gomock.Eq("p1000000"), gomock.Eq(test.expComment), gomock.Eq(uint64(3))).Return(uint64(4), true, nil)
+			case "not found":
+				mockRepo.EXPECT().Get(gomock.Any(), gomock.Eq("p1000000"), gomock.Eq("c0000001")).Return(nil, false, nil)
+			case "uuid change":
+				mockRepo.EXPECT().Get(gomock.Any(), gomock.Eq("p1000000"), gomock.Eq("c0000001")).Return(storedComment(), true, nil)
+			}
+
+			h := newHandler(nil, mockRepo)
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPatch, "/post/p1000000/comments/c0000001", bytes.NewReader([]byte(test.patch)))
+			if err != nil {
+				log.Fatal(err)
+			}
+			h.Routes().ServeHTTP(rr, withIfMatch(req, `"3"`))
+
+			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+			if test.expStatusCode == http.StatusOK {
+				assert.Equal(t, `"4"`, rr.Result().Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestDeleteComment(t *testing.T) {
+	tests := []struct {
+		name          string
+		expStatusCode int
+	}{
+		{
+			name:          "success",
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "not found",
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "version mismatch",
+			expStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:          "error",
+			expStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockCommentsRepo(mockCtrl)
+			mockRecorder := mockRepo.EXPECT().Delete(gomock.Any(), gomock.Eq("p1000000"), gomock.Eq("c0000001"), gomock.Eq(uint64(3)))
+
+			switch test.name {
+			case "success":
+				mockRecorder.Return(uint64(4), true, nil)
+			case "not found":
+				mockRecorder.Return(uint64(0), false, nil)
+			case "version mismatch":
+				mockRecorder.Return(uint64(0), true, fmt.Errorf("can't delete comment: %w", handler.ErrVersionMismatch))
+			case "error":
+				mockRecorder.Return(uint64(0), false, fmt.Errorf("some repo internal error"))
+			}
+
+			h := newHandler(nil, mockRepo)
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodDelete, "/post/p1000000/comments/c0000001", nil)
+			if err != nil {
+				log.Fatal(err)
+			}
+			h.Routes().ServeHTTP(rr, withIfMatch(req, `"3"`))
+
+			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+			if test.expStatusCode == http.StatusOK {
+				assert.Equal(t, `"4"`, rr.Result().Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestCommentRoute(t *testing.T) {
+	tests := []struct {
+		name          string
+		request       *http.Request
+		expStatusCode int
+	}{
+		{
+			name:          "success POST",
+			request:       withIfMatch(httptest.NewRequest(http.MethodPost, "/post/p1000000/comments", bytes.NewReader([]byte(`{"Body": "Some comment text"}`))), `"3"`),
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name:          "success GET",
+			request:       httptest.NewRequest(http.MethodGet, "/post/p1000000/comments/c0000001", nil),
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "success DELETE",
+			request:       withIfMatch(httptest.NewRequest(http.MethodDelete, "/post/p1000000/comments/c0000001", nil), `"3"`),
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "missing If-Match",
+			request:       httptest.NewRequest(http.MethodDelete, "/post/p1000000/comments/c0000001", nil),
+			expStatusCode: http.StatusPreconditionRequired,
+		},
+		{
+			name:          "not allowed POST to comment",
+			request:       httptest.NewRequest(http.MethodPost, "/post/p1000000/comments/c0000001", bytes.NewReader([]byte("{}"))),
+			expStatusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:          "not allowed GET collection",
+			request:       httptest.NewRequest(http.MethodGet, "/post/p1000000/comments", nil),
+			expStatusCode: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockCommentsRepo(mockCtrl)
+
+			switch test.name {
+			case "success POST":
+				mockRepo.EXPECT().Save(gomock.Any(), gomock.Eq("p1000000"), gomock.Any(), gomock.Eq(uint64(3))).Return(uint64(4), true, nil)
+			case "success GET":
+				mockRepo.EXPECT().Get(gomock.Any(), gomock.Eq("p1000000"), gomock.Eq("c0000001")).Return(&entity.Comment{}, true, nil)
+			case "success DELETE":
+				mockRepo.EXPECT().Delete(gomock.Any(), gomock.Eq("p1000000"), gomock.Eq("c0000001"), gomock.Eq(uint64(3))).Return(uint64(4), true, nil)
+			}
+
+			h := newHandler(nil, mockRepo)
+			rr := httptest.NewRecorder()
+			h.Routes().ServeHTTP(rr, test.request)
+
+			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+		})
+	}
+}
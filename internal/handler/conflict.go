@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ConflictPolicy tells RedditPostsRepo.Save what to do when the post already exists.
+type ConflictPolicy int
+
+const (
+	// ConflictReject fails the save with ErrConflict.
+	ConflictReject ConflictPolicy = iota
+	// ConflictOverwrite replaces the stored post, its likes and its whole comment set.
+	ConflictOverwrite
+	// ConflictMerge replaces the title and adds the comments, updating bodies of the ones
+	// already stored. Likes and comments missing from the post are kept.
+	ConflictMerge
+)
+
+const (
+	conflictQueryParam = "onConflict"
+	ConflictHeader     = "X-On-Conflict"
+)
+
+var conflictPolicies = map[string]ConflictPolicy{
+	"reject":    ConflictReject,
+	"overwrite": ConflictOverwrite,
+	"merge":     ConflictMerge,
+}
+
+func (p ConflictPolicy) String() string {
+	for name, policy := range conflictPolicies {
+		if policy == p {
+			return name
+		}
+	}
+	return fmt.Sprintf("ConflictPolicy(%d)", int(p))
+}
+
+// conflictPolicy reads the policy from the onConflict query parameter, falling back
+// to the X-On-Conflict header. Saves reject conflicts unless told otherwise.
+func conflictPolicy(r *http.Request) (ConflictPolicy, error) {
+	name := r.URL.Query().Get(conflictQueryParam)
+	if name == "" {
+		name = r.Header.Get(ConflictHeader)
+	}
+	if name == "" {
+		return ConflictReject, nil
+	}
+	policy, ok := conflictPolicies[name]
+	if !ok {
+		return 0, fmt.Errorf("%v must be reject, overwrite or merge, got %q", conflictQueryParam, name)
+	}
+	return policy, nil
+}
@@ -0,0 +1,159 @@
+package handler_test
+
+import (
+	"bytes"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSavePostConflictPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		target        string
+		header        string
+		ifMatch       string
+		ifNoneMatch   string
+		saveErr       error
+		expPolicy     handler.ConflictPolicy
+		expVersion    uint64
+		created       bool
+		expStatusCode int
+	}{
+		{
+			name:          "rejects by default",
+			target:        "/post",
+			expPolicy:     handler.ConflictReject,
+			created:       true,
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name:          "overwrite from query",
+			target:        "/post?onConflict=overwrite",
+			ifMatch:       `"2"`,
+			expPolicy:     handler.ConflictOverwrite,
+			expVersion:    2,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "merge from header",
+			target:        "/post",
+			header:        "merge",
+			ifMatch:       "*",
+			expPolicy:     handler.ConflictMerge,
+			expVersion:    2,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "query overrides header",
+			target:        "/post?onConflict=reject",
+			header:        "overwrite",
+			expPolicy:     handler.ConflictReject,
+			created:       true,
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name:          "merge of missing post",
+			target:        "/post?onConflict=merge",
+			ifMatch:       "*",
+			expStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:          "update requires If-Match",
+			target:        "/post?onConflict=overwrite",
+			expStatusCode: http.StatusPreconditionRequired,
+		},
+		{
+			name:          "create only",
+			target:        "/post",
+			ifNoneMatch:   "*",
+			expPolicy:     handler.ConflictReject,
+			created:       true,
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name:          "create only of existing post",
+			target:        "/post",
+			ifNoneMatch:   "*",
+			saveErr:       fmt.Errorf("can't insert new post: %w", handler.ErrConflict),
+			expPolicy:     handler.ConflictReject,
+			expStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:          "create only with a comment of another post",
+			target:        "/post",
+			ifNoneMatch:   "*",
+			saveErr:       fmt.Errorf("%w: 1 of 1 comments belong to other posts", handler.ErrConflict),
+			expPolicy:     handler.ConflictReject,
+			expStatusCode: http.StatusConflict,
+		},
+		{
+			name:          "create only with merge",
+			target:        "/post?onConflict=merge",
+			ifNoneMatch:   "*",
+			expStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:          "unknown policy",
+			target:        "/post?onConflict=ignore",
+			expStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockRedditPostsRepo(mockCtrl)
+			stored := &entity.RedditPost{
+				UUID:     "p1000000",
+				Title:    "New title",
+				Likes:    7,
+				Comments: []*entity.Comment{{UUID: "c0000001", Body: "Stored comment", Likes: 3}},
+			}
+			// "*" matches the stored version, the post is missing when it's expected to fail
+			missing := test.expStatusCode == http.StatusPreconditionFailed
+			if test.ifMatch == "*" {
+				mockRepo.EXPECT().Revision(gomock.Any(), "p1000000").Return(handler.Revision{Version: 2}, !missing, nil)
+			}
+			if test.ifNoneMatch != "" && test.saveErr != nil {
+				// the conflict is with the post itself only when it exists
+				mockRepo.EXPECT().Revision(gomock.Any(), "p1000000").Return(handler.Revision{Version: 2}, missing, nil)
+			}
+			if test.expStatusCode != http.StatusBadRequest && test.expStatusCode != http.StatusPreconditionRequired && !(test.ifMatch == "*" && missing) {
+				mockRepo.EXPECT().Save(gomock.Any(), gomock.Any(), test.expPolicy, test.expVersion).Return(test.created, test.saveErr)
+			}
+			if test.expStatusCode == http.StatusOK {
+				mockRepo.EXPECT().Get(gomock.Any(), "p1000000").Return(stored, true, nil)
+			}
+
+			h := newHandler(mockRepo, nil)
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, test.target, bytes.NewReader([]byte(`{"UUID": "p1000000", "Title": "New title"}`)))
+			if test.header != "" {
+				req.Header.Set(handler.ConflictHeader, test.header)
+			}
+			if test.ifMatch != "" {
+				req.Header.Set("If-Match", test.ifMatch)
+			}
+			if test.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", test.ifNoneMatch)
+			}
+			h.SavePost(rr, req)
+
+			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+			if test.expStatusCode == http.StatusOK {
+				assert.Equal(t, "/post/p1000000", rr.Result().Header.Get("Location"))
+				actual := &entity.RedditPost{}
+				assert.Nil(t, json.NewDecoder(rr.Body).Decode(actual))
+				assert.Equal(t, stored, actual, "updated post is represented as stored")
+			}
+		})
+	}
+}
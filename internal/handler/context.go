@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+)
+
+// Route names, used as keys of Options.RouteTimeouts.
+const (
+	RouteSavePost      = "SavePost"
+	RouteGetPost       = "GetPost"
+	RouteListPosts     = "ListPosts"
+	RouteUpdatePost    = "UpdatePost"
+	RoutePatchPost     = "PatchPost"
+	RouteDeletePost    = "DeletePost"
+	RouteSaveComment   = "SaveComment"
+	RouteGetComment    = "GetComment"
+	RoutePatchComment  = "PatchComment"
+	RouteDeleteComment = "DeleteComment"
+	RouteLikePost      = "LikePost"
+	RouteUnlikePost    = "UnlikePost"
+	RouteLikeComment   = "LikeComment"
+	RouteUnlikeComment = "UnlikeComment"
+)
+
+func RouteNames() []string {
+	return []string{
+		RouteSavePost, RouteGetPost, RouteListPosts, RouteUpdatePost, RoutePatchPost, RouteDeletePost,
+		RouteSaveComment, RouteGetComment, RoutePatchComment, RouteDeleteComment,
+		RouteLikePost, RouteUnlikePost, RouteLikeComment, RouteUnlikeComment,
+	}
+}
+
+// repoContext derives the context of repository calls made by route from the request's one,
+// so they're canceled once the client goes away, and bounds it with the route's timeout.
+func (h *HttpHandler) repoContext(r *http.Request, route string) (context.Context, context.CancelFunc) {
+	timeout, ok := h.opts.RouteTimeouts[route]
+	if !ok {
+		timeout = h.opts.RepoTimeout
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
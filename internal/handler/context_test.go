@@ -0,0 +1,90 @@
+package handler_test
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/idgen"
+	"dmmak/simple-rest-crud/internal/validation"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRepoContextDerivesFromRequest(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepo := NewMockRedditPostsRepo(mockCtrl)
+	mockRepo.EXPECT().Get(gomock.Any(), "p1000000").DoAndReturn(
+		func(ctx context.Context, postID string) (*entity.RedditPost, bool, error) {
+			assert.ErrorIs(t, ctx.Err(), context.Canceled, "client disconnect must cancel repo call")
+			return nil, false, handler.ErrCanceled
+		},
+	)
+
+	h := newHandler(mockRepo, nil)
+	rr := httptest.NewRecorder()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/post/p1000000", nil).WithContext(ctx))
+
+	assertProblem(t, rr, handler.StatusClientClosedRequest, handler.CodeClientClosed)
+}
+
+func TestRepoContextRouteTimeouts(t *testing.T) {
+	tests := []struct {
+		name       string
+		request    *http.Request
+		expTimeout time.Duration
+	}{
+		{
+			name:       "route timeout",
+			request:    httptest.NewRequest(http.MethodGet, "/post/p1000000", nil),
+			expTimeout: 50 * time.Millisecond,
+		},
+		{
+			name:       "default timeout",
+			request:    withIfMatch(httptest.NewRequest(http.MethodDelete, "/post/p1000000", nil), "*"),
+			expTimeout: time.Hour,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockRedditPostsRepo(mockCtrl)
+			assertDeadline := func(ctx context.Context) {
+				deadline, ok := ctx.Deadline()
+				assert.True(t, ok)
+				assert.WithinDuration(t, time.Now().Add(test.expTimeout), deadline, time.Second)
+			}
+			mockRepo.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, postID string) (*entity.RedditPost, bool, error) {
+					assertDeadline(ctx)
+					return nil, false, nil
+				},
+			).AnyTimes()
+			mockRepo.EXPECT().Revision(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, postID string) (handler.Revision, bool, error) {
+					assertDeadline(ctx)
+					return handler.Revision{Version: 1}, true, nil
+				},
+			).AnyTimes()
+			mockRepo.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, postID string, version uint64) (bool, error) {
+					assertDeadline(ctx)
+					return true, nil
+				},
+			).AnyTimes()
+
+			ids := idgen.NewBase36()
+			opts := handler.DefaultOptions()
+			opts.RepoTimeout = time.Hour
+			opts.RouteTimeouts = map[string]time.Duration{handler.RouteGetPost: 50 * time.Millisecond}
+			h := handler.New(mockRepo, nil, ids, validation.New(validation.DefaultRules(), ids), opts, discardLogger)
+			h.Routes().ServeHTTP(httptest.NewRecorder(), test.request)
+		})
+	}
+}
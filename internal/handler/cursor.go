@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+const cursorPrefix = "after:"
+
+func encodeCursor(afterID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + afterID))
+}
+
+// decodeCursor returns the post ID the cursor points after. An empty cursor
+// addresses the first page.
+func decodeCursor(cursor string) (afterID string, err error) {
+	if cursor == "" {
+		return "", nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", fmt.Errorf("malformed cursor: %w", err)
+	}
+	if len(b) <= len(cursorPrefix) || string(b[:len(cursorPrefix)]) != cursorPrefix {
+		return "", fmt.Errorf("malformed cursor %q", cursor)
+	}
+	return string(b[len(cursorPrefix):]), nil
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/logging"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag returns the strong entity tag of a post version.
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// parseIfMatch returns versions listed by an If-Match header, wildcard is set by "*".
+// Weak and foreign tags are skipped, they never match with the strong comparison.
+func parseIfMatch(header string) (versions []uint64, wildcard bool) {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil, true
+		}
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		version, err := strconv.ParseUint(tag[1:len(tag)-1], 10, 64)
+		if err != nil || version == 0 {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	return versions, false
+}
+
+// postExists tells whether a save rejected with ErrConflict conflicted with the post itself,
+// rather than e.g. with a comment of another post. It's false when that can't be told.
+func (h *HttpHandler) postExists(ctx context.Context, postID string) bool {
+	_, found, err := h.postsRepo.Revision(ctx, postID)
+	if err != nil {
+		h.logger.WarnContext(ctx, "can't get revision of conflicting post", logging.KeyErr, err)
+	}
+	return found
+}
+
+// ifMatch returns the version of postID a conditional write is based on, zero matches any.
+// A missing If-Match header is answered with 428 when required, a header no stored
+// version can satisfy with 412. "*" and several tags are resolved against the stored post,
+// "*" matches its current version, so it fails when the post doesn't exist (RFC 9110 13.1.1).
+func (h *HttpHandler) ifMatch(ctx context.Context, w http.ResponseWriter, r *http.Request, postID string, required bool) (version uint64, ok bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if !required {
+			return 0, true
+		}
+		errMsg := fmt.Sprintf("If-Match header is required to change post uuid=%v", postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusPreconditionRequired, CodePreconditionRequired, errMsg)
+		return 0, false
+	}
+	versions, wildcard := parseIfMatch(header)
+	switch {
+	case wildcard:
+		rev, found, err := h.postsRepo.Revision(ctx, postID)
+		if err != nil {
+			h.logRepoError(r.Context(), "error while getting post revision for If-Match", err)
+			writeRepoError(w, err)
+			return 0, false
+		}
+		if found {
+			return rev.Version, true
+		}
+	case len(versions) == 1:
+		return versions[0], true
+	case len(versions) > 1:
+		stored, found, err := h.postsRepo.Get(ctx, postID)
+		if err != nil {
+			h.logRepoError(r.Context(), "error while getting post for If-Match", err)
+			writeRepoError(w, err)
+			return 0, false
+		}
+		if found {
+			for _, v := range versions {
+				if v == stored.Version {
+					return v, true
+				}
+			}
+		}
+	}
+	errMsg := fmt.Sprintf("If-Match %v doesn't match the stored post uuid=%v", header, postID)
+	h.logger.InfoContext(r.Context(), errMsg)
+	writeProblem(w, http.StatusPreconditionFailed, CodePreconditionFailed, errMsg)
+	return 0, false
+}
@@ -0,0 +1,151 @@
+package handler_test
+
+import (
+	"bytes"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func withIfMatch(r *http.Request, tags string) *http.Request {
+	r.Header.Set("If-Match", tags)
+	return r
+}
+
+func TestGetPostETag(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepo := NewMockRedditPostsRepo(mockCtrl)
+	mockRepo.EXPECT().Get(gomock.Any(), "p1000000").Return(&entity.RedditPost{UUID: "p1000000", Version: 7}, true, nil)
+
+	h := newHandler(mockRepo, nil)
+	rr := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/post/p1000000", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+	assert.Equal(t, `"7"`, rr.Result().Header.Get("ETag"))
+}
+
+func TestUpdatePostIfMatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		ifMatch       string
+		storedVersion uint64
+		expVersion    uint64
+		repoErr       error
+		expStatusCode int
+		expCode       string
+	}{
+		{
+			name:          "missing",
+			expStatusCode: http.StatusPreconditionRequired,
+			expCode:       handler.CodePreconditionRequired,
+		},
+		{
+			name:          "any version",
+			ifMatch:       "*",
+			storedVersion: 5,
+			expVersion:    5,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "any version of missing post",
+			ifMatch:       "*",
+			expStatusCode: http.StatusPreconditionFailed,
+			expCode:       handler.CodePreconditionFailed,
+		},
+		{
+			name:          "single tag",
+			ifMatch:       `"4"`,
+			expVersion:    4,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "stale tag",
+			ifMatch:       `"4"`,
+			expVersion:    4,
+			repoErr:       fmt.Errorf("can't update post: %w", handler.ErrVersionMismatch),
+			expStatusCode: http.StatusPreconditionFailed,
+			expCode:       handler.CodePreconditionFailed,
+		},
+		{
+			name:          "weak tag never matches",
+			ifMatch:       `W/"4"`,
+			expStatusCode: http.StatusPreconditionFailed,
+			expCode:       handler.CodePreconditionFailed,
+		},
+		{
+			name:          "one of several tags",
+			ifMatch:       `"3", "5"`,
+			storedVersion: 5,
+			expVersion:    5,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "none of several tags",
+			ifMatch:       `"3", "4"`,
+			storedVersion: 5,
+			expStatusCode: http.StatusPreconditionFailed,
+			expCode:       handler.CodePreconditionFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockRedditPostsRepo(mockCtrl)
+			// the stored post is got for several tags and to validate the payload
+			mockRepo.EXPECT().Get(gomock.Any(), "p1000000").Return(&entity.RedditPost{UUID: "p1000000", Version: test.storedVersion}, true, nil).AnyTimes()
+			mockRepo.EXPECT().Revision(gomock.Any(), "p1000000").Return(handler.Revision{Version: test.storedVersion}, test.storedVersion != 0, nil).AnyTimes()
+			if test.expStatusCode == http.StatusOK || test.repoErr != nil {
+				mockRepo.EXPECT().Update(gomock.Any(), gomock.Any(), test.expVersion).DoAndReturn(
+					func(_ any, post *entity.RedditPost, _ uint64) (bool, error) {
+						post.Version = 6
+						return true, test.repoErr
+					},
+				)
+			}
+
+			h := newHandler(mockRepo, nil)
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, "/post/p1000000", bytes.NewReader([]byte(`{"Title": "Fixed title"}`)))
+			if test.ifMatch != "" {
+				withIfMatch(req, test.ifMatch)
+			}
+			h.Routes().ServeHTTP(rr, req)
+
+			if test.expCode != "" {
+				assertProblem(t, rr, test.expStatusCode, test.expCode)
+				return
+			}
+			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+			assert.Equal(t, `"6"`, rr.Result().Header.Get("ETag"), "response carries the new version")
+		})
+	}
+}
+
+func TestPatchPostStaleIfMatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepo := NewMockRedditPostsRepo(mockCtrl)
+	mockRepo.EXPECT().Get(gomock.Any(), "p1000000").Return(&entity.RedditPost{UUID: "p1000000", Title: "Some title", Version: 5}, true, nil)
+
+	h := newHandler(mockRepo, nil)
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPatch, "/post/p1000000", bytes.NewReader([]byte(`{"Title": "Fixed title"}`)))
+	h.Routes().ServeHTTP(rr, withIfMatch(req, `"4"`))
+
+	assertProblem(t, rr, http.StatusPreconditionFailed, handler.CodePreconditionFailed)
+}
+
+func TestDeletePostRequiresIfMatch(t *testing.T) {
+	h := newHandler(NewMockRedditPostsRepo(gomock.NewController(t)), nil)
+	rr := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/post/p1000000", nil))
+
+	assertProblem(t, rr, http.StatusPreconditionRequired, handler.CodePreconditionRequired)
+}
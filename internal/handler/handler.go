@@ -4,123 +4,489 @@ import (
 	"bytes"
 	"context"
 	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/idgen"
+	"dmmak/simple-rest-crud/internal/logging"
+	"dmmak/simple-rest-crud/internal/validation"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
-	"regexp"
+	"net/url"
+	"strconv"
 	"time"
 )
 
 type (
 	RedditPostsRepo interface {
-		Save(ctx context.Context, post *entity.RedditPost) (err error)
+		// Save inserts the post with its comments. When the post already exists, onConflict
+		// decides whether it fails with ErrConflict or updates the stored post, created tells
+		// the two outcomes apart. Comment uuids taken by other posts are always a conflict.
+		//
+		// Save, Update and Delete take the version the change is based on, zero means any.
+		// They fail with ErrVersionMismatch when the stored post has another version, or
+		// doesn't exist while Save expects it to. Successful writes set post.Version.
+		Save(ctx context.Context, post *entity.RedditPost, onConflict ConflictPolicy, version uint64) (created bool, err error)
 		Get(ctx context.Context, postID string) (post *entity.RedditPost, found bool, err error)
-		Delete(ctx context.Context, postID string) (found bool, err error)
+		// Revision returns the version and modification time of the post without reading
+		// its comments, so conditional requests are answered cheaply.
+		Revision(ctx context.Context, postID string) (rev Revision, found bool, err error)
+		Delete(ctx context.Context, postID string, version uint64) (found bool, err error)
+		// Update replaces post's title and comment set. It never changes likes of the post
+		// or of its existing comments, those are changed with Like only.
+		Update(ctx context.Context, post *entity.RedditPost, version uint64) (found bool, err error)
+		// List returns up to limit posts ordered by UUID, starting right after afterID.
+		List(ctx context.Context, afterID string, limit int) (posts []*entity.RedditPost, err error)
+		// Like atomically adds delta to post's likes, increases its version and returns the new count.
+		// It returns ErrLikesOutOfRange if the result doesn't fit the storage.
+		Like(ctx context.Context, postID string, delta int) (likes uint32, found bool, err error)
+	}
+
+	// CommentsRepo addresses single comments of a post. All methods report found=false
+	// when either the post or the comment within that post doesn't exist.
+	// Changes of comments increase the version of their post.
+	//
+	// Save, Update and Delete take the version of the post the change is based on, zero means
+	// any, and fail with ErrVersionMismatch when the post has another version. They return
+	// the version of the post after the change.
+	CommentsRepo interface {
+		Save(ctx context.Context, postID string, comment *entity.Comment, version uint64) (postVersion uint64, found bool, err error)
+		Get(ctx context.Context, postID string, commentID string) (comment *entity.Comment, found bool, err error)
+		// Update replaces comment's body, it never changes likes.
+		Update(ctx context.Context, postID string, comment *entity.Comment, version uint64) (postVersion uint64, found bool, err error)
+		Delete(ctx context.Context, postID string, commentID string, version uint64) (postVersion uint64, found bool, err error)
+		// Like isn't conditional on the version, see RedditPostsRepo.Like.
+		Like(ctx context.Context, postID string, commentID string, delta int) (likes uint32, found bool, err error)
+	}
+
+	// Revision identifies a stored state of a post.
+	Revision struct {
+		Version   uint64
+		UpdatedAt time.Time
 	}
 
 	HttpHandler struct {
-		postsRepo RedditPostsRepo
+		postsRepo    RedditPostsRepo
+		commentsRepo CommentsRepo
+		ids          idgen.Generator
+		validator    *validation.Validator
+		opts         Options
+		logger       *slog.Logger
+	}
+
+	// Options tune HttpHandler, see DefaultOptions.
+	Options struct {
+		// RepoTimeout bounds repository calls made while handling a request
+		// of a route missing from RouteTimeouts.
+		RepoTimeout   time.Duration
+		RouteTimeouts map[string]time.Duration
+		// Likes and Comments enable like/unlike and comments sub-resource endpoints,
+		// those respond with 404 when disabled.
+		Likes    bool
+		Comments bool
+		// CacheControl sets the Cache-Control header of responses of routes named by CacheableRoutes.
+		CacheControl map[string]string
+	}
+
+	PostsPage struct {
+		Posts []*entity.RedditPost
+		Next  string `json:",omitempty"`
+	}
+
+	LikesCount struct {
+		Likes uint32
 	}
 )
 
-func New(postsRepo RedditPostsRepo) *HttpHandler {
-	return &HttpHandler{postsRepo: postsRepo}
+var ErrLikesOutOfRange = errors.New("likes count out of range")
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+func DefaultOptions() Options {
+	return Options{
+		RepoTimeout: 5 * time.Second,
+		Likes:       true,
+		Comments:    true,
+		// caches may keep posts, but must revalidate them with a cheap conditional request
+		CacheControl: map[string]string{
+			RouteGetPost:   "no-cache",
+			RouteListPosts: "no-cache",
+		},
+	}
 }
 
+// New returns a handler logging to logger, records logged while serving a request
+// carry the fields of Routes.
+func New(postsRepo RedditPostsRepo, commentsRepo CommentsRepo, ids idgen.Generator, validator *validation.Validator, opts Options, logger *slog.Logger) *HttpHandler {
+	return &HttpHandler{postsRepo: postsRepo, commentsRepo: commentsRepo, ids: ids, validator: validator, opts: opts, logger: logger}
+}
+
+// SavePost creates a post, or updates an existing one as told by the conflict policy
+// and responds with its stored representation. Policies that may update a post require
+// If-Match, If-None-Match: * restricts the save to creating one.
 func (h *HttpHandler) SavePost(w http.ResponseWriter, r *http.Request) {
-	redditPost := &entity.RedditPost{}
-	if err := json.NewDecoder(r.Body).Decode(redditPost); err != nil {
-		log.Printf("can't decode save post request body: %s\n", err)
-		http.Error(w, "Something gone wrong", http.StatusInternalServerError)
+	onConflict, err := conflictPolicy(r)
+	if err != nil {
+		h.logger.InfoContext(r.Context(), "can't parse conflict policy", logging.KeyErr, err)
+		writeProblem(w, http.StatusBadRequest, CodeInvalidQuery, err.Error())
 		return
 	}
+	createOnly := r.Header.Get("If-None-Match") == "*"
+	if createOnly && onConflict != ConflictReject {
+		errMsg := fmt.Sprintf("If-None-Match: * can't be combined with %v conflict policy", onConflict)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusBadRequest, CodeInvalidQuery, errMsg)
+		return
+	}
+	redditPost, err := h.validator.DecodePost(r.Body)
+	if err != nil {
+		h.logger.InfoContext(r.Context(), "can't decode save post request body", logging.KeyErr, err)
+		writeInvalidPayload(w, err)
+		return
+	}
+	resetLikes(redditPost, nil)
+	h.assignIDs(redditPost)
+	// the path has no post ID to log, it's known only now
+	r = r.WithContext(logging.With(r.Context(), slog.String(logging.KeyPostID, redditPost.UUID)))
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := h.repoContext(r, RouteSavePost)
 	defer cancel()
-	if err := h.postsRepo.Save(ctx, redditPost); err != nil {
-		log.Printf("error while saving post: %s\n", err)
-		http.Error(w, "Something gone wrong", http.StatusInternalServerError)
+	version, ok := h.ifMatch(ctx, w, r, redditPost.UUID, onConflict != ConflictReject)
+	if !ok {
+		return
+	}
+	created, err := h.postsRepo.Save(ctx, redditPost, onConflict, version)
+	if createOnly && errors.Is(err, ErrConflict) && h.postExists(ctx, redditPost.UUID) {
+		errMsg := fmt.Sprintf("If-None-Match: * doesn't match, post uuid=%v exists", redditPost.UUID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusPreconditionFailed, CodePreconditionFailed, errMsg)
+		return
+	}
+	if err != nil {
+		h.logRepoError(r.Context(), "error while saving post", err)
+		writeRepoError(w, err)
+		return
+	}
+	if created {
+		w.Header().Set("ETag", etag(redditPost.Version))
+		h.writeCreated(w, r, "/post/"+redditPost.UUID, redditPost)
+		return
+	}
+
+	// merged posts keep stored likes and comments, so the payload isn't their representation
+	stored, found, err := h.postsRepo.Get(ctx, redditPost.UUID)
+	if err != nil {
+		h.logRepoError(r.Context(), "error while getting saved post", err)
+		writeRepoError(w, err)
+		return
+	}
+	if !found {
+		errMsg := fmt.Sprintf("post uuid=%v was deleted right after saving", redditPost.UUID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusNotFound, CodeNotFound, errMsg)
 		return
 	}
+	b := new(bytes.Buffer)
+	err = json.NewEncoder(b).Encode(stored)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "can't encode save post response body", logging.KeyErr, err)
+		writeProblem(w, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	w.Header().Set("Location", "/post/"+redditPost.UUID)
+	w.Header().Set("ETag", etag(stored.Version))
 	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(b.Bytes())
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "can't write save post response body", logging.KeyErr, err)
+	}
 }
 
+// GetPost answers conditional requests the client's copy still satisfies with 304,
+// checking them against the post's revision without reading its comments.
 func (h *HttpHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 	redditPost := &entity.RedditPost{}
 
-	re := regexp.MustCompile(`[a-z0-9]{8}`)
-	postID := re.FindString(r.URL.Path)
+	postID := postIDParam.Value(r)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := h.repoContext(r, RouteGetPost)
 	defer cancel()
+	if isConditional(r) {
+		rev, found, err := h.postsRepo.Revision(ctx, postID)
+		if err != nil {
+			h.logRepoError(r.Context(), "error while getting post revision", err)
+			writeRepoError(w, err)
+			return
+		}
+		if found && notModified(r, etag(rev.Version), rev.UpdatedAt) {
+			h.writeNotModified(w, RouteGetPost, etag(rev.Version), rev.UpdatedAt)
+			return
+		}
+	}
 	redditPost, found, err := h.postsRepo.Get(ctx, postID)
 	if err != nil {
-		log.Printf("error while getting post: %s\n", err)
-		http.Error(w, "Something gone wrong", http.StatusInternalServerError)
+		h.logRepoError(r.Context(), "error while getting post", err)
+		writeRepoError(w, err)
 		return
 	}
 	if !found {
-		errMsg := fmt.Sprintf("can't find post with uuid=%v\n", postID)
-		log.Println(errMsg)
-		http.Error(w, errMsg, http.StatusNotFound)
+		errMsg := fmt.Sprintf("can't find post with uuid=%v", postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusNotFound, CodeNotFound, errMsg)
+		return
 	}
 	b := new(bytes.Buffer)
 	err = json.NewEncoder(b).Encode(redditPost)
 	if err != nil {
-		log.Printf("can't encode get post response body: %s\n", err)
-		http.Error(w, "Something gone wrong", http.StatusInternalServerError)
+		h.logger.ErrorContext(r.Context(), "can't encode get post response body", logging.KeyErr, err)
+		writeProblem(w, http.StatusInternalServerError, CodeInternal, "")
 		return
 	}
+	h.setValidators(w, RouteGetPost, etag(redditPost.Version), redditPost.UpdatedAt)
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(b.Bytes())
 	if err != nil {
-		log.Printf("can't write get post response body: %s\n", err)
-		http.Error(w, "Something gone wrong", http.StatusInternalServerError)
+		h.logger.WarnContext(r.Context(), "can't write get post response body", logging.KeyErr, err)
+	}
+}
+
+// ListPosts returns a page of posts. The page is addressed by an opaque cursor
+// taken from the Next link of the previous page.
+func (h *HttpHandler) ListPosts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := defaultPageLimit
+	if l := query.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			errMsg := fmt.Sprintf("limit must be an integer between 1 and %v", maxPageLimit)
+			h.logger.InfoContext(r.Context(), errMsg)
+			writeProblem(w, http.StatusBadRequest, CodeInvalidQuery, errMsg)
+			return
+		}
+	}
+	afterID, err := decodeCursor(query.Get("cursor"))
+	if err != nil {
+		h.logger.InfoContext(r.Context(), "can't decode list posts cursor", logging.KeyErr, err)
+		writeProblem(w, http.StatusBadRequest, CodeInvalidQuery, "cursor is malformed")
+		return
+	}
+
+	ctx, cancel := h.repoContext(r, RouteListPosts)
+	defer cancel()
+	posts, err := h.postsRepo.List(ctx, afterID, limit+1)
+	if err != nil {
+		h.logRepoError(r.Context(), "error while listing posts", err)
+		writeRepoError(w, err)
+		return
+	}
+
+	page := &PostsPage{Posts: posts}
+	if len(posts) > limit {
+		page.Posts = posts[:limit]
+		next := url.Values{}
+		next.Set("limit", strconv.Itoa(limit))
+		next.Set("cursor", encodeCursor(page.Posts[limit-1].UUID))
+		page.Next = r.URL.Path + "?" + next.Encode()
+	}
+
+	b := new(bytes.Buffer)
+	err = json.NewEncoder(b).Encode(page)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "can't encode list posts response body", logging.KeyErr, err)
+		writeProblem(w, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	// pages have no revision of their own, deleting a post changes the page but no UpdatedAt of it
+	tag := bodyETag(b.Bytes())
+	if notModified(r, tag, time.Time{}) {
+		h.writeNotModified(w, RouteListPosts, tag, time.Time{})
+		return
+	}
+	h.setValidators(w, RouteListPosts, tag, time.Time{})
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(b.Bytes())
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "can't write list posts response body", logging.KeyErr, err)
 	}
 }
 
 func (h *HttpHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
-	re := regexp.MustCompile(`[a-z0-9]{8}`)
-	postID := re.FindString(r.URL.Path)
+	postID := postIDParam.Value(r)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := h.repoContext(r, RouteDeletePost)
 	defer cancel()
-	found, err := h.postsRepo.Delete(ctx, postID)
+	version, ok := h.ifMatch(ctx, w, r, postID, true)
+	if !ok {
+		return
+	}
+	found, err := h.postsRepo.Delete(ctx, postID, version)
 	if err != nil {
-		log.Printf("error while deleting post: %s\n", err)
-		http.Error(w, "Something gone wrong", http.StatusInternalServerError)
+		h.logRepoError(r.Context(), "error while deleting post", err)
+		writeRepoError(w, err)
 		return
 	}
 	if !found {
-		errMsg := fmt.Sprintf("can't find post with uuid=%v\n", postID)
-		log.Println(errMsg)
-		http.Error(w, errMsg, http.StatusNotFound)
+		errMsg := fmt.Sprintf("can't find post with uuid=%v", postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusNotFound, CodeNotFound, errMsg)
+		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
-func (h *HttpHandler) NotAllowed(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "Something gone wrong", http.StatusMethodNotAllowed)
+// UpdatePost replaces the stored post. It's validated against the stored post, so IDs it
+// resends are accepted after a change of the ID format, as they are by PatchPost.
+func (h *HttpHandler) UpdatePost(w http.ResponseWriter, r *http.Request) {
+	postID := postIDParam.Value(r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.logger.InfoContext(r.Context(), "can't read update post request body", logging.KeyErr, err)
+		writeProblem(w, http.StatusBadRequest, CodeMalformedBody, err.Error())
+		return
+	}
+
+	ctx, cancel := h.repoContext(r, RouteUpdatePost)
+	defer cancel()
+	version, ok := h.ifMatch(ctx, w, r, postID, true)
+	if !ok {
+		return
+	}
+	storedPost, found, err := h.postsRepo.Get(ctx, postID)
+	if err != nil {
+		h.logRepoError(r.Context(), "error while getting post for update", err)
+		writeRepoError(w, err)
+		return
+	}
+	if !found {
+		errMsg := fmt.Sprintf("can't find post with uuid=%v", postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusNotFound, CodeNotFound, errMsg)
+		return
+	}
+	redditPost, err := h.validator.Stored(storedIDs(storedPost)...).DecodePost(bytes.NewReader(body))
+	if err != nil {
+		h.logger.InfoContext(r.Context(), "can't decode update post request body", logging.KeyErr, err)
+		writeInvalidPayload(w, err)
+		return
+	}
+	if redditPost.UUID == "" {
+		redditPost.UUID = postID
+	}
+	if redditPost.UUID != postID {
+		errMsg := fmt.Sprintf("post uuid=%v doesn't match uuid=%v from path", redditPost.UUID, postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusBadRequest, CodeInvalidID, errMsg)
+		return
+	}
+	resetLikes(redditPost, nil)
+	h.assignIDs(redditPost)
+
+	found, err = h.postsRepo.Update(ctx, redditPost, version)
+	if err != nil {
+		h.logRepoError(r.Context(), "error while updating post", err)
+		writeRepoError(w, err)
+		return
+	}
+	if !found {
+		errMsg := fmt.Sprintf("can't find post with uuid=%v", postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusNotFound, CodeNotFound, errMsg)
+		return
+	}
+	w.Header().Set("ETag", etag(redditPost.Version))
+	w.WriteHeader(http.StatusOK)
 }
 
-func (h *HttpHandler) Route(allowedMethods ...string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		var actualMethod string
-		for _, method := range allowedMethods {
-			if r.Method == method {
-				actualMethod = r.Method
-			}
-		}
-		switch actualMethod {
-		case http.MethodPost:
-			h.SavePost(w, r)
-		case http.MethodGet:
-			h.GetPost(w, r)
-		case http.MethodDelete:
-			h.DeletePost(w, r)
-		default:
-			h.NotAllowed(w, r)
-		}
+// PatchPost applies a JSON Merge Patch (RFC 7386) to the stored post.
+// Arrays are replaced as a whole, so patching Comments replaces the comment set.
+// Like other writes of a post, it requires If-Match with the version it's based on.
+func (h *HttpHandler) PatchPost(w http.ResponseWriter, r *http.Request) {
+	postID := postIDParam.Value(r)
+
+	var patch any
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		h.logger.InfoContext(r.Context(), "can't decode patch post request body", logging.KeyErr, err)
+		writeProblem(w, http.StatusBadRequest, CodeMalformedBody, err.Error())
+		return
+	}
+
+	ctx, cancel := h.repoContext(r, RoutePatchPost)
+	defer cancel()
+	version, ok := h.ifMatch(ctx, w, r, postID, true)
+	if !ok {
+		return
+	}
+	redditPost, found, err := h.postsRepo.Get(ctx, postID)
+	if err != nil {
+		h.logRepoError(r.Context(), "error while getting post for patch", err)
+		writeRepoError(w, err)
+		return
+	}
+	if !found {
+		errMsg := fmt.Sprintf("can't find post with uuid=%v", postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusNotFound, CodeNotFound, errMsg)
+		return
+	}
+	if version != 0 && redditPost.Version != version {
+		h.logger.InfoContext(r.Context(), "can't patch post", logging.KeyErr, ErrVersionMismatch)
+		writeRepoError(w, ErrVersionMismatch)
+		return
+	}
+
+	storedPost := redditPost
+	patched, err := applyMergePatch(storedPost, patch)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "can't apply patch to post", logging.KeyErr, err)
+		writeProblem(w, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	redditPost, err = h.validator.Stored(storedIDs(storedPost)...).DecodePost(bytes.NewReader(patched))
+	if err != nil {
+		h.logger.InfoContext(r.Context(), "invalid patched post", logging.KeyErr, err)
+		writeInvalidPayload(w, err)
+		return
+	}
+	if redditPost.UUID != postID {
+		errMsg := fmt.Sprintf("post uuid=%v can't be changed by patch", postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusBadRequest, CodeInvalidID, errMsg)
+		return
+	}
+	resetLikes(redditPost, storedPost)
+	h.assignIDs(redditPost)
+
+	// the patch is based on the fetched post, so it must not overwrite a newer one
+	found, err = h.postsRepo.Update(ctx, redditPost, storedPost.Version)
+	if err != nil {
+		h.logRepoError(r.Context(), "error while updating post", err)
+		writeRepoError(w, err)
+		return
+	}
+	if !found {
+		errMsg := fmt.Sprintf("can't find post with uuid=%v", postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusNotFound, CodeNotFound, errMsg)
+		return
+	}
+
+	b := new(bytes.Buffer)
+	err = json.NewEncoder(b).Encode(redditPost)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "can't encode patch post response body", logging.KeyErr, err)
+		writeProblem(w, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	w.Header().Set("ETag", etag(redditPost.Version))
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(b.Bytes())
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "can't write patch post response body", logging.KeyErr, err)
 	}
 }
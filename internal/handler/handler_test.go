@@ -5,18 +5,35 @@ import (
 	"context"
 	"dmmak/simple-rest-crud/internal/entity"
 	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/idgen"
+	"dmmak/simple-rest-crud/internal/logging"
+	"dmmak/simple-rest-crud/internal/middleware"
+	"dmmak/simple-rest-crud/internal/validation"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 )
 
+// discardLogger drops records of handlers whose logging isn't tested.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func newHandler(postsRepo handler.RedditPostsRepo, commentsRepo handler.CommentsRepo) *handler.HttpHandler {
+	ids := idgen.NewBase36()
+	return handler.New(postsRepo, commentsRepo, ids, validation.New(validation.DefaultRules(), ids), handler.DefaultOptions(), discardLogger)
+}
+
 func TestSavePost(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -24,7 +41,7 @@ func TestSavePost(t *testing.T) {
 	}{
 		{
 			name:          "success",
-			expStatusCode: http.StatusOK,
+			expStatusCode: http.StatusCreated,
 		},
 		{
 			name:          "error",
@@ -51,41 +68,123 @@ func TestSavePost(t *testing.T) {
 					},
 				},
 			}
+			// likes are server-managed, so the ones sent by the client are dropped
+			savedEntity := &entity.RedditPost{
+				UUID:  "p1000000",
+				Title: "Some title",
+				Comments: []*entity.Comment{
+					{
+						UUID: "c0000001",
+						Body: "Some comment text 1",
+					},
+					{
+						UUID: "c0000002",
+						Body: "Some comment text 2",
+					},
+				},
+			}
 			mockCtrl := gomock.NewController(t)
 			mockRepo := NewMockRedditPostsRepo(mockCtrl)
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 			defer cancel()
-			mockRecorder := mockRepo.EXPECT().Save(gomock.AssignableToTypeOf(ctx), gomock.Eq(requestEntity))
+			mockRecorder := mockRepo.EXPECT().Save(gomock.AssignableToTypeOf(ctx), gomock.Eq(savedEntity), gomock.Eq(handler.ConflictReject), gomock.Eq(uint64(0)))
 
 			switch test.name {
 			case "success":
 				mockRecorder.DoAndReturn(
-					func(context.Context, *entity.RedditPost) error {
-						return nil
+					func(context.Context, *entity.RedditPost, handler.ConflictPolicy, uint64) (bool, error) {
+						return true, nil
 					},
 				)
 			case "error":
 				mockRecorder.DoAndReturn(
-					func(context.Context, *entity.RedditPost) error {
-						return fmt.Errorf("some repo internal error")
+					func(context.Context, *entity.RedditPost, handler.ConflictPolicy, uint64) (bool, error) {
+						return false, fmt.Errorf("some repo internal error")
 					},
 				)
 			}
 
-			h := handler.New(mockRepo)
+			h := newHandler(mockRepo, nil)
 			rr := httptest.NewRecorder()
 			reqBody := new(bytes.Buffer)
 			err := json.NewEncoder(reqBody).Encode(requestEntity)
 			if err != nil {
 				log.Fatal(err)
 			}
-			req, err := http.NewRequest(http.MethodGet, "/posts/", reqBody)
+			req, err := http.NewRequest(http.MethodGet, "/post/", reqBody)
 			if err != nil {
 				log.Fatal(err)
 			}
 			h.SavePost(rr, req)
 
 			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+			if test.expStatusCode == http.StatusCreated {
+				assert.Equal(t, "/post/p1000000", rr.Result().Header.Get("Location"))
+			}
+		})
+	}
+}
+
+func TestSavePostIDs(t *testing.T) {
+	tests := []struct {
+		name          string
+		requestBody   string
+		expStatusCode int
+	}{
+		{
+			name:          "generated ids",
+			requestBody:   `{"Title": "Some title", "Comments": [{"Body": "Some comment text"}]}`,
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name:          "invalid post id",
+			requestBody:   `{"UUID": "P-1", "Title": "Some title"}`,
+			expStatusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "invalid comment id",
+			requestBody:   `{"UUID": "p1000000", "Title": "Some title", "Comments": [{"UUID": "c1", "Body": "Some comment text"}]}`,
+			expStatusCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockRedditPostsRepo(mockCtrl)
+			ids := idgen.NewBase36()
+
+			var savedPost *entity.RedditPost
+			if test.expStatusCode == http.StatusCreated {
+				mockRepo.EXPECT().Save(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, post *entity.RedditPost, _ handler.ConflictPolicy, _ uint64) (bool, error) {
+						savedPost = post
+						return true, nil
+					},
+				)
+			}
+
+			h := newHandler(mockRepo, nil)
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/post", bytes.NewReader([]byte(test.requestBody)))
+			if err != nil {
+				log.Fatal(err)
+			}
+			h.SavePost(rr, req)
+
+			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+			if savedPost != nil {
+				assert.True(t, ids.Valid(savedPost.UUID))
+				assert.True(t, ids.Valid(savedPost.Comments[0].UUID))
+				assert.Equal(t, "/post/"+savedPost.UUID, rr.Result().Header.Get("Location"))
+
+				actualPost := &entity.RedditPost{}
+				err = json.NewDecoder(rr.Body).Decode(actualPost)
+				if err != nil {
+					t.Fatalf("can't decode response body: %s", err)
+				}
+				assert.Equal(t, savedPost, actualPost)
+			}
 		})
 	}
 }
@@ -160,15 +259,109 @@ func TestGetPost(t *testing.T) {
 				)
 			}
 
-			h := handler.New(mockRepo)
+			h := newHandler(mockRepo, nil)
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/post/"+test.postID, nil)
+			if err != nil {
+				log.Fatal(err)
+			}
+			h.Routes().ServeHTTP(rr, req)
+
+			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+		})
+	}
+}
+
+func TestListPosts(t *testing.T) {
+	posts := []*entity.RedditPost{
+		{UUID: "p1000000", Title: "Title 1", Comments: []*entity.Comment{}},
+		{UUID: "p1000001", Title: "Title 2", Comments: []*entity.Comment{}},
+		{UUID: "p1000002", Title: "Title 3", Comments: []*entity.Comment{}},
+	}
+	tests := []struct {
+		name          string
+		query         string
+		expAfterID    string
+		expLimit      int
+		repoPosts     []*entity.RedditPost
+		expPage       *handler.PostsPage
+		expStatusCode int
+	}{
+		{
+			name:          "first page with next",
+			query:         "?limit=2",
+			expAfterID:    "",
+			expLimit:      3,
+			repoPosts:     posts,
+			expPage:       &handler.PostsPage{Posts: posts[:2], Next: "/post?cursor=YWZ0ZXI6cDEwMDAwMDE&limit=2"},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "last page",
+			query:         "?limit=2&cursor=YWZ0ZXI6cDEwMDAwMDE",
+			expAfterID:    "p1000001",
+			expLimit:      3,
+			repoPosts:     posts[2:],
+			expPage:       &handler.PostsPage{Posts: posts[2:]},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "default limit",
+			query:         "",
+			expAfterID:    "",
+			expLimit:      21,
+			repoPosts:     posts,
+			expPage:       &handler.PostsPage{Posts: posts},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "invalid limit",
+			query:         "?limit=0",
+			expStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:          "invalid cursor",
+			query:         "?cursor=p1000001",
+			expStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:          "error",
+			query:         "",
+			expAfterID:    "",
+			expLimit:      21,
+			expStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockRedditPostsRepo(mockCtrl)
+
+			switch test.expStatusCode {
+			case http.StatusOK:
+				mockRepo.EXPECT().List(gomock.Any(), gomock.Eq(test.expAfterID), gomock.Eq(test.expLimit)).Return(test.repoPosts, nil)
+			case http.StatusInternalServerError:
+				mockRepo.EXPECT().List(gomock.Any(), gomock.Eq(test.expAfterID), gomock.Eq(test.expLimit)).Return(nil, fmt.Errorf("some repo internal error"))
+			}
+
+			h := newHandler(mockRepo, nil)
 			rr := httptest.NewRecorder()
-			req, err := http.NewRequest(http.MethodGet, "/posts/"+test.postID, nil)
+			req, err := http.NewRequest(http.MethodGet, "/post"+test.query, nil)
 			if err != nil {
 				log.Fatal(err)
 			}
-			h.GetPost(rr, req)
+			h.ListPosts(rr, req)
 
 			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+			if test.expPage != nil {
+				actualPage := &handler.PostsPage{}
+				err = json.NewDecoder(rr.Body).Decode(actualPage)
+				if err != nil {
+					t.Fatalf("can't decode response body: %s", err)
+				}
+				assert.Equal(t, test.expPage, actualPage)
+			}
 		})
 	}
 }
@@ -202,73 +395,291 @@ func TestDeletePost(t *testing.T) {
 			mockRepo := NewMockRedditPostsRepo(mockCtrl)
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 			defer cancel()
-			mockRecorder := mockRepo.EXPECT().Delete(gomock.AssignableToTypeOf(ctx), gomock.Eq(test.postID))
+			mockRecorder := mockRepo.EXPECT().Delete(gomock.AssignableToTypeOf(ctx), gomock.Eq(test.postID), gomock.Eq(uint64(3)))
 
 			switch test.name {
 			case "success":
 				mockRecorder.DoAndReturn(
-					func(context.Context, string) (bool, error) {
+					func(context.Context, string, uint64) (bool, error) {
 						return true, nil
 					},
 				)
 			case "not found":
 				mockRecorder.DoAndReturn(
-					func(context.Context, string) (bool, error) {
+					func(context.Context, string, uint64) (bool, error) {
 						return false, nil
 					},
 				)
 			case "error":
 				mockRecorder.DoAndReturn(
-					func(context.Context, string) (bool, error) {
+					func(context.Context, string, uint64) (bool, error) {
 						return false, fmt.Errorf("some repo internal error")
 					},
 				)
 			}
 
-			h := handler.New(mockRepo)
+			h := newHandler(mockRepo, nil)
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodDelete, "/post/"+test.postID, nil)
+			if err != nil {
+				log.Fatal(err)
+			}
+			req.Header.Set("If-Match", `"3"`)
+			h.Routes().ServeHTTP(rr, req)
+
+			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+		})
+	}
+
+}
+
+func TestUpdatePost(t *testing.T) {
+	tests := []struct {
+		name          string
+		postID        string
+		requestEntity *entity.RedditPost
+		expStatusCode int
+	}{
+		{
+			name:          "success",
+			postID:        "p1000000",
+			requestEntity: &entity.RedditPost{UUID: "p1000000", Title: "Fixed title"},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "not found",
+			postID:        "p1000001",
+			requestEntity: &entity.RedditPost{UUID: "p1000001", Title: "Fixed title"},
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "deleted meanwhile",
+			postID:        "p1000001",
+			requestEntity: &entity.RedditPost{UUID: "p1000001", Title: "Fixed title"},
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "error",
+			postID:        "p1000002",
+			requestEntity: &entity.RedditPost{UUID: "p1000002", Title: "Fixed title"},
+			expStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:          "uuid mismatch",
+			postID:        "p1000003",
+			requestEntity: &entity.RedditPost{UUID: "p9999999", Title: "Fixed title"},
+			expStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockRedditPostsRepo(mockCtrl)
+
+			stored := &entity.RedditPost{UUID: test.postID, Title: "Some title", Version: 3}
+			switch test.name {
+			case "success":
+				mockRepo.EXPECT().Get(gomock.Any(), test.postID).Return(stored, true, nil)
+				mockRepo.EXPECT().Update(gomock.Any(), gomock.Eq(test.requestEntity), gomock.Eq(uint64(3))).Return(true, nil)
+			case "not found":
+				mockRepo.EXPECT().Get(gomock.Any(), test.postID).Return(&entity.RedditPost{}, false, nil)
+			case "deleted meanwhile":
+				mockRepo.EXPECT().Get(gomock.Any(), test.postID).Return(stored, true, nil)
+				mockRepo.EXPECT().Update(gomock.Any(), gomock.Eq(test.requestEntity), gomock.Eq(uint64(3))).Return(false, nil)
+			case "uuid mismatch":
+				mockRepo.EXPECT().Get(gomock.Any(), test.postID).Return(stored, true, nil)
+			case "error":
+				mockRepo.EXPECT().Get(gomock.Any(), test.postID).Return(stored, true, nil)
+				mockRepo.EXPECT().Update(gomock.Any(), gomock.Eq(test.requestEntity), gomock.Eq(uint64(3))).Return(false, fmt.Errorf("some repo internal error"))
+			}
+
+			h := newHandler(mockRepo, nil)
 			rr := httptest.NewRecorder()
-			req, err := http.NewRequest(http.MethodGet, "/posts/"+test.postID, nil)
+			reqBody := new(bytes.Buffer)
+			err := json.NewEncoder(reqBody).Encode(test.requestEntity)
+			if err != nil {
+				log.Fatal(err)
+			}
+			req, err := http.NewRequest(http.MethodPut, "/post/"+test.postID, reqBody)
 			if err != nil {
 				log.Fatal(err)
 			}
-			h.DeletePost(rr, req)
+			req.Header.Set("If-Match", `"3"`)
+			h.Routes().ServeHTTP(rr, req)
 
 			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
 		})
 	}
+}
 
+func TestPatchPost(t *testing.T) {
+	storedPost := func() *entity.RedditPost {
+		return &entity.RedditPost{
+			UUID:    "p1000000",
+			Title:   "Some title",
+			Likes:   5,
+			Version: 3,
+			Comments: []*entity.Comment{
+				{
+					UUID:  "c0000001",
+					Body:  "Some comment text 1",
+					Likes: 1,
+				},
+			},
+		}
+	}
+	tests := []struct {
+		name          string
+		patch         string
+		expPost       *entity.RedditPost
+		expStatusCode int
+	}{
+		{
+			name:  "success title",
+			patch: `{"Title": "Fixed title"}`,
+			expPost: &entity.RedditPost{
+				UUID:     "p1000000",
+				Title:    "Fixed title",
+				Likes:    5,
+				Version:  3,
+				Comments: storedPost().Comments,
+			},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:  "success remove comments",
+			patch: `{"Comments": null}`,
+			expPost: &entity.RedditPost{
+				UUID:    "p1000000",
+				Title:   "Some title",
+				Likes:   5,
+				Version: 3,
+			},
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "not found",
+			patch:         `{"Title": "Fixed title"}`,
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "uuid change",
+			patch:         `{"UUID": "p9999999"}`,
+			expStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:          "malformed patch",
+			patch:         `{"Title": `,
+			expStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockRedditPostsRepo(mockCtrl)
+
+			switch test.name {
+			case "success title", "success remove comments":
+				mockRepo.EXPECT().Get(gomock.Any(), gomock.Eq("p1000000")).Return(storedPost(), true, nil)
+				mockRepo.EXPECT().Update(gomock.Any(), gomock.Eq(test.expPost), gomock.Eq(uint64(3))).Return(true, nil)
+			case "not found":
+				mockRepo.EXPECT().Get(gomock.Any(), gomock.Eq("p1000000")).Return(nil, false, nil)
+			case "uuid change":
+				mockRepo.EXPECT().Get(gomock.Any(), gomock.Eq("p1000000")).Return(storedPost(), true, nil)
+			}
+
+			h := newHandler(mockRepo, nil)
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPatch, "/post/p1000000", bytes.NewReader([]byte(test.patch)))
+			if err != nil {
+				log.Fatal(err)
+			}
+			req.Header.Set("If-Match", `"3"`)
+			h.Routes().ServeHTTP(rr, req)
+
+			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+			if test.expPost != nil {
+				actualPost := &entity.RedditPost{}
+				err = json.NewDecoder(rr.Body).Decode(actualPost)
+				if err != nil {
+					t.Fatalf("can't decode response body: %s", err)
+				}
+				assert.Equal(t, test.expPost, actualPost)
+			}
+		})
+	}
 }
 
 func TestHandlerRoute(t *testing.T) {
 	tests := []struct {
-		name           string
-		allowedMethods []string
-		request        *http.Request
-		expStatusCode  int
+		name          string
+		request       *http.Request
+		expStatusCode int
+		expAllow      string
 	}{
 		{
-			name:           "success GET",
-			allowedMethods: []string{http.MethodGet, http.MethodDelete},
-			request:        httptest.NewRequest(http.MethodGet, "/post", nil),
-			expStatusCode:  http.StatusOK,
+			name:          "success GET",
+			request:       httptest.NewRequest(http.MethodGet, "/post/p1000000", nil),
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "success GET list",
+			request:       httptest.NewRequest(http.MethodGet, "/post", nil),
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "success HEAD",
+			request:       httptest.NewRequest(http.MethodHead, "/post/p1000000", nil),
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "success DELETE",
+			request:       withIfMatch(httptest.NewRequest(http.MethodDelete, "/post/p1000000", nil), "*"),
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "success POST",
+			request:       httptest.NewRequest(http.MethodPost, "/post", bytes.NewReader([]byte(`{"Title": "Some title"}`))),
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name:          "success PUT",
+			request:       withIfMatch(httptest.NewRequest(http.MethodPut, "/post/p1000000", bytes.NewReader([]byte(`{"Title": "Some title"}`))), "*"),
+			expStatusCode: http.StatusOK,
 		},
 		{
-			name:           "success DELETE",
-			allowedMethods: []string{http.MethodPatch, http.MethodDelete},
-			request:        httptest.NewRequest(http.MethodDelete, "/post", nil),
-			expStatusCode:  http.StatusOK,
+			name:          "success PATCH",
+			request:       withIfMatch(httptest.NewRequest(http.MethodPatch, "/post/p1000000", bytes.NewReader([]byte("{}"))), "*"),
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "not allowed POST",
+			request:       httptest.NewRequest(http.MethodPost, "/post/p1000000", bytes.NewReader([]byte("{}"))),
+			expStatusCode: http.StatusMethodNotAllowed,
+			expAllow:      "DELETE, GET, HEAD, PATCH, PUT",
+		},
+		{
+			name:          "not allowed DELETE of collection",
+			request:       withIfMatch(httptest.NewRequest(http.MethodDelete, "/post", nil), "*"),
+			expStatusCode: http.StatusMethodNotAllowed,
+			expAllow:      "GET, HEAD, POST",
+		},
+		{
+			name:          "unknown path",
+			request:       httptest.NewRequest(http.MethodGet, "/posts", nil),
+			expStatusCode: http.StatusNotFound,
 		},
 		{
-			name:           "success POST",
-			allowedMethods: []string{http.MethodPost},
-			request:        httptest.NewRequest(http.MethodPost, "/post", bytes.NewReader([]byte("{}"))),
-			expStatusCode:  http.StatusOK,
+			name:          "invalid id",
+			request:       httptest.NewRequest(http.MethodGet, "/post/xyz", nil),
+			expStatusCode: http.StatusNotFound,
 		},
 		{
-			name:           "not allowed POST",
-			allowedMethods: []string{http.MethodGet, http.MethodDelete},
-			request:        httptest.NewRequest(http.MethodPost, "/post", bytes.NewReader([]byte("{}"))),
-			expStatusCode:  http.StatusMethodNotAllowed,
+			name:          "extra segments",
+			request:       httptest.NewRequest(http.MethodGet, "/post/xyz/abcdefgh123", nil),
+			expStatusCode: http.StatusNotFound,
 		},
 	}
 	for _, test := range tests {
@@ -276,21 +687,179 @@ func TestHandlerRoute(t *testing.T) {
 			mockCtrl := gomock.NewController(t)
 			mockRepo := NewMockRedditPostsRepo(mockCtrl)
 
+			// If-Match: * is resolved to the stored version
+			mockRepo.EXPECT().Revision(gomock.Any(), "p1000000").Return(handler.Revision{Version: 1}, true, nil).AnyTimes()
 			switch test.name {
-			case "success GET":
-				mockRepo.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, true, nil)
+			case "success GET", "success HEAD":
+				mockRepo.EXPECT().Get(gomock.Any(), gomock.Any()).Return(&entity.RedditPost{UUID: "p1000000"}, true, nil)
+			case "success GET list":
+				mockRepo.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil)
 			case "success DELETE":
-				mockRepo.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(true, nil)
+				mockRepo.EXPECT().Delete(gomock.Any(), gomock.Eq("p1000000"), gomock.Any()).Return(true, nil)
 			case "success POST":
-				mockRepo.EXPECT().Save(gomock.Any(), gomock.Any()).Return(nil)
+				mockRepo.EXPECT().Save(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil)
+			case "success PUT":
+				mockRepo.EXPECT().Get(gomock.Any(), gomock.Any()).Return(&entity.RedditPost{UUID: "p1000000", Title: "Some title"}, true, nil)
+				mockRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil)
+			case "success PATCH":
+				mockRepo.EXPECT().Get(gomock.Any(), gomock.Any()).Return(&entity.RedditPost{UUID: "p1000000", Title: "Some title", Version: 1}, true, nil)
+				mockRepo.EXPECT().Update(gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil)
 			}
 
-			h := handler.New(mockRepo)
+			h := newHandler(mockRepo, nil)
 			rr := httptest.NewRecorder()
-			actualHandlerFunc := h.Route(test.allowedMethods...)
-			actualHandlerFunc(rr, test.request)
+			h.Routes().ServeHTTP(rr, test.request)
 
 			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+			assert.Equal(t, test.expAllow, rr.Result().Header.Get("Allow"))
 		})
 	}
 }
+
+func TestHandlerRouteDisabledFeatures(t *testing.T) {
+	tests := []struct {
+		name    string
+		request *http.Request
+	}{
+		{
+			name:    "like post",
+			request: httptest.NewRequest(http.MethodPost, "/post/p1000000/like", nil),
+		},
+		{
+			name:    "like comment",
+			request: httptest.NewRequest(http.MethodPost, "/post/p1000000/comments/c1000000/like", nil),
+		},
+		{
+			name:    "get comment",
+			request: httptest.NewRequest(http.MethodGet, "/post/p1000000/comments/c1000000", nil),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			ids := idgen.NewBase36()
+			opts := handler.DefaultOptions()
+			opts.Likes = false
+			opts.Comments = false
+			h := handler.New(NewMockRedditPostsRepo(mockCtrl), NewMockCommentsRepo(mockCtrl), ids, validation.New(validation.DefaultRules(), ids), opts, discardLogger)
+			rr := httptest.NewRecorder()
+			h.Routes().ServeHTTP(rr, test.request)
+
+			assert.Equal(t, http.StatusNotFound, rr.Result().StatusCode)
+		})
+	}
+}
+
+func TestHandlerLogFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		repoErr  error
+		expLevel string
+	}{
+		{name: "storage failure", repoErr: fmt.Errorf("can't get post: %w", handler.ErrUnavailable), expLevel: "ERROR"},
+		{name: "client error", repoErr: fmt.Errorf("can't get post: %w", handler.ErrCanceled), expLevel: "INFO"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockRedditPostsRepo(mockCtrl)
+			mockRepo.EXPECT().Get(gomock.Any(), "p1000000").Return(nil, false, test.repoErr)
+
+			buf := new(bytes.Buffer)
+			logger, err := logging.New(buf, logging.FormatJSON, slog.LevelInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := idgen.NewBase36()
+			h := handler.New(mockRepo, nil, ids, validation.New(validation.DefaultRules(), ids), handler.DefaultOptions(), logger)
+			req := httptest.NewRequest(http.MethodGet, "/post/p1000000", nil)
+			req = req.WithContext(logging.With(req.Context(), slog.String(logging.KeyRequestID, "req-1")))
+			h.Routes().ServeHTTP(httptest.NewRecorder(), req)
+
+			var record map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, test.expLevel, record["level"])
+			assert.Equal(t, "error while getting post", record["msg"])
+			assert.Equal(t, "req-1", record[logging.KeyRequestID])
+			assert.Equal(t, handler.RouteGetPost, record[logging.KeyOp])
+			assert.Equal(t, "p1000000", record[logging.KeyPostID])
+			assert.Equal(t, test.repoErr.Error(), record[logging.KeyErr])
+		})
+	}
+}
+
+func TestHandlerRouteMetrics(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepo := NewMockRedditPostsRepo(mockCtrl)
+	mockRepo.EXPECT().Get(gomock.Any(), "p1000000").Return(&entity.RedditPost{UUID: "p1000000", Version: 1}, true, nil)
+
+	reg := prometheus.NewRegistry()
+	h := middleware.Chain(newHandler(mockRepo, nil).Routes(), middleware.Metrics(reg))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/post/p1000000", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/post", nil))
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP http_requests_total Number of served HTTP requests by route and status.
+# TYPE http_requests_total counter
+http_requests_total{route="GetPost",status="200"} 1
+http_requests_total{route="unmatched",status="405"} 1
+`), "http_requests_total")
+	assert.Nil(t, err)
+}
+
+func TestPatchPreviousIDFormat(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepo := NewMockRedditPostsRepo(mockCtrl)
+	mockComments := NewMockCommentsRepo(mockCtrl)
+	storedPost := &entity.RedditPost{UUID: "p1000000", Title: "Some title", Version: 3,
+		Comments: []*entity.Comment{{UUID: "c1000000", Body: "Some comment"}}}
+	mockRepo.EXPECT().Get(gomock.Any(), "p1000000").Return(storedPost, true, nil)
+	mockRepo.EXPECT().Update(gomock.Any(), gomock.Any(), uint64(3)).Return(true, nil)
+	mockComments.EXPECT().Get(gomock.Any(), "p1000000", "c1000000").Return(&entity.Comment{UUID: "c1000000", Body: "Some comment"}, true, nil)
+	mockComments.EXPECT().Update(gomock.Any(), "p1000000", &entity.Comment{UUID: "c1000000", Body: "Fixed"}, uint64(4)).Return(uint64(5), true, nil)
+
+	// base36 IDs were minted before the format changed to ULID
+	ids := idgen.NewULID()
+	h := handler.New(mockRepo, mockComments, ids, validation.New(validation.DefaultRules(), ids), handler.DefaultOptions(), discardLogger)
+
+	req := httptest.NewRequest(http.MethodPatch, "/post/p1000000", strings.NewReader(`{"Title": "Fixed title"}`))
+	req.Header.Set("If-Match", `"3"`)
+	rr := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	h.Routes().ServeHTTP(rr, withIfMatch(httptest.NewRequest(http.MethodPatch, "/post/p1000000/comments/c1000000", strings.NewReader(`{"Body": "Fixed"}`)), `"4"`))
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+}
+
+func TestUpdatePreviousIDFormat(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepo := NewMockRedditPostsRepo(mockCtrl)
+	storedPost := &entity.RedditPost{UUID: "p1000000", Title: "Some title", Version: 3,
+		Comments: []*entity.Comment{{UUID: "c1000000", Body: "Some comment"}}}
+	mockRepo.EXPECT().Get(gomock.Any(), "p1000000").Return(storedPost, true, nil).Times(2)
+	mockRepo.EXPECT().Update(gomock.Any(), &entity.RedditPost{UUID: "p1000000", Title: "Fixed title",
+		Comments: []*entity.Comment{{UUID: "c1000000", Body: "Fixed"}}}, uint64(3)).Return(true, nil)
+
+	// base36 IDs were minted before the format changed to ULID
+	ids := idgen.NewULID()
+	h := handler.New(mockRepo, nil, ids, validation.New(validation.DefaultRules(), ids), handler.DefaultOptions(), discardLogger)
+
+	req := httptest.NewRequest(http.MethodPut, "/post/p1000000",
+		strings.NewReader(`{"UUID": "p1000000", "Title": "Fixed title", "Comments": [{"UUID": "c1000000", "Body": "Fixed"}]}`))
+	req.Header.Set("If-Match", `"3"`)
+	rr := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// only stored IDs are accepted in the previous format
+	req = httptest.NewRequest(http.MethodPut, "/post/p1000000",
+		strings.NewReader(`{"Title": "Fixed title", "Comments": [{"UUID": "c1000001", "Body": "New"}]}`))
+	req.Header.Set("If-Match", `"3"`)
+	rr = httptest.NewRecorder()
+	h.Routes().ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"bytes"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/logging"
+	"encoding/json"
+	"net/http"
+)
+
+// assignIDs mints IDs for the post and its comments that came without one.
+// Format of client supplied IDs is checked by the validator beforehand.
+func (h *HttpHandler) assignIDs(post *entity.RedditPost) {
+	if post.UUID == "" {
+		post.UUID = h.ids.New()
+	}
+	for _, c := range post.Comments {
+		h.assignCommentID(c)
+	}
+}
+
+func (h *HttpHandler) assignCommentID(comment *entity.Comment) {
+	if comment.UUID == "" {
+		comment.UUID = h.ids.New()
+	}
+}
+
+// storedIDs lists IDs of the stored post and its comments, they stay valid after
+// a change of the ID format, see validation.Validator.Stored.
+func storedIDs(post *entity.RedditPost) []string {
+	ids := []string{post.UUID}
+	for _, c := range post.Comments {
+		ids = append(ids, c.UUID)
+	}
+	return ids
+}
+
+// writeCreated responds with 201, the Location of the created resource and its representation.
+func (h *HttpHandler) writeCreated(w http.ResponseWriter, r *http.Request, location string, v any) {
+	b := new(bytes.Buffer)
+	err := json.NewEncoder(b).Encode(v)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "can't encode created resource", logging.KeyErr, err)
+		writeProblem(w, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusCreated)
+	_, err = w.Write(b.Bytes())
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "can't write created resource", logging.KeyErr, err)
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"bytes"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// resetLikes makes likes of post server-managed: they are copied from stored,
+// comments unknown to stored (or all of them when stored is nil) get zero likes.
+func resetLikes(post *entity.RedditPost, stored *entity.RedditPost) {
+	storedLikes := map[string]uint32{}
+	post.Likes = 0
+	if stored != nil {
+		post.Likes = stored.Likes
+		for _, c := range stored.Comments {
+			storedLikes[c.UUID] = c.Likes
+		}
+	}
+	for _, c := range post.Comments {
+		c.Likes = storedLikes[c.UUID]
+	}
+}
+
+// LikePost and the other like handlers don't take If-Match, unlike other writes: likes are
+// counters changed atomically by concurrent clients, a like can't be based on a stale read.
+// They still increase the post version, so writes based on an earlier ETag fail with 412.
+func (h *HttpHandler) LikePost(w http.ResponseWriter, r *http.Request) {
+	h.likePost(w, r, RouteLikePost, 1)
+}
+
+func (h *HttpHandler) UnlikePost(w http.ResponseWriter, r *http.Request) {
+	h.likePost(w, r, RouteUnlikePost, -1)
+}
+
+func (h *HttpHandler) LikeComment(w http.ResponseWriter, r *http.Request) {
+	h.likeComment(w, r, RouteLikeComment, 1)
+}
+
+func (h *HttpHandler) UnlikeComment(w http.ResponseWriter, r *http.Request) {
+	h.likeComment(w, r, RouteUnlikeComment, -1)
+}
+
+func (h *HttpHandler) likePost(w http.ResponseWriter, r *http.Request, route string, delta int) {
+	postID := postIDParam.Value(r)
+
+	ctx, cancel := h.repoContext(r, route)
+	defer cancel()
+	likes, found, err := h.postsRepo.Like(ctx, postID, delta)
+	if errors.Is(err, ErrLikesOutOfRange) {
+		errMsg := fmt.Sprintf("can't change likes of post with uuid=%v by %v", postID, delta)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusConflict, CodeLikesOutOfRange, errMsg)
+		return
+	}
+	if err != nil {
+		h.logRepoError(r.Context(), "error while liking post", err)
+		writeRepoError(w, err)
+		return
+	}
+	if !found {
+		errMsg := fmt.Sprintf("can't find post with uuid=%v", postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusNotFound, CodeNotFound, errMsg)
+		return
+	}
+	h.writeLikes(w, r, likes)
+}
+
+func (h *HttpHandler) likeComment(w http.ResponseWriter, r *http.Request, route string, delta int) {
+	postID, commentID := postIDParam.Value(r), commentIDParam.Value(r)
+
+	ctx, cancel := h.repoContext(r, route)
+	defer cancel()
+	likes, found, err := h.commentsRepo.Like(ctx, postID, commentID, delta)
+	if errors.Is(err, ErrLikesOutOfRange) {
+		errMsg := fmt.Sprintf("can't change likes of comment with uuid=%v by %v", commentID, delta)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusConflict, CodeLikesOutOfRange, errMsg)
+		return
+	}
+	if err != nil {
+		h.logRepoError(r.Context(), "error while liking comment", err)
+		writeRepoError(w, err)
+		return
+	}
+	if !found {
+		errMsg := fmt.Sprintf("can't find comment with uuid=%v in post with uuid=%v", commentID, postID)
+		h.logger.InfoContext(r.Context(), errMsg)
+		writeProblem(w, http.StatusNotFound, CodeNotFound, errMsg)
+		return
+	}
+	h.writeLikes(w, r, likes)
+}
+
+func (h *HttpHandler) writeLikes(w http.ResponseWriter, r *http.Request, likes uint32) {
+	b := new(bytes.Buffer)
+	err := json.NewEncoder(b).Encode(&LikesCount{Likes: likes})
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "can't encode likes response body", logging.KeyErr, err)
+		writeProblem(w, http.StatusInternalServerError, CodeInternal, "")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(b.Bytes())
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "can't write likes response body", logging.KeyErr, err)
+	}
+}
@@ -0,0 +1,156 @@
+package handler_test
+
+import (
+	"dmmak/simple-rest-crud/internal/handler"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestLikePost(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		expDelta      int
+		expStatusCode int
+	}{
+		{
+			name:          "success like",
+			method:        http.MethodPost,
+			expDelta:      1,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "success unlike",
+			method:        http.MethodDelete,
+			expDelta:      -1,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "out of range",
+			method:        http.MethodPost,
+			expDelta:      1,
+			expStatusCode: http.StatusConflict,
+		},
+		{
+			name:          "not found",
+			method:        http.MethodPost,
+			expDelta:      1,
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "error",
+			method:        http.MethodDelete,
+			expDelta:      -1,
+			expStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockRedditPostsRepo(mockCtrl)
+			mockRecorder := mockRepo.EXPECT().Like(gomock.Any(), gomock.Eq("p1000000"), gomock.Eq(test.expDelta))
+
+			switch test.name {
+			case "success like", "success unlike":
+				mockRecorder.Return(uint32(6), true, nil)
+			case "out of range":
+				mockRecorder.Return(uint32(0), true, handler.ErrLikesOutOfRange)
+			case "not found":
+				mockRecorder.Return(uint32(0), false, nil)
+			case "error":
+				mockRecorder.Return(uint32(0), false, fmt.Errorf("some repo internal error"))
+			}
+
+			h := newHandler(mockRepo, nil)
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest(test.method, "/post/p1000000/like", nil)
+			if err != nil {
+				log.Fatal(err)
+			}
+			h.Routes().ServeHTTP(rr, req)
+
+			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+			if test.expStatusCode == http.StatusOK {
+				actualLikes := &handler.LikesCount{}
+				err = json.NewDecoder(rr.Body).Decode(actualLikes)
+				if err != nil {
+					t.Fatalf("can't decode response body: %s", err)
+				}
+				assert.Equal(t, uint32(6), actualLikes.Likes)
+			}
+		})
+	}
+}
+
+func TestLikeComment(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		expDelta      int
+		expStatusCode int
+	}{
+		{
+			name:          "success like",
+			method:        http.MethodPost,
+			expDelta:      1,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "success unlike",
+			method:        http.MethodDelete,
+			expDelta:      -1,
+			expStatusCode: http.StatusOK,
+		},
+		{
+			name:          "out of range",
+			method:        http.MethodDelete,
+			expDelta:      -1,
+			expStatusCode: http.StatusConflict,
+		},
+		{
+			name:          "not found",
+			method:        http.MethodPost,
+			expDelta:      1,
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "not allowed",
+			method:        http.MethodGet,
+			expStatusCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockCommentsRepo(mockCtrl)
+
+			switch test.name {
+			case "success like", "success unlike":
+				mockRepo.EXPECT().Like(gomock.Any(), gomock.Eq("p1000000"), gomock.Eq("c0000001"), gomock.Eq(test.expDelta)).Return(uint32(1), true, nil)
+			case "out of range":
+				mockRepo.EXPECT().Like(gomock.Any(), gomock.Eq("p1000000"), gomock.Eq("c0000001"), gomock.Eq(test.expDelta)).Return(uint32(0), true, handler.ErrLikesOutOfRange)
+			case "not found":
+				mockRepo.EXPECT().Like(gomock.Any(), gomock.Eq("p1000000"), gomock.Eq("c0000001"), gomock.Eq(test.expDelta)).Return(uint32(0), false, nil)
+			}
+
+			h := newHandler(nil, mockRepo)
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest(test.method, "/post/p1000000/comments/c0000001/like", nil)
+			if err != nil {
+				log.Fatal(err)
+			}
+			h.Routes().ServeHTTP(rr, req)
+
+			assert.Equal(t, test.expStatusCode, rr.Result().StatusCode)
+		})
+	}
+}
@@ -7,6 +7,7 @@ package handler_test
 import (
 	context "context"
 	entity "dmmak/simple-rest-crud/internal/entity"
+	handler "dmmak/simple-rest-crud/internal/handler"
 	reflect "reflect"
 
 	gomock "go.uber.org/mock/gomock"
@@ -36,18 +37,18 @@ func (m *MockRedditPostsRepo) EXPECT() *MockRedditPostsRepoMockRecorder {
 }
 
 // Delete mocks base method.
-func (m *MockRedditPostsRepo) Delete(ctx context.Context, postID string) (bool, error) {
+func (m *MockRedditPostsRepo) Delete(ctx context.Context, postID string, version uint64) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Delete", ctx, postID)
+	ret := m.ctrl.Call(m, "Delete", ctx, postID, version)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Delete indicates an expected call of Delete.
-func (mr *MockRedditPostsRepoMockRecorder) Delete(ctx, postID interface{}) *gomock.Call {
+func (mr *MockRedditPostsRepoMockRecorder) Delete(ctx, postID, version interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockRedditPostsRepo)(nil).Delete), ctx, postID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockRedditPostsRepo)(nil).Delete), ctx, postID, version)
 }
 
 // Get mocks base method.
@@ -66,16 +67,182 @@ func (mr *MockRedditPostsRepoMockRecorder) Get(ctx, postID interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockRedditPostsRepo)(nil).Get), ctx, postID)
 }
 
+// Like mocks base method.
+func (m *MockRedditPostsRepo) Like(ctx context.Context, postID string, delta int) (uint32, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Like", ctx, postID, delta)
+	ret0, _ := ret[0].(uint32)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Like indicates an expected call of Like.
+func (mr *MockRedditPostsRepoMockRecorder) Like(ctx, postID, delta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Like", reflect.TypeOf((*MockRedditPostsRepo)(nil).Like), ctx, postID, delta)
+}
+
+// List mocks base method.
+func (m *MockRedditPostsRepo) List(ctx context.Context, afterID string, limit int) ([]*entity.RedditPost, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, afterID, limit)
+	ret0, _ := ret[0].([]*entity.RedditPost)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockRedditPostsRepoMockRecorder) List(ctx, afterID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockRedditPostsRepo)(nil).List), ctx, afterID, limit)
+}
+
+// Revision mocks base method.
+func (m *MockRedditPostsRepo) Revision(ctx context.Context, postID string) (handler.Revision, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revision", ctx, postID)
+	ret0, _ := ret[0].(handler.Revision)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Revision indicates an expected call of Revision.
+func (mr *MockRedditPostsRepoMockRecorder) Revision(ctx, postID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revision", reflect.TypeOf((*MockRedditPostsRepo)(nil).Revision), ctx, postID)
+}
+
 // Save mocks base method.
-func (m *MockRedditPostsRepo) Save(ctx context.Context, post *entity.RedditPost) error {
+func (m *MockRedditPostsRepo) Save(ctx context.Context, post *entity.RedditPost, onConflict handler.ConflictPolicy, version uint64) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Save", ctx, post)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "Save", ctx, post, onConflict, version)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Save indicates an expected call of Save.
-func (mr *MockRedditPostsRepoMockRecorder) Save(ctx, post interface{}) *gomock.Call {
+func (mr *MockRedditPostsRepoMockRecorder) Save(ctx, post, onConflict, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockRedditPostsRepo)(nil).Save), ctx, post, onConflict, version)
+}
+
+// Update mocks base method.
+func (m *MockRedditPostsRepo) Update(ctx context.Context, post *entity.RedditPost, version uint64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, post, version)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockRedditPostsRepoMockRecorder) Update(ctx, post, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockRedditPostsRepo)(nil).Update), ctx, post, version)
+}
+
+// MockCommentsRepo is a mock of CommentsRepo interface.
+type MockCommentsRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockCommentsRepoMockRecorder
+}
+
+// MockCommentsRepoMockRecorder is the mock recorder for MockCommentsRepo.
+type MockCommentsRepoMockRecorder struct {
+	mock *MockCommentsRepo
+}
+
+// NewMockCommentsRepo creates a new mock instance.
+func NewMockCommentsRepo(ctrl *gomock.Controller) *MockCommentsRepo {
+	mock := &MockCommentsRepo{ctrl: ctrl}
+	mock.recorder = &MockCommentsRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCommentsRepo) EXPECT() *MockCommentsRepoMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockCommentsRepo) Delete(ctx context.Context, postID, commentID string, version uint64) (uint64, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, postID, commentID, version)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockCommentsRepoMockRecorder) Delete(ctx, postID, commentID, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockCommentsRepo)(nil).Delete), ctx, postID, commentID, version)
+}
+
+// Get mocks base method.
+func (m *MockCommentsRepo) Get(ctx context.Context, postID, commentID string) (*entity.Comment, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, postID, commentID)
+	ret0, _ := ret[0].(*entity.Comment)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockCommentsRepoMockRecorder) Get(ctx, postID, commentID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCommentsRepo)(nil).Get), ctx, postID, commentID)
+}
+
+// Like mocks base method.
+func (m *MockCommentsRepo) Like(ctx context.Context, postID, commentID string, delta int) (uint32, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Like", ctx, postID, commentID, delta)
+	ret0, _ := ret[0].(uint32)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Like indicates an expected call of Like.
+func (mr *MockCommentsRepoMockRecorder) Like(ctx, postID, commentID, delta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Like", reflect.TypeOf((*MockCommentsRepo)(nil).Like), ctx, postID, commentID, delta)
+}
+
+// Save mocks base method.
+func (m *MockCommentsRepo) Save(ctx context.Context, postID string, comment *entity.Comment, version uint64) (uint64, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, postID, comment, version)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockCommentsRepoMockRecorder) Save(ctx, postID, comment, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockCommentsRepo)(nil).Save), ctx, postID, comment, version)
+}
+
+// Update mocks base method.
+func (m *MockCommentsRepo) Update(ctx context.Context, postID string, comment *entity.Comment, version uint64) (uint64, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, postID, comment, version)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockCommentsRepoMockRecorder) Update(ctx, postID, comment, version interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockRedditPostsRepo)(nil).Save), ctx, post)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockCommentsRepo)(nil).Update), ctx, postID, comment, version)
 }
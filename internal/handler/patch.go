@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// applyMergePatch returns JSON of v with patch applied. The result is meant to be
+// decoded back by the validator, so patches can't bypass validation.
+func applyMergePatch(v any, patch any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("can't encode patch target: %w", err)
+	}
+	var target any
+	if err := json.Unmarshal(b, &target); err != nil {
+		return nil, fmt.Errorf("can't decode patch target: %w", err)
+	}
+
+	b, err = json.Marshal(mergePatch(target, patch))
+	if err != nil {
+		return nil, fmt.Errorf("can't encode patch result: %w", err)
+	}
+	return b, nil
+}
+
+// mergePatch implements the MergePatch algorithm from RFC 7386.
+func mergePatch(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = map[string]any{}
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+		} else {
+			targetObj[k] = mergePatch(targetObj[k], v)
+		}
+	}
+	return targetObj
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"dmmak/simple-rest-crud/internal/logging"
+	"dmmak/simple-rest-crud/internal/validation"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// Stable machine-readable error codes, returned in the code member of problem responses.
+const (
+	CodeMalformedBody = "malformed_body"
+	CodeInvalidQuery  = "invalid_query"
+	CodeInvalidID     = "invalid_id"
+	CodeNotFound      = "not_found"
+	CodeConflict      = "conflict"
+	// CodePreconditionFailed and CodePreconditionRequired answer stale and missing If-Match.
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeLikesOutOfRange      = "likes_out_of_range"
+	CodeValidationFailed     = "validation_failed"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeUnavailable          = "unavailable"
+	CodeTimeout              = "timeout"
+	CodeClientClosed         = "client_closed_request"
+	CodeInternal             = "internal"
+)
+
+// StatusClientClosedRequest is the nginx status for requests the client went away from
+// before the response was ready.
+const StatusClientClosedRequest = 499
+
+// Errors repositories wrap their failures with, so the handler can tell them apart.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+	// ErrVersionMismatch is returned when the post was changed since the version
+	// a conditional write is based on.
+	ErrVersionMismatch = errors.New("version mismatch")
+	ErrValidation      = errors.New("validation failed")
+	ErrUnavailable     = errors.New("storage unavailable")
+	// ErrCanceled and ErrTimeout wrap context.Canceled and context.DeadlineExceeded
+	// returned by storage calls.
+	ErrCanceled = errors.New("request canceled")
+	ErrTimeout  = errors.New("request timed out")
+)
+
+// Problem is an RFC 7807 problem details object extended with a stable error code.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+	// Errors lists every invalid field of a validation_failed problem.
+	Errors validation.Errors `json:"errors,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, status int, code string, detail string) {
+	encodeProblem(w, &Problem{
+		Type:   "about:blank",
+		Title:  statusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	})
+}
+
+// InternalError responds with a 500 problem, e.g. once a panic of a handler is recovered.
+func InternalError(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, http.StatusInternalServerError, CodeInternal, "")
+}
+
+// writeInvalidPayload responds with 422 listing every field error when err carries them,
+// with 400 otherwise, as the payload isn't even well-formed JSON then.
+func writeInvalidPayload(w http.ResponseWriter, err error) {
+	errs, ok := validation.AsErrors(err)
+	if !ok {
+		writeProblem(w, http.StatusBadRequest, CodeMalformedBody, err.Error())
+		return
+	}
+	encodeProblem(w, &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusUnprocessableEntity),
+		Status: http.StatusUnprocessableEntity,
+		Code:   CodeValidationFailed,
+		Detail: "request payload has invalid fields",
+		Errors: errs,
+	})
+}
+
+func statusText(status int) string {
+	if status == StatusClientClosedRequest {
+		return "Client Closed Request"
+	}
+	return http.StatusText(status)
+}
+
+// encodeProblem logs with the default logger, problems are written by functions
+// that don't belong to a handler too, e.g. InternalError.
+func encodeProblem(w http.ResponseWriter, problem *Problem) {
+	b := new(bytes.Buffer)
+	err := json.NewEncoder(b).Encode(problem)
+	if err != nil {
+		slog.Error("can't encode problem response body", logging.KeyErr, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	_, err = w.Write(b.Bytes())
+	if err != nil {
+		slog.Warn("can't write problem response body", logging.KeyErr, err)
+	}
+}
+
+// writeRepoError translates an error returned by a repository into a problem response.
+// Details of unexpected errors aren't exposed to the client.
+func writeRepoError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeProblem(w, http.StatusNotFound, CodeNotFound, "referenced resource doesn't exist")
+	case errors.Is(err, ErrLikesOutOfRange):
+		writeProblem(w, http.StatusConflict, CodeLikesOutOfRange, "likes count can't be changed beyond its range")
+	case errors.Is(err, ErrVersionMismatch):
+		writeProblem(w, http.StatusPreconditionFailed, CodePreconditionFailed, "resource was changed since the version the request is based on")
+	case errors.Is(err, ErrConflict):
+		writeProblem(w, http.StatusConflict, CodeConflict, "resource conflicts with the stored state")
+	case errors.Is(err, ErrValidation):
+		writeProblem(w, http.StatusUnprocessableEntity, CodeValidationFailed, "resource doesn't satisfy storage constraints")
+	case errors.Is(err, ErrUnavailable):
+		writeProblem(w, http.StatusServiceUnavailable, CodeUnavailable, "storage is temporarily unavailable")
+	case errors.Is(err, ErrCanceled):
+		// nobody reads the response, it's written for access logs and metrics
+		writeProblem(w, StatusClientClosedRequest, CodeClientClosed, "request was canceled by the client")
+	case errors.Is(err, ErrTimeout):
+		writeProblem(w, http.StatusGatewayTimeout, CodeTimeout, "storage didn't respond in time")
+	default:
+		writeProblem(w, http.StatusInternalServerError, CodeInternal, "")
+	}
+}
+
+// IsClientError reports whether err returned by a repository is answered with a 4xx status,
+// being caused by the request rather than by the storage.
+func IsClientError(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrLikesOutOfRange) || errors.Is(err, ErrVersionMismatch) ||
+		errors.Is(err, ErrConflict) || errors.Is(err, ErrValidation) || errors.Is(err, ErrCanceled)
+}
+
+// logRepoError logs err returned by a repository at error level, unless it's a client error.
+func (h *HttpHandler) logRepoError(ctx context.Context, msg string, err error) {
+	level := slog.LevelError
+	if IsClientError(err) {
+		level = slog.LevelInfo
+	}
+	h.logger.Log(ctx, level, msg, logging.KeyErr, err)
+}
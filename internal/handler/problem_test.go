@@ -0,0 +1,177 @@
+package handler_test
+
+import (
+	"bytes"
+	"dmmak/simple-rest-crud/internal/handler"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRepoErrorProblems(t *testing.T) {
+	tests := []struct {
+		name          string
+		repoErr       error
+		expStatusCode int
+		expCode       string
+	}{
+		{
+			name:          "conflict",
+			repoErr:       fmt.Errorf("can't insert new post: %w", handler.ErrConflict),
+			expStatusCode: http.StatusConflict,
+			expCode:       handler.CodeConflict,
+		},
+		{
+			name:          "version mismatch",
+			repoErr:       fmt.Errorf("can't save post: %w", handler.ErrVersionMismatch),
+			expStatusCode: http.StatusPreconditionFailed,
+			expCode:       handler.CodePreconditionFailed,
+		},
+		{
+			name:          "validation",
+			repoErr:       fmt.Errorf("can't insert new post: %w", handler.ErrValidation),
+			expStatusCode: http.StatusUnprocessableEntity,
+			expCode:       handler.CodeValidationFailed,
+		},
+		{
+			name:          "not found",
+			repoErr:       fmt.Errorf("can't insert new post: %w", handler.ErrNotFound),
+			expStatusCode: http.StatusNotFound,
+			expCode:       handler.CodeNotFound,
+		},
+		{
+			name:          "unavailable",
+			repoErr:       fmt.Errorf("can't create tx: %w", handler.ErrUnavailable),
+			expStatusCode: http.StatusServiceUnavailable,
+			expCode:       handler.CodeUnavailable,
+		},
+		{
+			name:          "canceled",
+			repoErr:       fmt.Errorf("can't insert new post: %w", handler.ErrCanceled),
+			expStatusCode: handler.StatusClientClosedRequest,
+			expCode:       handler.CodeClientClosed,
+		},
+		{
+			name:          "timeout",
+			repoErr:       fmt.Errorf("can't insert new post: %w", handler.ErrTimeout),
+			expStatusCode: http.StatusGatewayTimeout,
+			expCode:       handler.CodeTimeout,
+		},
+		{
+			name:          "unexpected",
+			repoErr:       fmt.Errorf("some repo internal error"),
+			expStatusCode: http.StatusInternalServerError,
+			expCode:       handler.CodeInternal,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockRedditPostsRepo(mockCtrl)
+			mockRepo.EXPECT().Save(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(false, test.repoErr)
+
+			h := newHandler(mockRepo, nil)
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/post", bytes.NewReader([]byte(`{"Title": "Some title"}`)))
+			if err != nil {
+				log.Fatal(err)
+			}
+			h.SavePost(rr, req)
+
+			assertProblem(t, rr, test.expStatusCode, test.expCode)
+		})
+	}
+}
+
+func TestRequestProblems(t *testing.T) {
+	tests := []struct {
+		name          string
+		request       *http.Request
+		expStatusCode int
+		expCode       string
+	}{
+		{
+			name:          "malformed body",
+			request:       httptest.NewRequest(http.MethodPost, "/post", bytes.NewReader([]byte(`{"Title": `))),
+			expStatusCode: http.StatusBadRequest,
+			expCode:       handler.CodeMalformedBody,
+		},
+		{
+			name:          "invalid fields",
+			request:       httptest.NewRequest(http.MethodPost, "/post", bytes.NewReader([]byte(`{"UUID": "-"}`))),
+			expStatusCode: http.StatusUnprocessableEntity,
+			expCode:       handler.CodeValidationFailed,
+		},
+		{
+			name:          "invalid query",
+			request:       httptest.NewRequest(http.MethodGet, "/post?limit=x", nil),
+			expStatusCode: http.StatusBadRequest,
+			expCode:       handler.CodeInvalidQuery,
+		},
+		{
+			name:          "method not allowed",
+			request:       httptest.NewRequest(http.MethodPut, "/post", nil),
+			expStatusCode: http.StatusMethodNotAllowed,
+			expCode:       handler.CodeMethodNotAllowed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockRepo := NewMockRedditPostsRepo(mockCtrl)
+
+			h := newHandler(mockRepo, nil)
+			rr := httptest.NewRecorder()
+			h.Routes().ServeHTTP(rr, test.request)
+
+			assertProblem(t, rr, test.expStatusCode, test.expCode)
+		})
+	}
+}
+
+func TestValidationProblemListsAllFields(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepo := NewMockRedditPostsRepo(mockCtrl)
+
+	h := newHandler(mockRepo, nil)
+	rr := httptest.NewRecorder()
+	reqBody := `{"UUID": "-", "Title": "", "Comments": [{"Body": ""}], "Views": 1}`
+	req := httptest.NewRequest(http.MethodPost, "/post", bytes.NewReader([]byte(reqBody)))
+	h.SavePost(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+	problem := &handler.Problem{}
+	err := json.NewDecoder(rr.Body).Decode(problem)
+	if err != nil {
+		t.Fatalf("can't decode problem response body: %s", err)
+	}
+	assert.Equal(t, handler.CodeValidationFailed, problem.Code)
+	assert.Len(t, problem.Errors, 4)
+}
+
+func assertProblem(t *testing.T, rr *httptest.ResponseRecorder, expStatusCode int, expCode string) {
+	t.Helper()
+	assert.Equal(t, expStatusCode, rr.Result().StatusCode)
+	assert.Equal(t, "application/problem+json", rr.Result().Header.Get("Content-Type"))
+
+	problem := &handler.Problem{}
+	err := json.NewDecoder(rr.Body).Decode(problem)
+	if err != nil {
+		t.Fatalf("can't decode problem response body: %s", err)
+	}
+	assert.Equal(t, expStatusCode, problem.Status)
+	assert.Equal(t, expCode, problem.Code)
+	if expStatusCode == handler.StatusClientClosedRequest {
+		assert.Equal(t, "Client Closed Request", problem.Title)
+	} else {
+		assert.Equal(t, http.StatusText(expStatusCode), problem.Title)
+	}
+}
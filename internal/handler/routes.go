@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"dmmak/simple-rest-crud/internal/idgen"
+	"dmmak/simple-rest-crud/internal/logging"
+	"dmmak/simple-rest-crud/internal/middleware"
+	"dmmak/simple-rest-crud/internal/router"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// Path parameters, IDs of any known format match, so posts created before
+// a change of the ID format stay addressable.
+var (
+	postIDParam    = router.NewParam("postID", parseID)
+	commentIDParam = router.NewParam("commentID", parseID)
+)
+
+var errInvalidID = errors.New("invalid id")
+
+func parseID(segment string) (string, error) {
+	if !idgen.ValidAny(segment) {
+		return "", errInvalidID
+	}
+	return segment, nil
+}
+
+// Routes returns the handler of all endpoints. Endpoints of disabled features aren't
+// routed, they respond with 404 like unknown paths do. Records logged while serving
+// a route carry its name and the IDs of its path as op, post_id and comment_id,
+// metrics of middleware.Metrics are labeled with its name.
+func (h *HttpHandler) Routes() http.Handler {
+	rt := router.New(postIDParam, commentIDParam)
+	rt.NotFound = func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, http.StatusNotFound, CodeNotFound, fmt.Sprintf("there is no resource at %v", r.URL.Path))
+	}
+	rt.MethodNotAllowed = func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, fmt.Sprintf("method %v isn't allowed for %v", r.Method, r.URL.Path))
+	}
+
+	rt.HandleFunc(http.MethodPost, "/post", h.named(RouteSavePost, h.SavePost))
+	rt.HandleFunc(http.MethodGet, "/post", h.named(RouteListPosts, h.ListPosts))
+	rt.HandleFunc(http.MethodGet, "/post/{postID}", h.named(RouteGetPost, h.GetPost))
+	rt.HandleFunc(http.MethodPut, "/post/{postID}", h.named(RouteUpdatePost, h.UpdatePost))
+	rt.HandleFunc(http.MethodPatch, "/post/{postID}", h.named(RoutePatchPost, h.PatchPost))
+	rt.HandleFunc(http.MethodDelete, "/post/{postID}", h.named(RouteDeletePost, h.DeletePost))
+	if h.opts.Comments {
+		rt.HandleFunc(http.MethodPost, "/post/{postID}/comments", h.named(RouteSaveComment, h.SaveComment))
+		rt.HandleFunc(http.MethodGet, "/post/{postID}/comments/{commentID}", h.named(RouteGetComment, h.GetComment))
+		rt.HandleFunc(http.MethodPatch, "/post/{postID}/comments/{commentID}", h.named(RoutePatchComment, h.PatchComment))
+		rt.HandleFunc(http.MethodDelete, "/post/{postID}/comments/{commentID}", h.named(RouteDeleteComment, h.DeleteComment))
+	}
+	if h.opts.Likes {
+		rt.HandleFunc(http.MethodPost, "/post/{postID}/like", h.named(RouteLikePost, h.LikePost))
+		rt.HandleFunc(http.MethodDelete, "/post/{postID}/like", h.named(RouteUnlikePost, h.UnlikePost))
+		rt.HandleFunc(http.MethodPost, "/post/{postID}/comments/{commentID}/like", h.named(RouteLikeComment, h.LikeComment))
+		rt.HandleFunc(http.MethodDelete, "/post/{postID}/comments/{commentID}/like", h.named(RouteUnlikeComment, h.UnlikeComment))
+	}
+	return rt
+}
+
+// named names the route of the request for middlewares, and adds it with the IDs of the path
+// to the fields logged for the request.
+func (h *HttpHandler) named(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		middleware.SetRoute(r, route)
+		attrs := []slog.Attr{slog.String(logging.KeyOp, route)}
+		if postID := postIDParam.Value(r); postID != "" {
+			attrs = append(attrs, slog.String(logging.KeyPostID, postID))
+		}
+		if commentID := commentIDParam.Value(r); commentID != "" {
+			attrs = append(attrs, slog.String(logging.KeyCommentID, commentID))
+		}
+		next(w, r.WithContext(logging.With(r.Context(), attrs...)))
+	}
+}
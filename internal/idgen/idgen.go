@@ -0,0 +1,161 @@
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	FormatBase36 = "base36"
+	FormatULID   = "ulid"
+	FormatUUIDv7 = "uuidv7"
+)
+
+// Generator mints IDs for posts and comments and checks that client supplied IDs
+// have the same format.
+type Generator interface {
+	New() string
+	Valid(id string) bool
+}
+
+func New(format string) (Generator, error) {
+	switch format {
+	case FormatBase36:
+		return NewBase36(), nil
+	case FormatULID:
+		return NewULID(), nil
+	case FormatUUIDv7:
+		return NewUUIDv7(), nil
+	default:
+		return nil, fmt.Errorf("unknown id format %q", format)
+	}
+}
+
+// ValidAny reports whether id has any of the known formats. IDs minted before
+// a change of the format stay addressable, while new ones are checked by Generator.Valid.
+func ValidAny(id string) bool {
+	return NewBase36().Valid(id) || NewULID().Valid(id) || NewUUIDv7().Valid(id)
+}
+
+type base36 struct{}
+
+// NewBase36 returns a generator of random 8-char [a-z0-9] IDs.
+func NewBase36() Generator {
+	return base36{}
+}
+
+const base36Alphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+var base36Re = regexp.MustCompile(`^[a-z0-9]{8}$`)
+
+func (base36) New() string {
+	id := make([]byte, 0, 8)
+	b := make([]byte, 16)
+	for len(id) < 8 {
+		mustRead(b)
+		for _, v := range b {
+			// reject bytes that would make the distribution uneven
+			if v >= 252 || len(id) == 8 {
+				continue
+			}
+			id = append(id, base36Alphabet[v%36])
+		}
+	}
+	return string(id)
+}
+
+func (base36) Valid(id string) bool {
+	return base36Re.MatchString(id)
+}
+
+type ulid struct{}
+
+// NewULID returns a generator of ULIDs: 48-bit millisecond timestamp followed by
+// 80 random bits, encoded as 26 chars of Crockford's base32.
+func NewULID() Generator {
+	return ulid{}
+}
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (ulid) New() string {
+	var b [16]byte
+	putMillis(b[:6], time.Now())
+	mustRead(b[6:])
+
+	// 128 bits are encoded into 130 so the two leading bits are always zero
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	id := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		id[i] = crockfordAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(id)
+}
+
+func (ulid) Valid(id string) bool {
+	if len(id) != 26 || id[0] > '7' {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if strings.IndexByte(crockfordAlphabet, id[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+type uuidV7 struct{}
+
+// NewUUIDv7 returns a generator of time ordered UUIDs (RFC 9562 version 7)
+// in the canonical lowercase 8-4-4-4-12 form.
+func NewUUIDv7() Generator {
+	return uuidV7{}
+}
+
+func (uuidV7) New() string {
+	var b [16]byte
+	putMillis(b[:6], time.Now())
+	mustRead(b[6:])
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+
+	var id [36]byte
+	hex.Encode(id[0:8], b[0:4])
+	id[8] = '-'
+	hex.Encode(id[9:13], b[4:6])
+	id[13] = '-'
+	hex.Encode(id[14:18], b[6:8])
+	id[18] = '-'
+	hex.Encode(id[19:23], b[8:10])
+	id[23] = '-'
+	hex.Encode(id[24:], b[10:])
+	return string(id[:])
+}
+
+var uuidV7Re = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func (uuidV7) Valid(id string) bool {
+	return uuidV7Re.MatchString(id)
+}
+
+func putMillis(b []byte, t time.Time) {
+	ms := uint64(t.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
+
+func mustRead(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("can't read random bytes: %s", err))
+	}
+}
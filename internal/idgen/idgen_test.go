@@ -0,0 +1,67 @@
+package idgen_test
+
+import (
+	"dmmak/simple-rest-crud/internal/idgen"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		format     string
+		expLen     int
+		invalidIDs []string
+	}{
+		{
+			format:     idgen.FormatBase36,
+			expLen:     8,
+			invalidIDs: []string{"", "p100000", "p10000000", "P1000000", "p100000-"},
+		},
+		{
+			format:     idgen.FormatULID,
+			expLen:     26,
+			invalidIDs: []string{"", "01h5kz0x8fq7j9dtp1c7y6k3vm", "81H5KZ0X8FQ7J9DTP1C7Y6K3VM", "01H5KZ0X8FQ7J9DTP1C7Y6K3VU", "01H5KZ0X8FQ7J9DTP1C7Y6K3V"},
+		},
+		{
+			format:     idgen.FormatUUIDv7,
+			expLen:     36,
+			invalidIDs: []string{"", "0189c2a4-6b1e-4f2a-9c3d-5e6f7a8b9c0d", "0189c2a4-6b1e-7f2a-cc3d-5e6f7a8b9c0d", "0189C2A4-6B1E-7F2A-9C3D-5E6F7A8B9C0D"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			gen, err := idgen.New(test.format)
+			if err != nil {
+				t.Fatalf("can't create generator: %s", err)
+			}
+
+			seen := map[string]bool{}
+			for i := 0; i < 1000; i++ {
+				id := gen.New()
+				assert.Len(t, id, test.expLen)
+				assert.True(t, gen.Valid(id), "generated id %q must be valid", id)
+				assert.False(t, seen[id], "generated id %q must be unique", id)
+				seen[id] = true
+			}
+			for _, id := range test.invalidIDs {
+				assert.False(t, gen.Valid(id), "id %q must be invalid", id)
+			}
+		})
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := idgen.New("snowflake")
+	assert.Error(t, err)
+}
+
+func TestValidAny(t *testing.T) {
+	for _, id := range []string{"p1000000", "01H5KZ0X8FQ7J9DTP1C7Y6K3VM", "0189c2a4-6b1e-7f2a-9c3d-5e6f7a8b9c0d"} {
+		assert.True(t, idgen.ValidAny(id), id)
+	}
+	for _, id := range []string{"", "xyz", "p1000000/x", "abcdefgh123"} {
+		assert.False(t, idgen.ValidAny(id), id)
+	}
+}
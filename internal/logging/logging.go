@@ -0,0 +1,117 @@
+// Package logging builds the structured logger of the app. Request scoped fields,
+// e.g. the request ID, are kept in contexts and added to records logged with them.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Field keys shared by the log lines of a request.
+const (
+	KeyRequestID = "request_id"
+	KeyOp        = "op"
+	KeyPostID    = "post_id"
+	KeyCommentID = "comment_id"
+	// KeyRepoOp names the repository method, op is the route it's called by.
+	KeyRepoOp = "repo_op"
+	KeyErr    = "err"
+)
+
+// New returns a logger writing records of level or above to w in format.
+// The logger adds fields stored by With to records logged with a context.
+func New(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch format {
+	case FormatText:
+		h = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// ParseLevel parses debug, info, warn or error, case-insensitively,
+// optionally followed by an offset, e.g. info+2.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+type attrsKey struct{}
+
+// With returns a copy of ctx carrying attrs in addition to the ones of ctx,
+// an attr replaces a carried one of the same key.
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	carried := attrsFrom(ctx)
+	merged := make([]slog.Attr, 0, len(carried)+len(attrs))
+	for _, a := range carried {
+		if !hasKey(attrs, a.Key) {
+			merged = append(merged, a)
+		}
+	}
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, attrsKey{}, merged)
+}
+
+func attrsFrom(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+func hasKey(attrs []slog.Attr, key string) bool {
+	for _, a := range attrs {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// contextHandler puts attrs carried by the context before the ones of the record,
+// skipping those the record has too, so a key isn't repeated in a line.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, rec slog.Record) error {
+	carried := attrsFrom(ctx)
+	if len(carried) == 0 {
+		return h.Handler.Handle(ctx, rec)
+	}
+	own := make([]slog.Attr, 0, rec.NumAttrs())
+	rec.Attrs(func(a slog.Attr) bool {
+		own = append(own, a)
+		return true
+	})
+	out := slog.NewRecord(rec.Time, rec.Level, rec.Message, rec.PC)
+	for _, a := range carried {
+		if !hasKey(own, a.Key) {
+			out.AddAttrs(a)
+		}
+	}
+	out.AddAttrs(own...)
+	return h.Handler.Handle(ctx, out)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,88 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"dmmak/simple-rest-crud/internal/logging"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		expLine string
+		expErr  bool
+	}{
+		{name: "text", format: logging.FormatText, expLine: `level=INFO msg=saved post_id=p1`},
+		{name: "json", format: logging.FormatJSON, expLine: `"level":"INFO","msg":"saved","post_id":"p1"}`},
+		{name: "unknown", format: "xml", expErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			logger, err := logging.New(buf, test.format, slog.LevelInfo)
+			if test.expErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			logger.Info("saved", logging.KeyPostID, "p1")
+			logger.Debug("dropped")
+			assert.Contains(t, buf.String(), test.expLine)
+			assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+		})
+	}
+}
+
+func TestContextFields(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger, err := logging.New(buf, logging.FormatText, slog.LevelInfo)
+	assert.NoError(t, err)
+
+	ctx := logging.With(context.Background(), slog.String(logging.KeyRequestID, "r1"), slog.String(logging.KeyPostID, "p1"))
+	ctx = logging.With(ctx, slog.String(logging.KeyOp, "GetPost"), slog.String(logging.KeyPostID, "p2"))
+	logger.InfoContext(ctx, "got")
+	logger.InfoContext(ctx, "own post", logging.KeyPostID, "p3")
+	logger.With("component", "repo").InfoContext(ctx, "derived")
+	logger.Info("no context")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Len(t, lines, 4)
+	assert.Contains(t, lines[0], "msg=got request_id=r1 op=GetPost post_id=p2")
+	assert.Contains(t, lines[1], "msg=\"own post\" request_id=r1 op=GetPost post_id=p3")
+	assert.Equal(t, 1, strings.Count(lines[1], "post_id="))
+	assert.Contains(t, lines[2], "msg=derived component=repo request_id=r1 op=GetPost post_id=p2")
+	assert.NotContains(t, lines[3], "request_id")
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		level    string
+		expLevel slog.Level
+		expErr   bool
+	}{
+		{level: "debug", expLevel: slog.LevelDebug},
+		{level: "INFO", expLevel: slog.LevelInfo},
+		{level: "warn", expLevel: slog.LevelWarn},
+		{level: "error", expLevel: slog.LevelError},
+		{level: "info+2", expLevel: slog.LevelInfo + 2},
+		{level: "verbose", expErr: true},
+		{level: "", expErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.level, func(t *testing.T) {
+			level, err := logging.ParseLevel(test.level)
+			if test.expErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expLevel, level)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"dmmak/simple-rest-crud/internal/cache"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type cacheCollector struct {
+	stats func() cache.Stats
+
+	hits          *prometheus.Desc
+	misses        *prometheus.Desc
+	invalidations *prometheus.Desc
+	errors        *prometheus.Desc
+	evictions     *prometheus.Desc
+	expirations   *prometheus.Desc
+	entries       *prometheus.Desc
+	comments      *prometheus.Desc
+}
+
+// NewCacheCollector exports the counters returned by stats, e.g. cache.PostsRepo.Stats,
+// as cache_* metrics read on every scrape.
+func NewCacheCollector(stats func() cache.Stats) prometheus.Collector {
+	desc := func(name string, help string) *prometheus.Desc {
+		return prometheus.NewDesc(name, help, nil, prometheus.Labels{"cache": "posts"})
+	}
+	return &cacheCollector{
+		stats:         stats,
+		hits:          desc("cache_hits_total", "Number of posts served from the cache."),
+		misses:        desc("cache_misses_total", "Number of posts loaded from the repository."),
+		invalidations: desc("cache_invalidations_total", "Number of posts invalidated by writes."),
+		errors:        desc("cache_errors_total", "Number of failed cache store calls."),
+		evictions:     desc("cache_evictions_total", "Number of posts evicted from the in-process cache."),
+		expirations:   desc("cache_expirations_total", "Number of posts expired in the in-process cache."),
+		entries:       desc("cache_entries", "Number of posts kept in the in-process cache."),
+		comments:      desc("cache_comments", "Number of comments of posts kept in the in-process cache."),
+	}
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.hits, c.misses, c.invalidations, c.errors, c.evictions, c.expirations, c.entries, c.comments} {
+		ch <- d
+	}
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+	counter := func(d *prometheus.Desc, v uint64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, float64(v))
+	}
+	counter(c.hits, stats.Hits)
+	counter(c.misses, stats.Misses)
+	counter(c.invalidations, stats.Invalidations)
+	counter(c.errors, stats.Errors)
+	counter(c.evictions, stats.Evictions)
+	counter(c.expirations, stats.Expirations)
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(stats.Entries))
+	ch <- prometheus.MustNewConstMetric(c.comments, prometheus.GaugeValue, float64(stats.Comments))
+}
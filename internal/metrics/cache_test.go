@@ -0,0 +1,38 @@
+package metrics_test
+
+import (
+	"dmmak/simple-rest-crud/internal/cache"
+	"dmmak/simple-rest-crud/internal/metrics"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheCollector(t *testing.T) {
+	stats := cache.Stats{Hits: 5, Misses: 2, Invalidations: 1, Entries: 3, Comments: 7}
+	collector := metrics.NewCacheCollector(func() cache.Stats { return stats })
+
+	err := testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP cache_entries Number of posts kept in the in-process cache.
+# TYPE cache_entries gauge
+cache_entries{cache="posts"} 3
+# HELP cache_hits_total Number of posts served from the cache.
+# TYPE cache_hits_total counter
+cache_hits_total{cache="posts"} 5
+# HELP cache_misses_total Number of posts loaded from the repository.
+# TYPE cache_misses_total counter
+cache_misses_total{cache="posts"} 2
+`), "cache_entries", "cache_hits_total", "cache_misses_total")
+	assert.Nil(t, err)
+
+	// stats are read on every scrape
+	stats.Hits = 6
+	err = testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP cache_hits_total Number of posts served from the cache.
+# TYPE cache_hits_total counter
+cache_hits_total{cache="posts"} 6
+`), "cache_hits_total")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,118 @@
+// Package metrics instruments repositories and the posts cache with Prometheus metrics.
+package metrics
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Kinds of errors counted by repo_errors_total, kindInternal covers unclassified ones.
+const (
+	kindNotFound        = "not_found"
+	kindLikesOutOfRange = "likes_out_of_range"
+	kindVersionMismatch = "version_mismatch"
+	kindConflict        = "conflict"
+	kindValidation      = "validation"
+	kindUnavailable     = "unavailable"
+	kindCanceled        = "canceled"
+	kindTimeout         = "timeout"
+	kindInternal        = "internal"
+)
+
+type postsRepo struct {
+	repo     handler.RedditPostsRepo
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// NewPostsRepo observes the latency and counts the errors of every call made to repo,
+// registering repo_call_duration_seconds and repo_errors_total with reg. Both are labeled
+// with the repository and its method, errors with their kind too.
+func NewPostsRepo(repo handler.RedditPostsRepo, reg prometheus.Registerer) handler.RedditPostsRepo {
+	labels := prometheus.Labels{"repo": "posts"}
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "repo_call_duration_seconds",
+		Help:        "Latency of repository calls by method.",
+		Buckets:     prometheus.DefBuckets,
+		ConstLabels: labels,
+	}, []string{"method"})
+	errs := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "repo_errors_total",
+		Help:        "Number of errors returned by repository calls by method and kind.",
+		ConstLabels: labels,
+	}, []string{"method", "kind"})
+	reg.MustRegister(duration, errs)
+	return &postsRepo{repo: repo, duration: duration, errors: errs}
+}
+
+func (m *postsRepo) Save(ctx context.Context, post *entity.RedditPost, onConflict handler.ConflictPolicy, version uint64) (created bool, err error) {
+	defer m.observe("Save", time.Now(), &err)
+	return m.repo.Save(ctx, post, onConflict, version)
+}
+
+func (m *postsRepo) Get(ctx context.Context, postID string) (post *entity.RedditPost, found bool, err error) {
+	defer m.observe("Get", time.Now(), &err)
+	return m.repo.Get(ctx, postID)
+}
+
+func (m *postsRepo) Revision(ctx context.Context, postID string) (rev handler.Revision, found bool, err error) {
+	defer m.observe("Revision", time.Now(), &err)
+	return m.repo.Revision(ctx, postID)
+}
+
+func (m *postsRepo) Delete(ctx context.Context, postID string, version uint64) (found bool, err error) {
+	defer m.observe("Delete", time.Now(), &err)
+	return m.repo.Delete(ctx, postID, version)
+}
+
+func (m *postsRepo) List(ctx context.Context, afterID string, limit int) (posts []*entity.RedditPost, err error) {
+	defer m.observe("List", time.Now(), &err)
+	return m.repo.List(ctx, afterID, limit)
+}
+
+func (m *postsRepo) Update(ctx context.Context, post *entity.RedditPost, version uint64) (found bool, err error) {
+	defer m.observe("Update", time.Now(), &err)
+	return m.repo.Update(ctx, post, version)
+}
+
+func (m *postsRepo) Like(ctx context.Context, postID string, delta int) (likes uint32, found bool, err error) {
+	defer m.observe("Like", time.Now(), &err)
+	return m.repo.Like(ctx, postID, delta)
+}
+
+// observe records a call of method started at start once it returns, it's deferred with
+// a pointer to the call's named error.
+func (m *postsRepo) observe(method string, start time.Time, err *error) {
+	m.duration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		m.errors.WithLabelValues(method, errorKind(*err)).Inc()
+	}
+}
+
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, handler.ErrNotFound):
+		return kindNotFound
+	case errors.Is(err, handler.ErrLikesOutOfRange):
+		return kindLikesOutOfRange
+	case errors.Is(err, handler.ErrVersionMismatch):
+		return kindVersionMismatch
+	case errors.Is(err, handler.ErrConflict):
+		return kindConflict
+	case errors.Is(err, handler.ErrValidation):
+		return kindValidation
+	case errors.Is(err, handler.ErrUnavailable):
+		return kindUnavailable
+	case errors.Is(err, handler.ErrCanceled):
+		return kindCanceled
+	case errors.Is(err, handler.ErrTimeout):
+		return kindTimeout
+	default:
+		return kindInternal
+	}
+}
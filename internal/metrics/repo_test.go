@@ -0,0 +1,62 @@
+package metrics_test
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/metrics"
+	"dmmak/simple-rest-crud/internal/repo"
+	"dmmak/simple-rest-crud/internal/repo/repotest"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// unavailableRepo fails List as a storage that can't be reached does.
+type unavailableRepo struct {
+	handler.RedditPostsRepo
+}
+
+func (r unavailableRepo) List(ctx context.Context, afterID string, limit int) ([]*entity.RedditPost, error) {
+	return nil, fmt.Errorf("can't query 'posts' table: %w", handler.ErrUnavailable)
+}
+
+func TestInstrumentedRepoContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) handler.RedditPostsRepo {
+		return metrics.NewPostsRepo(repo.NewMemRepo(repo.NewMemStore()), prometheus.NewRegistry())
+	})
+}
+
+func TestInstrumentedRepo(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+	posts := metrics.NewPostsRepo(unavailableRepo{repo.NewMemRepo(repo.NewMemStore())}, reg)
+
+	_, err := posts.Save(ctx, &entity.RedditPost{UUID: "p1", Title: "Title"}, handler.ConflictReject, 0)
+	assert.Nil(t, err)
+	_, _, err = posts.Get(ctx, "p1")
+	assert.Nil(t, err)
+	_, err = posts.Save(ctx, &entity.RedditPost{UUID: "p1", Title: "Title"}, handler.ConflictReject, 0)
+	assert.ErrorIs(t, err, handler.ErrConflict)
+	_, err = posts.Update(ctx, &entity.RedditPost{UUID: "p1", Title: "Title"}, 7)
+	assert.ErrorIs(t, err, handler.ErrVersionMismatch)
+	_, err = posts.List(ctx, "", 10)
+	assert.ErrorIs(t, err, handler.ErrUnavailable)
+
+	calls, err := testutil.GatherAndCount(reg, "repo_call_duration_seconds")
+	assert.Nil(t, err)
+	// a series per called method
+	assert.Equal(t, 4, calls)
+	err = testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP repo_errors_total Number of errors returned by repository calls by method and kind.
+# TYPE repo_errors_total counter
+repo_errors_total{kind="conflict",method="Save",repo="posts"} 1
+repo_errors_total{kind="unavailable",method="List",repo="posts"} 1
+repo_errors_total{kind="version_mismatch",method="Update",repo="posts"} 1
+`), "repo_errors_total")
+	assert.Nil(t, err)
+}
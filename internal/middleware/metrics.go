@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// UnmatchedRoute labels requests no handler named a route for, e.g. ones of unknown paths.
+const UnmatchedRoute = "unmatched"
+
+type routeKey struct{}
+
+// SetRoute names the route r is served by, for middlewares labeling requests with it.
+// It does nothing unless r is served through such a middleware, e.g. Metrics.
+func SetRoute(r *http.Request, route string) {
+	if name, ok := r.Context().Value(routeKey{}).(*string); ok {
+		*name = route
+	}
+}
+
+// Metrics counts requests and observes their latency by route and status, registering
+// http_requests_total and http_request_duration_seconds with reg. Routes are named
+// by inner handlers with SetRoute, so paths with IDs don't make a series each.
+func Metrics(reg prometheus.Registerer) Middleware {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of served HTTP requests by route and status.",
+	}, []string{"route", "status"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of served HTTP requests by route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "status"})
+	reg.MustRegister(requests, duration)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			route := UnmatchedRoute
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), routeKey{}, &route)))
+			status := strconv.Itoa(sw.code())
+			requests.WithLabelValues(route, status).Inc()
+			duration.WithLabelValues(route, status).Observe(time.Since(start).Seconds())
+		})
+	}
+}
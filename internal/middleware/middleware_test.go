@@ -0,0 +1,190 @@
+package middleware_test
+
+import (
+	"bytes"
+	"dmmak/simple-rest-crud/internal/logging"
+	"dmmak/simple-rest-crud/internal/middleware"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newLogger(t *testing.T, w io.Writer) *slog.Logger {
+	logger, err := logging.New(w, logging.FormatText, slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logger
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	mw := func(name string) middleware.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := middleware.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	}), mw("outer"), mw("inner"))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, []string{"outer", "inner", "handler"}, calls)
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name  string
+		reqID string
+		expID string
+	}{
+		{name: "generated", expID: "generated-id"},
+		{name: "propagated", reqID: "01H5KZ0X8FQ7J9DTP1C7Y6K3VM", expID: "01H5KZ0X8FQ7J9DTP1C7Y6K3VM"},
+		{name: "malformed", reqID: "id with spaces\n", expID: "generated-id"},
+		{name: "too long", reqID: strings.Repeat("a", 129), expID: "generated-id"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var seen string
+			h := middleware.RequestID(func() string { return "generated-id" })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = middleware.RequestIDFrom(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.reqID != "" {
+				req.Header.Set(middleware.RequestIDHeader, test.reqID)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			assert.Equal(t, test.expID, seen)
+			assert.Equal(t, test.expID, rr.Header().Get(middleware.RequestIDHeader))
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	buf := new(bytes.Buffer)
+	h := middleware.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}), middleware.RequestID(func() string { return "req-1" }), middleware.AccessLog(newLogger(t, buf)))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/post", nil))
+
+	line := buf.String()
+	assert.Contains(t, line, `msg=access request_id=req-1 method=POST path=/post status=201 bytes=7 duration=`)
+	assert.Contains(t, line, " remote=192.0.2.1:1234\n")
+}
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name          string
+		handler       http.HandlerFunc
+		expStatusCode int
+		expLogged     bool
+		expAbort      bool
+	}{
+		{
+			name: "panic before response",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", `"1"`)
+				panic("boom")
+			},
+			expStatusCode: http.StatusInternalServerError,
+			expLogged:     true,
+		},
+		{
+			name: "panic after response started",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				panic("boom")
+			},
+			expStatusCode: http.StatusOK,
+			expLogged:     true,
+			expAbort:      true,
+		},
+		{
+			name: "abort",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic(http.ErrAbortHandler)
+			},
+			expStatusCode: http.StatusOK,
+			expAbort:      true,
+		},
+		{
+			name: "no panic",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			expStatusCode: http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			respond := func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "recovered", http.StatusInternalServerError)
+			}
+			h := middleware.Chain(test.handler,
+				middleware.RequestID(func() string { return "req-1" }),
+				middleware.Recover(newLogger(t, buf), respond))
+			rr := httptest.NewRecorder()
+
+			serve := func() { h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/post", nil)) }
+			if test.expAbort {
+				assert.PanicsWithValue(t, http.ErrAbortHandler, serve)
+			} else {
+				assert.NotPanics(t, serve)
+			}
+
+			assert.Equal(t, test.expStatusCode, rr.Code)
+			if test.expStatusCode == http.StatusInternalServerError {
+				assert.Equal(t, "", rr.Header().Get("ETag"))
+				assert.Equal(t, "req-1", rr.Header().Get(middleware.RequestIDHeader))
+			}
+			if test.expLogged {
+				assert.Contains(t, buf.String(), `level=ERROR msg="panic serving request" request_id=req-1 method=GET path=/post panic=boom`)
+				assert.Contains(t, buf.String(), "goroutine ")
+			} else {
+				assert.Empty(t, buf.String())
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	h := middleware.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/post" {
+			middleware.SetRoute(r, "ListPosts")
+			w.Write([]byte("[]"))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}), middleware.Metrics(reg))
+
+	for _, path := range []string{"/post", "/post", "/nope"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP http_requests_total Number of served HTTP requests by route and status.
+# TYPE http_requests_total counter
+http_requests_total{route="ListPosts",status="200"} 2
+http_requests_total{route="unmatched",status="404"} 1
+`), "http_requests_total")
+	assert.Nil(t, err)
+	series, err := testutil.GatherAndCount(reg, "http_request_duration_seconds")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, series)
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover logs panics of inner handlers with their stack and answers with respond,
+// instead of the connection being dropped with nothing logged. When the response
+// was already started the connection is aborted, so the client doesn't take
+// the partial response for a complete one.
+func Recover(logger *slog.Logger, respond http.HandlerFunc) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w}
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					// a deliberate abort, net/http doesn't log it either
+					panic(v)
+				}
+				logger.LogAttrs(r.Context(), slog.LevelError, "panic serving request",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("panic", fmt.Sprint(v)),
+					slog.String("stack", string(debug.Stack())),
+				)
+				if sw.status != 0 {
+					panic(http.ErrAbortHandler)
+				}
+				// headers set for the response that failed don't apply to respond's
+				for key := range sw.Header() {
+					if key != http.CanonicalHeaderKey(RequestIDHeader) {
+						sw.Header().Del(key)
+					}
+				}
+				respond(sw, r)
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/logging"
+	"log/slog"
+	"net/http"
+)
+
+// RequestIDHeader carries request IDs from clients or proxies and back in responses.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds IDs taken from requests, longer ones are replaced.
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// RequestID keeps the X-Request-ID of a request, or sets one made by newID when
+// it's missing or malformed. The ID is sent back in the response and is available
+// to inner handlers through RequestIDFrom, and it's logged with records of the request.
+func RequestID(newID func() string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+			ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+			ctx = logging.With(ctx, slog.String(logging.KeyRequestID, id))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIDFrom returns the request ID set by RequestID, or an empty string.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts IDs safe to put in log lines and headers as they are.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
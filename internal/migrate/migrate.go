@@ -0,0 +1,262 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//go:embed sql/postgres/*.sql sql/sqlite/*.sql
+var files embed.FS
+
+// lockKey identifies the PostgreSQL advisory lock which keeps concurrently starting
+// instances from applying the same migrations twice.
+const lockKey = 7241563401
+
+// Dialect holds everything specific to a database: its migrations and the SQL
+// to track and lock them.
+type Dialect struct {
+	Name string
+	dir  string
+	// lock and unlock are run on the connection applying migrations, if set.
+	lock          string
+	unlock        string
+	createTable   string
+	selectApplied string
+	insertVersion string
+	deleteVersion string
+}
+
+var (
+	Postgres = Dialect{
+		Name:   "postgres",
+		dir:    "sql/postgres",
+		lock:   fmt.Sprintf("SELECT pg_advisory_lock(%v)", lockKey),
+		unlock: fmt.Sprintf("SELECT pg_advisory_unlock(%v)", lockKey),
+		createTable: `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version bigint PRIMARY KEY,
+				name text NOT NULL,
+				applied_at timestamptz NOT NULL DEFAULT now())`,
+		selectApplied: "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)",
+		insertVersion: "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)",
+		deleteVersion: "DELETE FROM schema_migrations WHERE version = $1",
+	}
+	// SQLite has no advisory locks, concurrent migrators are serialized by the
+	// database write lock each migration's transaction takes.
+	SQLite = Dialect{
+		Name: "sqlite",
+		dir:  "sql/sqlite",
+		createTable: `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version INTEGER PRIMARY KEY,
+				name TEXT NOT NULL,
+				applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP)`,
+		selectApplied: "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = ?)",
+		insertVersion: "INSERT INTO schema_migrations (version, name) VALUES (?, ?)",
+		deleteVersion: "DELETE FROM schema_migrations WHERE version = ?",
+	}
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+var fileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load returns migrations of dialect embedded into the binary ordered by version.
+func Load(dialect Dialect) ([]Migration, error) {
+	return load(files, dialect.dir)
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read migrations dir: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		m := fileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", e.Name())
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("can't parse version of %q: %w", e.Name(), err)
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("can't read migration %q: %w", e.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		} else if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %v has two names: %q and %q", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(b)
+		} else {
+			migration.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %v_%v must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+func New(db *sql.DB, dialect Dialect) (*Migrator, error) {
+	migrations, err := Load(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// Up applies all pending migrations, each in its own transaction, and returns their versions.
+func (m *Migrator) Up(ctx context.Context) (applied []int, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn, current int) error {
+		for _, migration := range m.migrations {
+			if migration.Version <= current {
+				continue
+			}
+			done := false
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				// checked again within the transaction, as another migrator may be done with it
+				// if the dialect has no lock
+				err := tx.QueryRowContext(ctx, m.dialect.selectApplied, migration.Version).Scan(&done)
+				if err != nil || done {
+					return err
+				}
+				if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+					return err
+				}
+				_, err = tx.ExecContext(ctx, m.dialect.insertVersion, migration.Version, migration.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("can't apply migration %v_%v: %w", migration.Version, migration.Name, err)
+			}
+			if !done {
+				applied = append(applied, migration.Version)
+			}
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts up to steps most recent migrations and returns their versions.
+func (m *Migrator) Down(ctx context.Context, steps int) (reverted []int, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn, current int) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if migration.Version > current {
+				continue
+			}
+			applied := true
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				err := tx.QueryRowContext(ctx, m.dialect.selectApplied, migration.Version).Scan(&applied)
+				if err != nil || !applied {
+					return err
+				}
+				if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+					return err
+				}
+				_, err = tx.ExecContext(ctx, m.dialect.deleteVersion, migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("can't revert migration %v_%v: %w", migration.Version, migration.Name, err)
+			}
+			if applied {
+				reverted = append(reverted, migration.Version)
+			}
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Version returns the version of the most recent applied migration, 0 if there are none.
+func (m *Migrator) Version(ctx context.Context) (version int, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn, current int) error {
+		version = current
+		return nil
+	})
+	return version, err
+}
+
+// withLock runs fn on a single connection holding the migrations lock of the dialect, if it has one.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn, current int) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("can't get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if m.dialect.lock != "" {
+		if _, err := conn.ExecContext(ctx, m.dialect.lock); err != nil {
+			return fmt.Errorf("can't acquire migrations lock: %w", err)
+		}
+		defer func() {
+			// the lock is released with the session anyway, so a failed unlock only needs reporting
+			if _, unlockErr := conn.ExecContext(context.Background(), m.dialect.unlock); unlockErr != nil && err == nil {
+				err = fmt.Errorf("can't release migrations lock: %w", unlockErr)
+			}
+		}()
+	}
+
+	_, err = conn.ExecContext(ctx, m.dialect.createTable)
+	if err != nil {
+		return fmt.Errorf("can't create schema_migrations table: %w", err)
+	}
+	var current int
+	err = conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return fmt.Errorf("can't query current schema version: %w", err)
+	}
+	return fn(conn, current)
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't create tx: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("can't rollback tx: %w, err: %w", rbErr, err)
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("can't commit tx: %w", err)
+	}
+	return nil
+}
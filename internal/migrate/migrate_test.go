@@ -0,0 +1,90 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	postgres, err := Load(Postgres)
+	if err != nil {
+		t.Fatalf("can't load embedded postgres migrations: %s", err)
+	}
+	sqlite, err := Load(SQLite)
+	if err != nil {
+		t.Fatalf("can't load embedded sqlite migrations: %s", err)
+	}
+	// both schemas evolve together, so a backend can be swapped at any version
+	if !assert.Equal(t, len(postgres), len(sqlite)) {
+		return
+	}
+	for i, m := range postgres {
+		assert.Equal(t, i+1, m.Version, "versions must be sequential")
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+		assert.Equal(t, m.Version, sqlite[i].Version)
+		assert.Equal(t, m.Name, sqlite[i].Name)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       fstest.MapFS
+		expVersions []int
+		expErr      bool
+	}{
+		{
+			name: "ordered by version",
+			files: fstest.MapFS{
+				"sql/0010_b.up.sql":   {Data: []byte("up b")},
+				"sql/0010_b.down.sql": {Data: []byte("down b")},
+				"sql/0002_a.up.sql":   {Data: []byte("up a")},
+				"sql/0002_a.down.sql": {Data: []byte("down a")},
+			},
+			expVersions: []int{2, 10},
+		},
+		{
+			name: "missing down",
+			files: fstest.MapFS{
+				"sql/0001_a.up.sql": {Data: []byte("up a")},
+			},
+			expErr: true,
+		},
+		{
+			name: "conflicting names",
+			files: fstest.MapFS{
+				"sql/0001_a.up.sql":   {Data: []byte("up a")},
+				"sql/0001_b.down.sql": {Data: []byte("down b")},
+			},
+			expErr: true,
+		},
+		{
+			name: "unexpected file",
+			files: fstest.MapFS{
+				"sql/README.md": {Data: []byte("docs")},
+			},
+			expErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			migrations, err := load(test.files, "sql")
+			if test.expErr {
+				assert.Error(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("can't load migrations: %s", err)
+			}
+			versions := []int{}
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+			}
+			assert.Equal(t, test.expVersions, versions)
+		})
+	}
+}
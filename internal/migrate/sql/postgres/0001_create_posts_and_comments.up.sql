@@ -0,0 +1,12 @@
+CREATE TABLE posts (
+	uuid varchar(36) PRIMARY KEY,
+	title varchar(256),
+	likes smallint
+);
+
+CREATE TABLE comments (
+	uuid varchar(36) PRIMARY KEY,
+	post_uuid varchar(36) CONSTRAINT post_fk REFERENCES posts(uuid) ON DELETE CASCADE,
+	body varchar(4000),
+	likes smallint
+);
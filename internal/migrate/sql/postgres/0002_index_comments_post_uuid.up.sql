@@ -0,0 +1 @@
+CREATE INDEX comments_post_uuid_idx ON comments (post_uuid);
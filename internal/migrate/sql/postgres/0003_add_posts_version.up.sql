@@ -0,0 +1 @@
+ALTER TABLE posts ADD COLUMN version bigint NOT NULL DEFAULT 1;
@@ -0,0 +1 @@
+ALTER TABLE posts ADD COLUMN updated_at timestamptz NOT NULL DEFAULT now();
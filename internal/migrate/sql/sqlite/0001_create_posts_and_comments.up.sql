@@ -0,0 +1,14 @@
+-- SQLite doesn't enforce varchar lengths and smallint ranges, so CHECK constraints
+-- reject the same values the PostgreSQL columns do.
+CREATE TABLE posts (
+	uuid TEXT NOT NULL PRIMARY KEY CHECK (length(uuid) <= 36),
+	title TEXT CHECK (length(title) <= 256),
+	likes INTEGER CHECK (likes BETWEEN -32768 AND 32767)
+);
+
+CREATE TABLE comments (
+	uuid TEXT NOT NULL PRIMARY KEY CHECK (length(uuid) <= 36),
+	post_uuid TEXT CONSTRAINT post_fk REFERENCES posts(uuid) ON DELETE CASCADE,
+	body TEXT CHECK (length(body) <= 4000),
+	likes INTEGER CHECK (likes BETWEEN -32768 AND 32767)
+);
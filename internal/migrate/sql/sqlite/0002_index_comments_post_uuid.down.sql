@@ -0,0 +1 @@
+DROP INDEX comments_post_uuid_idx;
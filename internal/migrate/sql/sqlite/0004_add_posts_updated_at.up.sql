@@ -0,0 +1,3 @@
+-- Unix milliseconds. ADD COLUMN can't default to the current time, so writes set it.
+ALTER TABLE posts ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+UPDATE posts SET updated_at = CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER);
@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// Drivers selected by the DSN scheme.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+const sqliteScheme = "sqlite://"
+
+// sqlitePragmas are applied to every SQLite connection: foreign keys make comment deletion
+// cascade like in PostgreSQL, immediate transactions and the busy timeout make concurrent
+// writers wait for each other instead of failing.
+const sqlitePragmas = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+
+// Pool configures the connection pool of sql.DB, zero durations mean no limit.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// DriverOf returns the driver selected by the scheme of dsn: postgres:// and postgresql://
+// select PostgreSQL, sqlite:// selects SQLite with the database file path following the scheme.
+// DSNs without a scheme are PostgreSQL keyword/value connection strings.
+func DriverOf(dsn string) (string, error) {
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return DriverPostgres, nil
+	case strings.HasPrefix(dsn, sqliteScheme):
+		return DriverSQLite, nil
+	case !strings.Contains(dsn, "://"):
+		return DriverPostgres, nil
+	default:
+		return "", fmt.Errorf("DSN scheme must be postgres://, postgresql:// or %v", sqliteScheme)
+	}
+}
+
+// Open opens the database dsn points to with the driver selected by DriverOf.
+func Open(ctx context.Context, dsn string, pool Pool) (db *sql.DB, driver string, err error) {
+	driver, err = DriverOf(dsn)
+	if err != nil {
+		return nil, "", err
+	}
+	if driver == DriverSQLite {
+		db, err = OpenSQLite(ctx, strings.TrimPrefix(dsn, sqliteScheme), pool)
+	} else {
+		db, err = OpenPG(ctx, dsn, pool)
+	}
+	return db, driver, err
+}
+
+// OpenPG opens a PostgreSQL pool over the pgx driver and checks that the server is reachable.
+func OpenPG(ctx context.Context, connStr string, pool Pool) (*sql.DB, error) {
+	db, err := sql.Open("pgx", connStr)
+	if err != nil {
+		return nil, fmt.Errorf("can't open db: %w", err)
+	}
+	return configure(ctx, db, pool)
+}
+
+// OpenSQLite opens the SQLite database file at path, creating it if it doesn't exist.
+// path may carry query parameters of modernc.org/sqlite.
+func OpenSQLite(ctx context.Context, path string, pool Pool) (*sql.DB, error) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	db, err := sql.Open("sqlite", path+sep+sqlitePragmas)
+	if err != nil {
+		return nil, fmt.Errorf("can't open db: %w", err)
+	}
+	return configure(ctx, db, pool)
+}
+
+func configure(ctx context.Context, db *sql.DB, pool Pool) (*sql.DB, error) {
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't connect to db: %w", classify(err))
+	}
+	return db, nil
+}
@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"context"
+	"database/sql/driver"
+	"dmmak/simple-rest-crud/internal/handler"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// PostgreSQL SQLSTATE codes and classes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+	notNullViolation    = "23502"
+	checkViolation      = "23514"
+	// cardinalityViolation is raised by ON CONFLICT DO UPDATE affecting a row twice,
+	// i.e. by a repeated uuid among the inserted rows
+	cardinalityViolation = "21000"
+	// deadlockDetected aborts one of writes locking a post and its comments in opposite order
+	deadlockDetected = "40P01"
+
+	dataExceptionClass        = "22"
+	connectionExceptionClass  = "08"
+	insufficientResourceClass = "53"
+	operatorInterventionClass = "57"
+	queryCanceled             = "57014"
+)
+
+// classify wraps a database error with the handler sentinel error matching its cause,
+// so callers can tell conflicts and invalid data from outages and bugs.
+func classify(err error) error {
+	// checked first, as pgx also reports them with net errors of the interrupted connection
+	switch {
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("%w: %w", handler.ErrCanceled, err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", handler.ErrTimeout, err)
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == uniqueViolation, pgErr.Code == cardinalityViolation, pgErr.Code == deadlockDetected:
+			return fmt.Errorf("%w: %w", handler.ErrConflict, err)
+		case pgErr.Code == foreignKeyViolation:
+			return fmt.Errorf("%w: %w", handler.ErrNotFound, err)
+		case pgErr.Code == queryCanceled:
+			// canceled by statement_timeout or by pgx on context cancellation
+			return fmt.Errorf("%w: %w", handler.ErrTimeout, err)
+		case pgErr.Code == notNullViolation, pgErr.Code == checkViolation, strings.HasPrefix(pgErr.Code, dataExceptionClass):
+			return fmt.Errorf("%w: %w", handler.ErrValidation, err)
+		case strings.HasPrefix(pgErr.Code, connectionExceptionClass),
+			strings.HasPrefix(pgErr.Code, insufficientResourceClass),
+			strings.HasPrefix(pgErr.Code, operatorInterventionClass):
+			return fmt.Errorf("%w: %w", handler.ErrUnavailable, err)
+		}
+		return err
+	}
+
+	var liteErr *sqlite.Error
+	if errors.As(err, &liteErr) {
+		switch code := liteErr.Code(); {
+		case code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY, code == sqlite3.SQLITE_CONSTRAINT_UNIQUE:
+			return fmt.Errorf("%w: %w", handler.ErrConflict, err)
+		case code == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			return fmt.Errorf("%w: %w", handler.ErrNotFound, err)
+		case code == sqlite3.SQLITE_CONSTRAINT_NOTNULL, code == sqlite3.SQLITE_CONSTRAINT_CHECK,
+			code == sqlite3.SQLITE_CONSTRAINT_DATATYPE, code == sqlite3.SQLITE_TOOBIG:
+			return fmt.Errorf("%w: %w", handler.ErrValidation, err)
+		// extended result codes keep the primary one in the lowest byte
+		case code&0xff == sqlite3.SQLITE_INTERRUPT:
+			return fmt.Errorf("%w: %w", handler.ErrTimeout, err)
+		case code&0xff == sqlite3.SQLITE_BUSY, code&0xff == sqlite3.SQLITE_LOCKED, code&0xff == sqlite3.SQLITE_FULL,
+			code&0xff == sqlite3.SQLITE_IOERR, code&0xff == sqlite3.SQLITE_CANTOPEN:
+			return fmt.Errorf("%w: %w", handler.ErrUnavailable, err)
+		}
+		return err
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) || pgconn.SafeToRetry(err) {
+		return fmt.Errorf("%w: %w", handler.ErrUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package repo_it_test
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/repo"
+	"dmmak/simple-rest-crud/internal/repo/repotest"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func postWithComments(id string, n int) *entity.RedditPost {
+	post := &entity.RedditPost{UUID: id, Title: "Post " + id, Comments: make([]*entity.Comment, 0, n)}
+	for i := 0; i < n; i++ {
+		post.Comments = append(post.Comments, &entity.Comment{UUID: fmt.Sprintf("%v-c%v", id, i), Body: "Comment body", Likes: uint32(i % 100)})
+	}
+	return post
+}
+
+// TestSaveBeyondBindParameterLimit saves and updates more comments than a statement with
+// four bind parameters per comment could take, changing bodies of the stored ones.
+func TestSaveBeyondBindParameterLimit(t *testing.T) {
+	repos := map[string]handler.RedditPostsRepo{"database/sql": pg, "pgxpool": repo.NewPGXRepo(pgxPool, slog.Default())}
+	for name, posts := range repos {
+		t.Run(name, func(t *testing.T) {
+			truncate(t)
+			ctx := context.Background()
+			post := postWithComments("p1", 20000)
+			assert.Nil(t, repotest.Save(ctx, posts, post))
+
+			got, found, err := posts.Get(ctx, "p1")
+			assert.Nil(t, err)
+			assert.True(t, found)
+			assert.ElementsMatch(t, post.Comments, got.Comments)
+
+			for _, c := range post.Comments {
+				c.Body = "Changed " + c.UUID
+			}
+			post.Comments = append(post.Comments, postWithComments("p2", 20000).Comments...)
+			found, err = posts.Update(ctx, post, 0)
+			assert.Nil(t, err)
+			assert.True(t, found)
+			got, _, _ = posts.Get(ctx, "p1")
+			assert.Len(t, got.Comments, 40000)
+			assert.ElementsMatch(t, post.Comments, got.Comments)
+		})
+	}
+}
+
+// BenchmarkSaveComments reports throughput of saving a post with growing comment sets,
+// run with: go test -run ^$ -bench SaveComments ./internal/repo/it/
+func BenchmarkSaveComments(b *testing.B) {
+	repos := []struct {
+		name  string
+		posts handler.RedditPostsRepo
+	}{
+		{"database/sql", pg},
+		{"pgxpool", repo.NewPGXRepo(pgxPool, slog.Default())},
+	}
+	for _, r := range repos {
+		for _, n := range []int{10, 1000, 100000} {
+			b.Run(fmt.Sprintf("%v/comments=%v", r.name, n), func(b *testing.B) {
+				ctx := context.Background()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					if _, err := pgDB.Exec("TRUNCATE posts, comments"); err != nil {
+						b.Fatalf("can't truncate tables: %s", err)
+					}
+					post := postWithComments(fmt.Sprintf("p%v", i), n)
+					b.StartTimer()
+
+					if err := repotest.Save(ctx, r.posts, post); err != nil {
+						b.Fatalf("can't save post: %s", err)
+					}
+				}
+				b.ReportMetric(float64(n*b.N)/b.Elapsed().Seconds(), "comments/s")
+			})
+		}
+	}
+}
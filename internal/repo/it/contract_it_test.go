@@ -0,0 +1,61 @@
+package repo_it_test
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/repo"
+	"dmmak/simple-rest-crud/internal/repo/repotest"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// truncate empties the tables now and after the test.
+func truncate(t *testing.T) {
+	empty := func() {
+		if _, err := pgDB.Exec("TRUNCATE posts, comments"); err != nil {
+			t.Fatalf("can't truncate tables: %s", err)
+		}
+	}
+	empty()
+	t.Cleanup(empty)
+}
+
+func TestPGRepoContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) handler.RedditPostsRepo {
+		truncate(t)
+		return repo.NewPGRepo(pgDB, slog.Default())
+	})
+}
+
+func TestPGXRepoContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) handler.RedditPostsRepo {
+		truncate(t)
+		return repo.NewPGXRepo(pgxPool, slog.Default())
+	})
+}
+
+func TestPGXRepoCopiesLargeCommentSets(t *testing.T) {
+	truncate(t)
+	ctx := context.Background()
+	posts := repo.NewPGXRepo(pgxPool, slog.Default())
+	post := &entity.RedditPost{UUID: "p1", Title: "Post", Comments: []*entity.Comment{}}
+	for i := 0; i < 1000; i++ {
+		post.Comments = append(post.Comments, &entity.Comment{UUID: fmt.Sprintf("c%v", i), Body: "Body", Likes: 1})
+	}
+	assert.Nil(t, repotest.Save(ctx, posts, post))
+
+	got, found, err := posts.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.ElementsMatch(t, post.Comments, got.Comments)
+
+	duplicate := &entity.RedditPost{UUID: "p2", Title: "Post", Comments: post.Comments}
+	assert.ErrorIs(t, repotest.Save(ctx, posts, duplicate), handler.ErrConflict)
+	_, found, err = posts.Get(ctx, "p2")
+	assert.Nil(t, err)
+	assert.False(t, found, "failed copy must roll the post back")
+}
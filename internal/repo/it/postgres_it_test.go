@@ -5,16 +5,26 @@ import (
 	"database/sql"
 	"dmmak/simple-rest-crud/internal/entity"
 	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/migrate"
 	"dmmak/simple-rest-crud/internal/repo"
+	"dmmak/simple-rest-crud/internal/repo/repotest"
 	"log"
+	"log/slog"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/stretchr/testify/assert"
 )
 
-var pg handler.RedditPostsRepo
+var (
+	pgDB       *sql.DB
+	pgxPool    *pgxpool.Pool
+	pg         handler.RedditPostsRepo
+	pgComments handler.CommentsRepo
+)
 
 func TestMain(m *testing.M) {
 	pgUrl := os.Getenv("PG_URL")
@@ -24,32 +34,35 @@ func TestMain(m *testing.M) {
 	}
 	defer db.Close()
 
-	//TODO make migrate conf
+	// PG_URL sets search_path=test, so migrations create tables in the fresh test schema
 	_, err = db.Exec("drop schema if exists test cascade")
 	if err != nil {
 		log.Fatalf("can't drop test schema: %s", err)
 	}
 	_, err = db.Exec("create schema test")
 	if err != nil {
-		log.Fatalf(("can't create test schema"))
+		log.Fatalf("can't create test schema: %s", err)
 	}
-	_, err = db.Exec("create table test.posts (uuid varchar(8) primary key, title varchar(256), likes smallint)")
+	migrator, err := migrate.New(db, migrate.Postgres)
 	if err != nil {
-		log.Fatalf(("can't create table posts"))
+		log.Fatalf("can't load migrations: %s", err)
 	}
-	_, err = db.Exec(`
-		create table test.comments (
-			uuid varchar(8) primary key, 
-			post_uuid varchar(8) CONSTRAINT post_fk REFERENCES test.posts(uuid) ON DELETE CASCADE, 
-			body varchar(4000), 
-			likes smallint);
-	`)
+	_, err = migrator.Up(context.Background())
 	if err != nil {
-		log.Fatalf(("can't create table comments"))
+		log.Fatalf("can't migrate test schema: %s", err)
 	}
 	defer db.Exec("drop schema test cascade")
 
-	pg = repo.NewPGRepo(db)
+	pool, err := repo.OpenPGX(context.Background(), pgUrl, repo.Pool{MaxOpenConns: 10})
+	if err != nil {
+		log.Fatalf("can't open pgx pool: %s", err)
+	}
+	defer pool.Close()
+
+	pgDB = db
+	pgxPool = pool
+	pg = repo.NewPGRepo(db, slog.Default())
+	pgComments = repo.NewPGCommentsRepo(db, slog.Default())
 
 	code := m.Run()
 	os.Exit(code)
@@ -75,7 +88,7 @@ func TestSavePostWithCommentsThenGet(t *testing.T) {
 		},
 	}
 	expectedPost.Comments = comments
-	err := pg.Save(context.Background(), expectedPost)
+	err := repotest.Save(context.Background(), pg, expectedPost)
 	if err != nil {
 		t.Fatalf("error while saving post: %s", err)
 	}
@@ -104,11 +117,11 @@ func TestSavePostWithCommentsThenDelete(t *testing.T) {
 	}
 	post.Comments = comments
 
-	err := pg.Save(context.Background(), post)
+	err := repotest.Save(context.Background(), pg, post)
 	if err != nil {
 		t.Fatalf("error while saving post: %s", err)
 	}
-	found, err := pg.Delete(context.Background(), "pDelete")
+	found, err := pg.Delete(context.Background(), "pDelete", 0)
 	if err != nil {
 		t.Fatalf("error while deleting post, uuid=%v: %s", post.UUID, err)
 	}
@@ -120,3 +133,292 @@ func TestSavePostWithCommentsThenDelete(t *testing.T) {
 	}
 	assert.False(t, found)
 }
+
+func TestSavePostWithCommentsThenUpdate(t *testing.T) {
+	post := &entity.RedditPost{
+		UUID:  "pUpdate",
+		Title: "Test reddit post with typo",
+		Likes: 1,
+		Comments: []*entity.Comment{
+			{
+				UUID:  "cUpd1",
+				Body:  "Comment body to keep",
+				Likes: 1,
+			},
+			{
+				UUID:  "cUpd2",
+				Body:  "Comment body to change",
+				Likes: 2,
+			},
+			{
+				UUID:  "cUpd3",
+				Body:  "Comment body to delete",
+				Likes: 3,
+			},
+		},
+	}
+	err := repotest.Save(context.Background(), pg, post)
+	if err != nil {
+		t.Fatalf("error while saving post: %s", err)
+	}
+
+	updatedPost := &entity.RedditPost{
+		UUID:  "pUpdate",
+		Title: "Test reddit post without typo",
+		Likes: 7,
+		Comments: []*entity.Comment{
+			{
+				UUID: "cUpd1",
+				Body: "Comment body to keep",
+			},
+			{
+				UUID:  "cUpd2",
+				Body:  "Comment body changed",
+				Likes: 5,
+			},
+			{
+				UUID: "cUpd4",
+				Body: "Comment body added",
+			},
+		},
+	}
+	// likes of the post and of existing comments are left untouched by Update
+	expectedPost := &entity.RedditPost{
+		UUID:  "pUpdate",
+		Title: "Test reddit post without typo",
+		Likes: 1,
+		Comments: []*entity.Comment{
+			{
+				UUID:  "cUpd1",
+				Body:  "Comment body to keep",
+				Likes: 1,
+			},
+			{
+				UUID:  "cUpd2",
+				Body:  "Comment body changed",
+				Likes: 2,
+			},
+			{
+				UUID: "cUpd4",
+				Body: "Comment body added",
+			},
+		},
+	}
+	found, err := pg.Update(context.Background(), updatedPost, 0)
+	if err != nil {
+		t.Fatalf("error while updating post, uuid=%v: %s", post.UUID, err)
+	}
+	assert.True(t, found)
+
+	actualPost, found, err := pg.Get(context.Background(), "pUpdate")
+	if err != nil {
+		t.Fatalf("error while getting post, uuid=%v: %s", post.UUID, err)
+	}
+	assert.True(t, found)
+	assert.Equal(t, expectedPost.Title, actualPost.Title)
+	assert.Equal(t, expectedPost.Likes, actualPost.Likes)
+	assert.ElementsMatch(t, expectedPost.Comments, actualPost.Comments)
+}
+
+func TestUpdateMissingPost(t *testing.T) {
+	found, err := pg.Update(context.Background(), &entity.RedditPost{UUID: "pMissing", Title: "Nothing"}, 0)
+	if err != nil {
+		t.Fatalf("error while updating post: %s", err)
+	}
+	assert.False(t, found)
+}
+
+func TestListPosts(t *testing.T) {
+	for _, id := range []string{"pList1", "pList2", "pList3"} {
+		post := &entity.RedditPost{
+			UUID:  id,
+			Title: "Test reddit post for listing",
+			Comments: []*entity.Comment{
+				{
+					UUID:  "c" + id,
+					Body:  "Comment body for listing",
+					Likes: 1,
+				},
+			},
+		}
+		err := repotest.Save(context.Background(), pg, post)
+		if err != nil {
+			t.Fatalf("error while saving post: %s", err)
+		}
+	}
+
+	posts, err := pg.List(context.Background(), "pList0", 2)
+	if err != nil {
+		t.Fatalf("error while listing posts: %s", err)
+	}
+	assert.Len(t, posts, 2)
+	assert.Equal(t, "pList1", posts[0].UUID)
+	assert.Equal(t, "pList2", posts[1].UUID)
+	assert.Len(t, posts[0].Comments, 1)
+
+	posts, err = pg.List(context.Background(), "pList2", 2)
+	if err != nil {
+		t.Fatalf("error while listing posts: %s", err)
+	}
+	assert.Equal(t, "pList3", posts[0].UUID)
+}
+
+func TestCommentLifecycle(t *testing.T) {
+	post := &entity.RedditPost{
+		UUID:     "pCmnt",
+		Title:    "Test reddit post for comments",
+		Comments: []*entity.Comment{},
+	}
+	err := repotest.Save(context.Background(), pg, post)
+	if err != nil {
+		t.Fatalf("error while saving post: %s", err)
+	}
+
+	comment := &entity.Comment{
+		UUID:  "cCmnt",
+		Body:  "Comment body",
+		Likes: 1,
+	}
+	version, found, err := pgComments.Save(context.Background(), "pCmnt", comment, 1)
+	if err != nil {
+		t.Fatalf("error while saving comment: %s", err)
+	}
+	assert.True(t, found)
+	assert.Equal(t, uint64(2), version)
+
+	_, found, err = pgComments.Save(context.Background(), "pNoPost", &entity.Comment{UUID: "cNoPost"}, 0)
+	if err != nil {
+		t.Fatalf("error while saving comment: %s", err)
+	}
+	assert.False(t, found)
+
+	comment.Body = "Comment body changed"
+	_, _, err = pgComments.Update(context.Background(), "pCmnt", comment, 1)
+	assert.ErrorIs(t, err, handler.ErrVersionMismatch)
+	version, found, err = pgComments.Update(context.Background(), "pCmnt", comment, 2)
+	if err != nil {
+		t.Fatalf("error while updating comment: %s", err)
+	}
+	assert.True(t, found)
+	assert.Equal(t, uint64(3), version)
+
+	actualComment, found, err := pgComments.Get(context.Background(), "pCmnt", "cCmnt")
+	if err != nil {
+		t.Fatalf("error while getting comment: %s", err)
+	}
+	assert.True(t, found)
+	assert.Equal(t, comment, actualComment)
+
+	_, found, err = pgComments.Get(context.Background(), "p1", "cCmnt")
+	if err != nil {
+		t.Fatalf("error while getting comment: %s", err)
+	}
+	assert.False(t, found)
+
+	_, found, err = pgComments.Delete(context.Background(), "pCmnt", "cCmnt", 0)
+	if err != nil {
+		t.Fatalf("error while deleting comment: %s", err)
+	}
+	assert.True(t, found)
+
+	_, found, err = pgComments.Get(context.Background(), "pCmnt", "cCmnt")
+	if err != nil {
+		t.Fatalf("error while getting comment: %s", err)
+	}
+	assert.False(t, found)
+}
+
+func TestLikePostAndComment(t *testing.T) {
+	post := &entity.RedditPost{
+		UUID:  "pLike",
+		Title: "Test reddit post for likes",
+		Likes: 32766,
+		Comments: []*entity.Comment{
+			{
+				UUID: "cLike",
+				Body: "Comment body for likes",
+			},
+		},
+	}
+	err := repotest.Save(context.Background(), pg, post)
+	if err != nil {
+		t.Fatalf("error while saving post: %s", err)
+	}
+
+	likes, found, err := pg.Like(context.Background(), "pLike", 1)
+	if err != nil {
+		t.Fatalf("error while liking post: %s", err)
+	}
+	assert.True(t, found)
+	assert.Equal(t, uint32(32767), likes)
+
+	_, found, err = pg.Like(context.Background(), "pLike", 1)
+	assert.True(t, found)
+	assert.ErrorIs(t, err, handler.ErrLikesOutOfRange)
+
+	_, found, err = pg.Like(context.Background(), "pNoLike", 1)
+	if err != nil {
+		t.Fatalf("error while liking post: %s", err)
+	}
+	assert.False(t, found)
+
+	likes, found, err = pgComments.Like(context.Background(), "pLike", "cLike", 1)
+	if err != nil {
+		t.Fatalf("error while liking comment: %s", err)
+	}
+	assert.True(t, found)
+	assert.Equal(t, uint32(1), likes)
+
+	likes, found, err = pgComments.Like(context.Background(), "pLike", "cLike", -1)
+	if err != nil {
+		t.Fatalf("error while unliking comment: %s", err)
+	}
+	assert.True(t, found)
+	assert.Equal(t, uint32(0), likes)
+
+	_, found, err = pgComments.Like(context.Background(), "pLike", "cLike", -1)
+	assert.True(t, found)
+	assert.ErrorIs(t, err, handler.ErrLikesOutOfRange)
+}
+
+func TestMigrateDownThenUp(t *testing.T) {
+	ctx := context.Background()
+	migrator, err := migrate.New(pgDB, migrate.Postgres)
+	if err != nil {
+		t.Fatalf("can't load migrations: %s", err)
+	}
+	all, err := migrate.Load(migrate.Postgres)
+	if err != nil {
+		t.Fatalf("can't load migrations: %s", err)
+	}
+
+	reverted, err := migrator.Down(ctx, len(all))
+	assert.Nil(t, err)
+	assert.Len(t, reverted, len(all))
+	version, err := migrator.Version(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, version)
+
+	applied, err := migrator.Up(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, applied, len(all))
+	applied, err = migrator.Up(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, applied, "second run must be a no-op")
+	version, err = migrator.Version(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, all[len(all)-1].Version, version)
+}
+
+func TestCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := pg.Get(ctx, "p1")
+	assert.ErrorIs(t, err, handler.ErrCanceled)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	err = repotest.Save(ctx, pg, &entity.RedditPost{UUID: "pCtx", Title: "Timed out post"})
+	assert.ErrorIs(t, err, handler.ErrTimeout)
+}
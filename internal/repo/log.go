@@ -0,0 +1,24 @@
+package repo
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/logging"
+	"log/slog"
+	"time"
+)
+
+// logCall logs a repository call started at start once it returns, it's deferred with
+// a pointer to the call's named error. Calls are logged at debug level, failed ones too:
+// the handler answering the error logs it once, at error level for failures of the storage.
+func logCall(ctx context.Context, logger *slog.Logger, op string, start time.Time, err *error, attrs ...slog.Attr) {
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	msg := "repo call"
+	attrs = append(attrs, slog.String(logging.KeyRepoOp, op), slog.Duration("duration", time.Since(start)))
+	if *err != nil {
+		msg = "repo call failed"
+		attrs = append(attrs, slog.Any(logging.KeyErr, *err))
+	}
+	logger.LogAttrs(ctx, slog.LevelDebug, msg, attrs...)
+}
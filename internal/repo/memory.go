@@ -0,0 +1,473 @@
+package repo
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Column limits of the posts and comments tables, enforced by MemStore to behave like them.
+const (
+	maxTitleLen = 256
+	maxBodyLen  = 4000
+)
+
+// MemStore keeps posts and their comments in memory. It's shared by the repositories
+// returned by NewMemRepo and NewMemCommentsRepo, like *sql.DB is by the PostgreSQL ones.
+// Stored values are never shared with callers: they're deep-copied on every read and write.
+type MemStore struct {
+	mu    sync.RWMutex
+	posts map[string]*entity.RedditPost
+	// commentPosts maps comment uuid to its post uuid, as comment uuids are unique across posts.
+	commentPosts map[string]string
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{posts: map[string]*entity.RedditPost{}, commentPosts: map[string]string{}}
+}
+
+type memRepo struct {
+	store *MemStore
+}
+
+func NewMemRepo(store *MemStore) handler.RedditPostsRepo {
+	return &memRepo{store}
+}
+
+func (m *memRepo) Save(ctx context.Context, post *entity.RedditPost, onConflict handler.ConflictPolicy, version uint64) (created bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("can't insert new post: %w", classify(err))
+	}
+	if err := checkPost(post); err != nil {
+		return false, fmt.Errorf("can't insert new post: %w", err)
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	stored, ok := m.store.posts[post.UUID]
+	if err := checkVersion(post.UUID, stored, version); err != nil {
+		return false, fmt.Errorf("can't save post: %w", err)
+	}
+	if ok && onConflict == handler.ConflictReject {
+		return false, fmt.Errorf("can't insert new post: %w: post uuid=%v already exists", handler.ErrConflict, post.UUID)
+	}
+	if !ok {
+		if err := m.store.checkNewComments(post.UUID, post.Comments); err != nil {
+			return false, fmt.Errorf("can't insert post's comments: %w", err)
+		}
+		// versions start at 1 whatever the client sent
+		post.Version = 0
+		touch(post)
+		stored = copyPost(post)
+		if stored.Comments == nil {
+			stored.Comments = []*entity.Comment{}
+		}
+		m.store.posts[post.UUID] = stored
+		for _, c := range post.Comments {
+			m.store.commentPosts[c.UUID] = post.UUID
+		}
+		return true, nil
+	}
+
+	if err := m.store.checkUpsertComments(post.UUID, post.Comments); err != nil {
+		return false, fmt.Errorf("can't upsert post's comments: %w", err)
+	}
+	stored.Title = post.Title
+	if onConflict == handler.ConflictOverwrite {
+		for _, c := range stored.Comments {
+			delete(m.store.commentPosts, c.UUID)
+		}
+		stored.Likes = post.Likes
+		stored.Comments = []*entity.Comment{}
+	}
+	for _, c := range post.Comments {
+		if _, old := m.store.comment(post.UUID, c.UUID); old != nil {
+			old.Body = c.Body
+			continue
+		}
+		stored.Comments = append(stored.Comments, copyComment(c))
+		m.store.commentPosts[c.UUID] = post.UUID
+	}
+	touch(stored)
+	post.Version, post.UpdatedAt = stored.Version, stored.UpdatedAt
+	return false, nil
+}
+
+func (m *memRepo) Get(ctx context.Context, postID string) (post *entity.RedditPost, found bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return &entity.RedditPost{}, false, fmt.Errorf("can't query posts: %w", classify(err))
+	}
+
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+	stored, ok := m.store.posts[postID]
+	if !ok {
+		return &entity.RedditPost{}, false, nil
+	}
+	return copyPost(stored), true, nil
+}
+
+func (m *memRepo) Revision(ctx context.Context, postID string) (rev handler.Revision, found bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return rev, false, fmt.Errorf("can't query posts: %w", classify(err))
+	}
+
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+	stored, ok := m.store.posts[postID]
+	if !ok {
+		return rev, false, nil
+	}
+	return handler.Revision{Version: stored.Version, UpdatedAt: stored.UpdatedAt}, true, nil
+}
+
+func (m *memRepo) Delete(ctx context.Context, postID string, version uint64) (found bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("can't delete post: %w", classify(err))
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	stored, ok := m.store.posts[postID]
+	if !ok {
+		return false, nil
+	}
+	if err := checkVersion(postID, stored, version); err != nil {
+		return true, fmt.Errorf("can't delete post: %w", err)
+	}
+	for _, c := range stored.Comments {
+		delete(m.store.commentPosts, c.UUID)
+	}
+	delete(m.store.posts, postID)
+	return true, nil
+}
+
+func (m *memRepo) List(ctx context.Context, afterID string, limit int) (posts []*entity.RedditPost, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("can't query posts: %w", classify(err))
+	}
+
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+	ids := make([]string, 0, len(m.store.posts))
+	for id := range m.store.posts {
+		if id > afterID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	posts = make([]*entity.RedditPost, 0, len(ids))
+	for _, id := range ids {
+		posts = append(posts, copyPost(m.store.posts[id]))
+	}
+	return posts, nil
+}
+
+// Update keeps likes of the post and of its existing comments, as pgRepo.Update does.
+func (m *memRepo) Update(ctx context.Context, post *entity.RedditPost, version uint64) (found bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("can't update post: %w", classify(err))
+	}
+	if err := checkPost(post); err != nil {
+		return false, fmt.Errorf("can't update post: %w", err)
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	stored, ok := m.store.posts[post.UUID]
+	if !ok {
+		return false, nil
+	}
+	if err := checkVersion(post.UUID, stored, version); err != nil {
+		return true, fmt.Errorf("can't update post: %w", err)
+	}
+	existing := map[string]*entity.Comment{}
+	for _, c := range stored.Comments {
+		existing[c.UUID] = c
+	}
+	added := []*entity.Comment{}
+	for _, c := range post.Comments {
+		if _, ok := existing[c.UUID]; !ok {
+			added = append(added, c)
+		}
+	}
+	if err := m.store.checkNewComments(post.UUID, added); err != nil {
+		return false, fmt.Errorf("can't insert comments: %w", err)
+	}
+
+	comments := make([]*entity.Comment, 0, len(post.Comments))
+	kept := map[string]bool{}
+	for _, c := range post.Comments {
+		kept[c.UUID] = true
+		if old, ok := existing[c.UUID]; ok {
+			comments = append(comments, &entity.Comment{UUID: c.UUID, Body: c.Body, Likes: old.Likes})
+			continue
+		}
+		comments = append(comments, copyComment(c))
+		m.store.commentPosts[c.UUID] = post.UUID
+	}
+	for id := range existing {
+		if !kept[id] {
+			delete(m.store.commentPosts, id)
+		}
+	}
+	stored.Title = post.Title
+	stored.Comments = comments
+	touch(stored)
+	post.Version, post.UpdatedAt = stored.Version, stored.UpdatedAt
+	return true, nil
+}
+
+func (m *memRepo) Like(ctx context.Context, postID string, delta int) (likes uint32, found bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, false, fmt.Errorf("can't update post likes: %w", classify(err))
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	stored, ok := m.store.posts[postID]
+	if !ok {
+		return 0, false, nil
+	}
+	return addLikes(stored, &stored.Likes, delta)
+}
+
+type memCommentsRepo struct {
+	store *MemStore
+}
+
+func NewMemCommentsRepo(store *MemStore) handler.CommentsRepo {
+	return &memCommentsRepo{store}
+}
+
+func (m *memCommentsRepo) Save(ctx context.Context, postID string, comment *entity.Comment, version uint64) (postVersion uint64, found bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, false, fmt.Errorf("can't insert comment: %w", classify(err))
+	}
+	if err := checkComment(comment); err != nil {
+		return 0, false, fmt.Errorf("can't insert comment: %w", err)
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	stored, ok := m.store.posts[postID]
+	if !ok {
+		return 0, false, nil
+	}
+	if err := checkVersion(postID, stored, version); err != nil {
+		return 0, true, fmt.Errorf("can't insert comment: %w", err)
+	}
+	if err := m.store.checkNewComments(postID, []*entity.Comment{comment}); err != nil {
+		return 0, false, fmt.Errorf("can't insert comment: %w", err)
+	}
+	stored.Comments = append(stored.Comments, copyComment(comment))
+	touch(stored)
+	m.store.commentPosts[comment.UUID] = postID
+	return stored.Version, true, nil
+}
+
+func (m *memCommentsRepo) Get(ctx context.Context, postID string, commentID string) (comment *entity.Comment, found bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return &entity.Comment{}, false, fmt.Errorf("can't query comments: %w", classify(err))
+	}
+
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+	_, stored := m.store.comment(postID, commentID)
+	if stored == nil {
+		return &entity.Comment{}, false, nil
+	}
+	return copyComment(stored), true, nil
+}
+
+func (m *memCommentsRepo) Update(ctx context.Context, postID string, comment *entity.Comment, version uint64) (postVersion uint64, found bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, false, fmt.Errorf("can't update comment: %w", classify(err))
+	}
+	if err := checkComment(comment); err != nil {
+		return 0, false, fmt.Errorf("can't update comment: %w", err)
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	post, stored, err := m.store.versionedComment(postID, comment.UUID, version)
+	if err != nil {
+		return 0, true, fmt.Errorf("can't update comment: %w", err)
+	}
+	if stored == nil {
+		return 0, false, nil
+	}
+	stored.Body = comment.Body
+	touch(post)
+	return post.Version, true, nil
+}
+
+func (m *memCommentsRepo) Delete(ctx context.Context, postID string, commentID string, version uint64) (postVersion uint64, found bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, false, fmt.Errorf("can't delete comment: %w", classify(err))
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	post, stored, err := m.store.versionedComment(postID, commentID, version)
+	if err != nil {
+		return 0, true, fmt.Errorf("can't delete comment: %w", err)
+	}
+	if stored == nil {
+		return 0, false, nil
+	}
+	comments := make([]*entity.Comment, 0, len(post.Comments)-1)
+	for _, c := range post.Comments {
+		if c.UUID != commentID {
+			comments = append(comments, c)
+		}
+	}
+	post.Comments = comments
+	touch(post)
+	delete(m.store.commentPosts, commentID)
+	return post.Version, true, nil
+}
+
+func (m *memCommentsRepo) Like(ctx context.Context, postID string, commentID string, delta int) (likes uint32, found bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, false, fmt.Errorf("can't update comment likes: %w", classify(err))
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	post, stored := m.store.comment(postID, commentID)
+	if stored == nil {
+		return 0, false, nil
+	}
+	return addLikes(post, &stored.Likes, delta)
+}
+
+// comment returns the stored post and its comment, or nils if either doesn't exist.
+// The caller must hold the lock.
+func (s *MemStore) comment(postID string, commentID string) (*entity.RedditPost, *entity.Comment) {
+	if s.commentPosts[commentID] != postID {
+		return nil, nil
+	}
+	post := s.posts[postID]
+	for _, c := range post.Comments {
+		if c.UUID == commentID {
+			return post, c
+		}
+	}
+	return nil, nil
+}
+
+// versionedComment is comment that fails with ErrVersionMismatch when the post exists
+// at another version than the non-zero version. The caller must hold the lock.
+func (s *MemStore) versionedComment(postID string, commentID string, version uint64) (*entity.RedditPost, *entity.Comment, error) {
+	if post, ok := s.posts[postID]; ok {
+		if err := checkVersion(postID, post, version); err != nil {
+			return nil, nil, err
+		}
+	}
+	post, comment := s.comment(postID, commentID)
+	return post, comment, nil
+}
+
+// checkNewComments fails with ErrConflict if a comment uuid is already taken, by any post,
+// or repeats within comments. The caller must hold the lock.
+func (s *MemStore) checkNewComments(postID string, comments []*entity.Comment) error {
+	seen := map[string]bool{}
+	for _, c := range comments {
+		if _, ok := s.commentPosts[c.UUID]; ok || seen[c.UUID] {
+			return fmt.Errorf("%w: comment uuid=%v already exists", handler.ErrConflict, c.UUID)
+		}
+		seen[c.UUID] = true
+	}
+	return nil
+}
+
+// checkUpsertComments fails with ErrConflict if a comment uuid is taken by another post
+// or repeats within comments. The caller must hold the lock.
+func (s *MemStore) checkUpsertComments(postID string, comments []*entity.Comment) error {
+	if id, ok := repeatedComment(comments); ok {
+		return fmt.Errorf("%w: comment uuid=%v is repeated", handler.ErrConflict, id)
+	}
+	for _, c := range comments {
+		if owner, ok := s.commentPosts[c.UUID]; ok && owner != postID {
+			return fmt.Errorf("%w: comment uuid=%v belongs to another post", handler.ErrConflict, c.UUID)
+		}
+	}
+	return nil
+}
+
+// checkPost and checkComment reject values the posts and comments columns can't hold.
+func checkPost(post *entity.RedditPost) error {
+	if utf8.RuneCountInString(post.Title) > maxTitleLen {
+		return fmt.Errorf("%w: title is longer than %v characters", handler.ErrValidation, maxTitleLen)
+	}
+	if post.Likes > maxLikes {
+		return fmt.Errorf("%w: likes are out of range", handler.ErrValidation)
+	}
+	for _, c := range post.Comments {
+		if err := checkComment(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkComment(comment *entity.Comment) error {
+	if utf8.RuneCountInString(comment.Body) > maxBodyLen {
+		return fmt.Errorf("%w: body is longer than %v characters", handler.ErrValidation, maxBodyLen)
+	}
+	if comment.Likes > maxLikes {
+		return fmt.Errorf("%w: likes are out of range", handler.ErrValidation)
+	}
+	return nil
+}
+
+// addLikes changes likes of post or of one of its comments, increasing the post's version.
+func addLikes(post *entity.RedditPost, likes *uint32, delta int) (uint32, bool, error) {
+	updated := int(*likes) + delta
+	if updated < 0 || updated > maxLikes {
+		return 0, true, handler.ErrLikesOutOfRange
+	}
+	*likes = uint32(updated)
+	touch(post)
+	return *likes, true, nil
+}
+
+// touch moves post to its next version.
+func touch(post *entity.RedditPost) {
+	post.Version++
+	post.UpdatedAt = time.Now().UTC()
+}
+
+// checkVersion fails with ErrVersionMismatch unless version is zero or the one of stored,
+// which is nil when the post doesn't exist.
+func checkVersion(postID string, stored *entity.RedditPost, version uint64) error {
+	if version == 0 || stored != nil && stored.Version == version {
+		return nil
+	}
+	return versionMismatch(postID, version)
+}
+
+func copyPost(post *entity.RedditPost) *entity.RedditPost {
+	copied := &entity.RedditPost{UUID: post.UUID, Title: post.Title, Likes: post.Likes, Version: post.Version, UpdatedAt: post.UpdatedAt}
+	if post.Comments != nil {
+		copied.Comments = make([]*entity.Comment, 0, len(post.Comments))
+		for _, c := range post.Comments {
+			copied.Comments = append(copied.Comments, copyComment(c))
+		}
+	}
+	return copied
+}
+
+func copyComment(comment *entity.Comment) *entity.Comment {
+	copied := *comment
+	return &copied
+}
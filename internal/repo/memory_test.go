@@ -0,0 +1,115 @@
+package repo_test
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/repo"
+	"dmmak/simple-rest-crud/internal/repo/repotest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemRepoContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) handler.RedditPostsRepo {
+		return repo.NewMemRepo(repo.NewMemStore())
+	})
+}
+
+func TestMemRepoCopiesValues(t *testing.T) {
+	ctx := context.Background()
+	posts := repo.NewMemRepo(repo.NewMemStore())
+	post := &entity.RedditPost{
+		UUID:     "p1",
+		Title:    "Original title",
+		Comments: []*entity.Comment{{UUID: "c1", Body: "Original body"}},
+	}
+	assert.Nil(t, repotest.Save(ctx, posts, post))
+
+	post.Title = "Changed after save"
+	post.Comments[0].Body = "Changed after save"
+	got, found, err := posts.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "Original title", got.Title)
+	assert.Equal(t, "Original body", got.Comments[0].Body)
+
+	got.Comments[0].Body = "Changed after get"
+	got, _, _ = posts.Get(ctx, "p1")
+	assert.Equal(t, "Original body", got.Comments[0].Body)
+}
+
+func TestMemRepoDeleteCascadesComments(t *testing.T) {
+	ctx := context.Background()
+	store := repo.NewMemStore()
+	posts := repo.NewMemRepo(store)
+	comments := repo.NewMemCommentsRepo(store)
+	assert.Nil(t, repotest.Save(ctx, posts, &entity.RedditPost{UUID: "p1", Title: "Post", Comments: []*entity.Comment{{UUID: "c1", Body: "Body"}}}))
+
+	found, err := posts.Delete(ctx, "p1", 0)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	_, found, err = comments.Get(ctx, "p1", "c1")
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	// the comment uuid is free again once its post is gone
+	err = repotest.Save(ctx, posts, &entity.RedditPost{UUID: "p2", Title: "Post", Comments: []*entity.Comment{{UUID: "c1", Body: "Body"}}})
+	assert.Nil(t, err)
+}
+
+func TestMemRepoErrors(t *testing.T) {
+	ctx := context.Background()
+	store := repo.NewMemStore()
+	posts := repo.NewMemRepo(store)
+	comments := repo.NewMemCommentsRepo(store)
+	assert.Nil(t, repotest.Save(ctx, posts, &entity.RedditPost{UUID: "p1", Title: "Post", Comments: []*entity.Comment{{UUID: "c1", Body: "Body"}}}))
+
+	assert.ErrorIs(t, repotest.Save(ctx, posts, &entity.RedditPost{UUID: "p1", Title: "Post"}), handler.ErrConflict)
+	assert.ErrorIs(t, repotest.Save(ctx, posts, &entity.RedditPost{UUID: "p2", Title: "Post", Comments: []*entity.Comment{{UUID: "c1", Body: "Body"}}}), handler.ErrConflict)
+	_, found, _ := posts.Get(ctx, "p2")
+	assert.False(t, found, "failed save must not store anything")
+
+	_, _, err := comments.Save(ctx, "p1", &entity.Comment{UUID: "c1", Body: "Body"}, 0)
+	assert.ErrorIs(t, err, handler.ErrConflict)
+	_, _, err = posts.Like(ctx, "p1", -1)
+	assert.ErrorIs(t, err, handler.ErrLikesOutOfRange)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, _, err = posts.Get(canceled, "p1")
+	assert.ErrorIs(t, err, handler.ErrCanceled)
+}
+
+func TestMemCommentsChangePostVersion(t *testing.T) {
+	ctx := context.Background()
+	store := repo.NewMemStore()
+	posts := repo.NewMemRepo(store)
+	comments := repo.NewMemCommentsRepo(store)
+	assert.Nil(t, repotest.Save(ctx, posts, &entity.RedditPost{UUID: "p1", Title: "Post"}))
+
+	version, _, err := comments.Save(ctx, "p1", &entity.Comment{UUID: "c1", Body: "Body"}, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), version)
+	_, found, err := comments.Update(ctx, "p1", &entity.Comment{UUID: "c1", Body: "Updated"}, 1)
+	assert.ErrorIs(t, err, handler.ErrVersionMismatch)
+	assert.True(t, found)
+	version, _, err = comments.Update(ctx, "p1", &entity.Comment{UUID: "c1", Body: "Updated"}, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), version)
+	_, _, err = comments.Like(ctx, "p1", "c1", 1)
+	assert.Nil(t, err)
+	_, _, err = comments.Like(ctx, "p1", "c1", -2)
+	assert.ErrorIs(t, err, handler.ErrLikesOutOfRange)
+	_, found, err = comments.Delete(ctx, "p1", "c2", 4)
+	assert.Nil(t, err)
+	assert.False(t, found)
+	version, _, err = comments.Delete(ctx, "p1", "c1", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), version)
+
+	post, _, err := posts.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), post.Version, "every successful comment write increases the post version")
+}
@@ -0,0 +1,502 @@
+package repo
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/logging"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// copyFromMinComments is the size of a comment set from which Save streams it with COPY,
+// smaller ones are inserted by a batch of statements sent in one round trip.
+const copyFromMinComments = 64
+
+var commentColumns = []string{"uuid", "post_uuid", "body", "likes"}
+
+// pgxRepo is pgRepo over a native pgx pool instead of database/sql, so it can send
+// batches of queries and use the COPY protocol.
+type pgxRepo struct {
+	pool   *pgxpool.Pool
+	logger *slog.Logger
+}
+
+// NewPGXRepo returns a repository logging its calls to logger, see logCall.
+func NewPGXRepo(pool *pgxpool.Pool, logger *slog.Logger) handler.RedditPostsRepo {
+	return &pgxRepo{pool, logger}
+}
+
+// OpenPGX opens a native pgx pool and checks that the server is reachable.
+// Idle connections of the pool are bounded only by pool.ConnMaxIdleTime.
+func OpenPGX(ctx context.Context, connStr string, pool Pool) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse connection string: %w", err)
+	}
+	cfg.MaxConns = int32(pool.MaxOpenConns)
+	if pool.ConnMaxLifetime > 0 {
+		cfg.MaxConnLifetime = pool.ConnMaxLifetime
+	}
+	if pool.ConnMaxIdleTime > 0 {
+		cfg.MaxConnIdleTime = pool.ConnMaxIdleTime
+	}
+
+	p, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("can't open db: %w", err)
+	}
+	if err := p.Ping(ctx); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("can't connect to db: %w", classify(err))
+	}
+	return p, nil
+}
+
+// Save with ConflictReject streams large comment sets with COPY, other policies
+// upsert comments with the statements of pgRepo.Save.
+func (px *pgxRepo) Save(ctx context.Context, post *entity.RedditPost, onConflict handler.ConflictPolicy, version uint64) (created bool, err error) {
+	defer logCall(ctx, px.logger, "posts.Save", time.Now(), &err, slog.String(logging.KeyPostID, post.UUID))
+
+	tx, err := px.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("can't create tx: %w", classify(err))
+	}
+
+	if version != 0 {
+		var stored uint64
+		err := tx.QueryRow(ctx, "SELECT version FROM posts WHERE uuid = $1 FOR UPDATE", post.UUID).Scan(&stored)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return false, rollbackPGX(ctx, tx, fmt.Errorf("can't query post version: %w", classify(err)))
+		}
+		if stored != version {
+			return false, rollbackPGX(ctx, tx, versionMismatch(post.UUID, version))
+		}
+	}
+
+	row := tx.QueryRow(ctx, "INSERT INTO posts (uuid, title, likes) VALUES ($1,$2,$3)"+postConflictSQL[onConflict]+" RETURNING xmax = 0, version, updated_at",
+		post.UUID, post.Title, post.Likes)
+	if err := row.Scan(&created, &post.Version, &post.UpdatedAt); err != nil {
+		return false, rollbackPGX(ctx, tx, fmt.Errorf("can't insert new post: %w", classify(err)))
+	}
+
+	if onConflict == handler.ConflictReject {
+		err = insertPGXComments(ctx, tx, post.UUID, post.Comments)
+	} else {
+		err = upsertPGXComments(ctx, tx, post, created, onConflict)
+	}
+	if err != nil {
+		return false, rollbackPGX(ctx, tx, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("can't commit inserting post: %w", classify(err))
+	}
+	return created, nil
+}
+
+// insertPGXComments doesn't build a single multi-row INSERT, which would run out of
+// the 65535 bind parameters of a statement on large comment sets.
+func insertPGXComments(ctx context.Context, tx pgx.Tx, postID string, comments []*entity.Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	if len(comments) >= copyFromMinComments {
+		_, err := tx.CopyFrom(ctx, pgx.Identifier{"comments"}, commentColumns,
+			pgx.CopyFromSlice(len(comments), func(i int) ([]any, error) {
+				c := comments[i]
+				return []any{c.UUID, postID, c.Body, c.Likes}, nil
+			}))
+		if err != nil {
+			return fmt.Errorf("can't copy post's comments: %w", classify(err))
+		}
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, c := range comments {
+		batch.Queue("INSERT INTO comments VALUES ($1, $2, $3, $4)", c.UUID, postID, c.Body, c.Likes)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("can't insert post's comments: %w", classify(err))
+	}
+	return nil
+}
+
+// upsertPGXComments deletes comments missing from an overwritten post and upserts the rest.
+func upsertPGXComments(ctx context.Context, tx pgx.Tx, post *entity.RedditPost, created bool, onConflict handler.ConflictPolicy) error {
+	uuids := make([]string, 0, len(post.Comments))
+	bodies := make([]string, 0, len(post.Comments))
+	likes := make([]int64, 0, len(post.Comments))
+	for _, c := range post.Comments {
+		uuids = append(uuids, c.UUID)
+		bodies = append(bodies, c.Body)
+		likes = append(likes, int64(c.Likes))
+	}
+	if !created && onConflict == handler.ConflictOverwrite {
+		_, err := tx.Exec(ctx, "DELETE FROM comments WHERE post_uuid = $1 AND uuid <> ALL($2)", post.UUID, uuids)
+		if err != nil {
+			return fmt.Errorf("can't delete overwritten comments: %w", classify(err))
+		}
+	}
+	if len(post.Comments) == 0 {
+		return nil
+	}
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO comments (uuid, post_uuid, body, likes)
+		SELECT c.uuid, $2::varchar, c.body, c.likes::smallint
+		FROM unnest($1::varchar[], $3::varchar[], $4::bigint[]) AS c(uuid, body, likes)`+commentConflictSQL[onConflict],
+		uuids, post.UUID, bodies, likes)
+	if err != nil {
+		return fmt.Errorf("can't upsert post's comments: %w", classify(err))
+	}
+	if n := len(post.Comments); tag.RowsAffected() < int64(n) {
+		return fmt.Errorf("%w: %v of %v comments belong to other posts", handler.ErrConflict, int64(n)-tag.RowsAffected(), n)
+	}
+	return nil
+}
+
+// Get reads the post and its comments with a batch of two queries, in a single round trip.
+func (px *pgxRepo) Get(ctx context.Context, postID string) (post *entity.RedditPost, found bool, err error) {
+	defer logCall(ctx, px.logger, "posts.Get", time.Now(), &err, slog.String(logging.KeyPostID, postID))
+
+	post = &entity.RedditPost{}
+
+	batch := &pgx.Batch{}
+	batch.Queue("SELECT uuid, title, likes, version, updated_at FROM posts WHERE uuid = $1", postID)
+	batch.Queue("SELECT uuid, body, likes FROM comments WHERE post_uuid = $1", postID)
+	results := px.pool.SendBatch(ctx, batch)
+	defer results.Close()
+
+	err = results.QueryRow().Scan(&post.UUID, &post.Title, &post.Likes, &post.Version, &post.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return post, false, nil
+	} else if err != nil {
+		return post, false, fmt.Errorf("can't query 'posts' table: %w", classify(err))
+	}
+
+	rows, err := results.Query()
+	if err != nil {
+		return nil, false, fmt.Errorf("can't query 'comments' table: %w", classify(err))
+	}
+	comments, err := pgx.CollectRows(rows, scanComment)
+	if err != nil {
+		return nil, false, fmt.Errorf("can't process query result: %w", classify(err))
+	}
+
+	post.Comments = comments
+	return post, true, nil
+}
+
+func scanComment(row pgx.CollectableRow) (*entity.Comment, error) {
+	comment := &entity.Comment{}
+	err := row.Scan(&comment.UUID, &comment.Body, &comment.Likes)
+	return comment, err
+}
+
+func (px *pgxRepo) Revision(ctx context.Context, postID string) (rev handler.Revision, found bool, err error) {
+	defer logCall(ctx, px.logger, "posts.Revision", time.Now(), &err, slog.String(logging.KeyPostID, postID))
+
+	row := px.pool.QueryRow(ctx, "SELECT version, updated_at FROM posts WHERE uuid = $1", postID)
+	err = row.Scan(&rev.Version, &rev.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return rev, false, nil
+	} else if err != nil {
+		return rev, false, fmt.Errorf("can't query 'posts' table: %w", classify(err))
+	}
+	return rev, true, nil
+}
+
+func (px *pgxRepo) Delete(ctx context.Context, postID string, version uint64) (found bool, err error) {
+	defer logCall(ctx, px.logger, "posts.Delete", time.Now(), &err, slog.String(logging.KeyPostID, postID))
+
+	tag, err := px.pool.Exec(ctx, "DELETE FROM posts WHERE uuid = $1 AND ($2::bigint = 0 OR version = $2)", postID, version)
+	if err != nil {
+		return false, fmt.Errorf("can't delete post: %w", classify(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return versionMissPGX(ctx, px.pool, "SELECT EXISTS (SELECT 1 FROM posts WHERE uuid = $1)", postID, version)
+	}
+	return true, nil
+}
+
+func (px *pgxRepo) List(ctx context.Context, afterID string, limit int) (posts []*entity.RedditPost, err error) {
+	defer logCall(ctx, px.logger, "posts.List", time.Now(), &err)
+
+	rows, err := px.pool.Query(ctx, "SELECT uuid, title, likes, version, updated_at FROM posts WHERE uuid > $1 ORDER BY uuid LIMIT $2", afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't query 'posts' table: %w", classify(err))
+	}
+	posts, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (*entity.RedditPost, error) {
+		post := &entity.RedditPost{Comments: []*entity.Comment{}}
+		err := row.Scan(&post.UUID, &post.Title, &post.Likes, &post.Version, &post.UpdatedAt)
+		return post, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't process query result: %w", classify(err))
+	}
+	if len(posts) == 0 {
+		return posts, nil
+	}
+
+	byID := map[string]*entity.RedditPost{}
+	postIDs := make([]string, 0, len(posts))
+	for _, post := range posts {
+		byID[post.UUID] = post
+		postIDs = append(postIDs, post.UUID)
+	}
+	commentRows, err := px.pool.Query(ctx, "SELECT post_uuid, uuid, body, likes FROM comments WHERE post_uuid = ANY($1)", postIDs)
+	if err != nil {
+		return nil, fmt.Errorf("can't query 'comments' table: %w", classify(err))
+	}
+	var postID string
+	comment := &entity.Comment{}
+	_, err = pgx.ForEachRow(commentRows, []any{&postID, &comment.UUID, &comment.Body, &comment.Likes}, func() error {
+		copied := *comment
+		byID[postID].Comments = append(byID[postID].Comments, &copied)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't process query result: %w", classify(err))
+	}
+	return posts, nil
+}
+
+// Update behaves like pgRepo.Update.
+func (px *pgxRepo) Update(ctx context.Context, post *entity.RedditPost, version uint64) (found bool, err error) {
+	defer logCall(ctx, px.logger, "posts.Update", time.Now(), &err, slog.String(logging.KeyPostID, post.UUID))
+
+	tx, err := px.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("can't create tx: %w", classify(err))
+	}
+
+	row := tx.QueryRow(ctx, `
+		UPDATE posts SET title = $2, version = version + 1, updated_at = now()
+		WHERE uuid = $1 AND ($3::bigint = 0 OR version = $3)
+		RETURNING version, updated_at`, post.UUID, post.Title, version)
+	err = row.Scan(&post.Version, &post.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		found, err := versionMissPGX(ctx, tx, "SELECT EXISTS (SELECT 1 FROM posts WHERE uuid = $1)", post.UUID, version)
+		return found, rollbackPGX(ctx, tx, err)
+	} else if err != nil {
+		return false, rollbackPGX(ctx, tx, fmt.Errorf("can't update post: %w", classify(err)))
+	}
+
+	rows, err := tx.Query(ctx, "SELECT uuid, body, likes FROM comments WHERE post_uuid = $1 FOR UPDATE", post.UUID)
+	if err != nil {
+		return false, rollbackPGX(ctx, tx, fmt.Errorf("can't query 'comments' table: %w", classify(err)))
+	}
+	stored, err := pgx.CollectRows(rows, scanComment)
+	if err != nil {
+		return false, rollbackPGX(ctx, tx, fmt.Errorf("can't process query result: %w", classify(err)))
+	}
+	existing := map[string]*entity.Comment{}
+	for _, c := range stored {
+		existing[c.UUID] = c
+	}
+
+	added := []*entity.Comment{}
+	var changedIDs, changedBodies []string
+	for _, c := range post.Comments {
+		old, ok := existing[c.UUID]
+		delete(existing, c.UUID)
+		switch {
+		case !ok:
+			added = append(added, c)
+		case old.Body != c.Body:
+			changedIDs, changedBodies = append(changedIDs, c.UUID), append(changedBodies, c.Body)
+		}
+	}
+	batch := &pgx.Batch{}
+	if len(changedIDs) > 0 {
+		batch.Queue(pgUpdateCommentBodiesSQL, changedIDs, changedBodies, post.UUID)
+	}
+	if len(existing) > 0 {
+		missing := make([]string, 0, len(existing))
+		for uuid := range existing {
+			missing = append(missing, uuid)
+		}
+		batch.Queue("DELETE FROM comments WHERE uuid = ANY($1)", missing)
+	}
+	if batch.Len() > 0 {
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return false, rollbackPGX(ctx, tx, fmt.Errorf("can't update comments: %w", classify(err)))
+		}
+	}
+	if err := insertPGXComments(ctx, tx, post.UUID, added); err != nil {
+		return false, rollbackPGX(ctx, tx, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("can't commit updating post: %w", classify(err))
+	}
+	return true, nil
+}
+
+func (px *pgxRepo) Like(ctx context.Context, postID string, delta int) (likes uint32, found bool, err error) {
+	defer logCall(ctx, px.logger, "posts.Like", time.Now(), &err, slog.String(logging.KeyPostID, postID))
+
+	row := px.pool.QueryRow(ctx, `
+		UPDATE posts SET likes = COALESCE(likes, 0)::integer + $2::integer, version = version + 1, updated_at = now()
+		WHERE uuid = $1 AND COALESCE(likes, 0)::integer + $2::integer BETWEEN 0 AND $3
+		RETURNING likes`, postID, delta, maxLikes)
+	err = row.Scan(&likes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return likesMissPGX(ctx, px.pool, "SELECT EXISTS (SELECT 1 FROM posts WHERE uuid = $1)", postID)
+	} else if err != nil {
+		return 0, false, fmt.Errorf("can't update post likes: %w", classify(err))
+	}
+	return likes, true, nil
+}
+
+type pgxCommentsRepo struct {
+	pool   *pgxpool.Pool
+	logger *slog.Logger
+}
+
+// NewPGXCommentsRepo returns a repository logging its calls to logger, see logCall.
+func NewPGXCommentsRepo(pool *pgxpool.Pool, logger *slog.Logger) handler.CommentsRepo {
+	return &pgxCommentsRepo{pool, logger}
+}
+
+func (px *pgxCommentsRepo) Save(ctx context.Context, postID string, comment *entity.Comment, version uint64) (postVersion uint64, found bool, err error) {
+	defer logCall(ctx, px.logger, "comments.Save", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, comment.UUID))
+
+	row := px.pool.QueryRow(ctx, pgSaveCommentSQL, comment.UUID, postID, comment.Body, comment.Likes, version)
+	err = row.Scan(&postVersion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		found, err = commentMissPGX(ctx, px.pool, pgOtherVersionSQL, postID, version)
+		return 0, found, err
+	} else if err != nil {
+		return 0, false, fmt.Errorf("can't insert comment: %w", classify(err))
+	}
+	return postVersion, true, nil
+}
+
+func (px *pgxCommentsRepo) Get(ctx context.Context, postID string, commentID string) (comment *entity.Comment, found bool, err error) {
+	defer logCall(ctx, px.logger, "comments.Get", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, commentID))
+
+	comment = &entity.Comment{}
+
+	row := px.pool.QueryRow(ctx, "SELECT uuid, body, likes FROM comments WHERE uuid = $1 AND post_uuid = $2", commentID, postID)
+	err = row.Scan(&comment.UUID, &comment.Body, &comment.Likes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return comment, false, nil
+	} else if err != nil {
+		return comment, false, fmt.Errorf("can't query 'comments' table: %w", classify(err))
+	}
+	return comment, true, nil
+}
+
+func (px *pgxCommentsRepo) Update(ctx context.Context, postID string, comment *entity.Comment, version uint64) (postVersion uint64, found bool, err error) {
+	defer logCall(ctx, px.logger, "comments.Update", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, comment.UUID))
+
+	row := px.pool.QueryRow(ctx, pgUpdateCommentSQL, comment.UUID, postID, comment.Body, version)
+	err = row.Scan(&postVersion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		found, err = commentMissPGX(ctx, px.pool, pgOtherVersionSQL, postID, version)
+		return 0, found, err
+	} else if err != nil {
+		return 0, false, fmt.Errorf("can't update comment: %w", classify(err))
+	}
+	return postVersion, true, nil
+}
+
+func (px *pgxCommentsRepo) Delete(ctx context.Context, postID string, commentID string, version uint64) (postVersion uint64, found bool, err error) {
+	defer logCall(ctx, px.logger, "comments.Delete", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, commentID))
+
+	row := px.pool.QueryRow(ctx, pgDeleteCommentSQL, commentID, postID, version)
+	err = row.Scan(&postVersion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		found, err = commentMissPGX(ctx, px.pool, pgOtherVersionSQL, postID, version)
+		return 0, found, err
+	} else if err != nil {
+		return 0, false, fmt.Errorf("can't delete comment: %w", classify(err))
+	}
+	return postVersion, true, nil
+}
+
+func (px *pgxCommentsRepo) Like(ctx context.Context, postID string, commentID string, delta int) (likes uint32, found bool, err error) {
+	defer logCall(ctx, px.logger, "comments.Like", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, commentID))
+
+	row := px.pool.QueryRow(ctx, pgLikeCommentSQL, commentID, postID, delta, maxLikes)
+	err = row.Scan(&likes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return likesMissPGX(ctx, px.pool, "SELECT EXISTS (SELECT 1 FROM comments WHERE uuid = $1 AND post_uuid = $2)", commentID, postID)
+	} else if err != nil {
+		return 0, false, fmt.Errorf("can't update comment likes: %w", classify(err))
+	}
+	return likes, true, nil
+}
+
+// likesMissPGX is likesMiss over a pgx pool.
+func likesMissPGX(ctx context.Context, pool *pgxpool.Pool, existsQuery string, args ...any) (likes uint32, found bool, err error) {
+	var exists bool
+	err = pool.QueryRow(ctx, existsQuery, args...).Scan(&exists)
+	if err != nil {
+		return 0, false, fmt.Errorf("can't check row existence: %w", classify(err))
+	}
+	if exists {
+		return 0, true, handler.ErrLikesOutOfRange
+	}
+	return 0, false, nil
+}
+
+// versionMissPGX is versionMiss over a pgx pool or transaction.
+func versionMissPGX(ctx context.Context, q pgxRowQuerier, existsQuery string, postID string, version uint64) (found bool, err error) {
+	if version == 0 {
+		return false, nil
+	}
+	var exists bool
+	err = q.QueryRow(ctx, existsQuery, postID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("can't check post existence: %w", classify(err))
+	}
+	if exists {
+		return true, versionMismatch(postID, version)
+	}
+	return false, nil
+}
+
+// commentMissPGX is commentMiss over a pgx pool or transaction.
+func commentMissPGX(ctx context.Context, q pgxRowQuerier, otherVersionQuery string, postID string, version uint64) (found bool, err error) {
+	if version == 0 {
+		return false, nil
+	}
+	var otherVersion bool
+	err = q.QueryRow(ctx, otherVersionQuery, postID, version).Scan(&otherVersion)
+	if err != nil {
+		return false, fmt.Errorf("can't check post version: %w", classify(err))
+	}
+	if otherVersion {
+		return true, versionMismatch(postID, version)
+	}
+	return false, nil
+}
+
+// pgxRowQuerier is implemented by both *pgxpool.Pool and pgx.Tx.
+type pgxRowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// rollbackPGX is rollback for pgx transactions.
+func rollbackPGX(ctx context.Context, tx pgx.Tx, err error) error {
+	if rbErr := tx.Rollback(ctx); rbErr != nil {
+		if err == nil {
+			return fmt.Errorf("can't rollback tx: %w", classify(rbErr))
+		}
+		return fmt.Errorf("can't rollback tx: %w, err: %w", classify(rbErr), err)
+	}
+	return err
+}
@@ -5,113 +5,419 @@ import (
 	"database/sql"
 	"dmmak/simple-rest-crud/internal/entity"
 	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/logging"
 	"fmt"
-	"strings"
+	"log/slog"
+	"math"
+	"time"
 
 	_ "github.com/jackc/pgx/v5"
 )
 
+// maxLikes is the upper bound of the smallint likes columns.
+const maxLikes = math.MaxInt16
+
 type pgRepo struct {
-	db *sql.DB
+	db     *sql.DB
+	logger *slog.Logger
 }
 
-func NewPGRepo(db *sql.DB) handler.RedditPostsRepo {
-	return &pgRepo{db}
+// NewPGRepo returns a repository logging its calls to logger, see logCall.
+func NewPGRepo(db *sql.DB, logger *slog.Logger) handler.RedditPostsRepo {
+	return &pgRepo{db, logger}
 }
 
-func (pg *pgRepo) Save(ctx context.Context, post *entity.RedditPost) (err error) {
+// ON CONFLICT clauses of posts and comments inserts by conflict policy, ConflictReject has none.
+// Updated posts get the next version, updated_at is taken from the inserted row, where it's
+// either the column default or set by the insert. Comments of other posts are never updated: their rows
+// are left out of the affected rows count, which tells Save to fail with ErrConflict.
+var (
+	postConflictSQL = map[handler.ConflictPolicy]string{
+		handler.ConflictOverwrite: " ON CONFLICT (uuid) DO UPDATE SET title = excluded.title, likes = excluded.likes, version = posts.version + 1, updated_at = excluded.updated_at",
+		handler.ConflictMerge:     " ON CONFLICT (uuid) DO UPDATE SET title = excluded.title, version = posts.version + 1, updated_at = excluded.updated_at",
+	}
+	commentConflictSQL = map[handler.ConflictPolicy]string{
+		handler.ConflictOverwrite: " ON CONFLICT (uuid) DO UPDATE SET body = excluded.body, likes = excluded.likes WHERE comments.post_uuid = excluded.post_uuid",
+		handler.ConflictMerge:     " ON CONFLICT (uuid) DO UPDATE SET body = excluded.body WHERE comments.post_uuid = excluded.post_uuid",
+	}
+)
+
+func (pg *pgRepo) Save(ctx context.Context, post *entity.RedditPost, onConflict handler.ConflictPolicy, version uint64) (created bool, err error) {
+	defer logCall(ctx, pg.logger, "posts.Save", time.Now(), &err, slog.String(logging.KeyPostID, post.UUID))
+
 	tx, err := pg.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelDefault, ReadOnly: false})
 	if err != nil {
-		return fmt.Errorf("can't create tx: %w", err)
+		return false, fmt.Errorf("can't create tx: %w", classify(err))
 	}
 
-	_, err = tx.ExecContext(ctx, "INSERT INTO posts VALUES ($1,$2,$3)", post.UUID, post.Title, post.Likes)
-	if err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			return fmt.Errorf("can't rollback tx: %w, insert post err: %w", rbErr, err)
+	if version != 0 {
+		// the lock keeps the version until the upsert below bumps it
+		var stored uint64
+		err := tx.QueryRowContext(ctx, "SELECT version FROM posts WHERE uuid = $1 FOR UPDATE", post.UUID).Scan(&stored)
+		if err != nil && err != sql.ErrNoRows {
+			return false, rollback(tx, fmt.Errorf("can't query post version: %w", classify(err)))
+		}
+		if stored != version {
+			return false, rollback(tx, versionMismatch(post.UUID, version))
 		}
-		return fmt.Errorf("can't insert new post: %w", err)
 	}
 
-	if len(post.Comments) == 0 {
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("can't commit inserting post without comments: %w", err)
+	// xmax of a row is zero unless it was updated, which is how ON CONFLICT DO UPDATE inserts it
+	row := tx.QueryRowContext(ctx, "INSERT INTO posts (uuid, title, likes) VALUES ($1,$2,$3)"+postConflictSQL[onConflict]+" RETURNING xmax = 0, version, updated_at",
+		post.UUID, post.Title, post.Likes)
+	if err := row.Scan(&created, &post.Version, &post.UpdatedAt); err != nil {
+		return false, rollback(tx, fmt.Errorf("can't insert new post: %w", classify(err)))
+	}
+
+	if !created && onConflict == handler.ConflictOverwrite {
+		uuids := make([]string, 0, len(post.Comments))
+		for _, c := range post.Comments {
+			uuids = append(uuids, c.UUID)
 		}
-		return nil
+		_, err = tx.ExecContext(ctx, "DELETE FROM comments WHERE post_uuid = $1 AND uuid <> ALL($2)", post.UUID, uuids)
+		if err != nil {
+			return false, rollback(tx, fmt.Errorf("can't delete overwritten comments: %w", classify(err)))
+		}
+	}
+	if err := insertComments(ctx, tx, post.UUID, post.Comments, commentConflictSQL[onConflict]); err != nil {
+		return false, rollback(tx, err)
 	}
 
-	sqlBuilder := &strings.Builder{}
-	values := []any{}
-	sqlBuilder.WriteString("INSERT INTO comments VALUES")
-	for i, v := range post.Comments {
-		sql := fmt.Sprintf("($%v, $%v, $%v, $%v),", 4*i+1, 4*i+2, 4*i+3, 4*i+4)
-		sqlBuilder.WriteString(sql)
-		values = append(values, v.UUID, post.UUID, v.Body, v.Likes)
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("can't commit inserting post: %w", classify(err))
 	}
-	insertSql := sqlBuilder.String()
-	insertSql = insertSql[0 : len(insertSql)-1]
+	return created, nil
+}
 
-	_, err = tx.ExecContext(ctx, insertSql, values...)
+// insertComments inserts comments of a post with a single statement taking them as four
+// arrays, so neither the number of bind parameters nor the statement text, which the driver
+// prepares once and caches, depend on how many comments there are. onConflict is appended
+// to the statement, comments it skips fail the insert with ErrConflict.
+func insertComments(ctx context.Context, tx *sql.Tx, postID string, comments []*entity.Comment, onConflict string) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	uuids := make([]string, 0, len(comments))
+	bodies := make([]string, 0, len(comments))
+	likes := make([]int64, 0, len(comments))
+	for _, c := range comments {
+		uuids = append(uuids, c.UUID)
+		bodies = append(bodies, c.Body)
+		likes = append(likes, int64(c.Likes))
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO comments (uuid, post_uuid, body, likes)
+		SELECT c.uuid, $2::varchar, c.body, c.likes::smallint
+		FROM unnest($1::varchar[], $3::varchar[], $4::bigint[]) AS c(uuid, body, likes)`+onConflict,
+		uuids, postID, bodies, likes)
 	if err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			return fmt.Errorf("can't rollback tx: %w, insert comments err: %w", rbErr, err)
-		}
-		return fmt.Errorf("can't insert post's comments: %w", err)
+		return fmt.Errorf("can't insert post's comments: %w", classify(err))
 	}
+	return checkInserted(res, len(comments))
+}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("can't commit inserting post with comments: %w", err)
+// checkInserted fails with ErrConflict unless all n rows were inserted or updated.
+func checkInserted(res sql.Result, n int) error {
+	num, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't determine affected rows: %w", classify(err))
+	}
+	if num < int64(n) {
+		return fmt.Errorf("%w: %v of %v comments belong to other posts", handler.ErrConflict, int64(n)-num, n)
 	}
 	return nil
 }
 
 func (pg *pgRepo) Get(ctx context.Context, postID string) (post *entity.RedditPost, found bool, err error) {
+	defer logCall(ctx, pg.logger, "posts.Get", time.Now(), &err, slog.String(logging.KeyPostID, postID))
+
 	post = &entity.RedditPost{}
 
-	row := pg.db.QueryRowContext(ctx, "SELECT * FROM posts WHERE uuid = $1", postID)
-	err = row.Scan(&post.UUID, &post.Title, &post.Likes)
+	row := pg.db.QueryRowContext(ctx, "SELECT uuid, title, likes, version, updated_at FROM posts WHERE uuid = $1", postID)
+	err = row.Scan(&post.UUID, &post.Title, &post.Likes, &post.Version, &post.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return post, false, nil
 	} else if err != nil {
-		return post, false, fmt.Errorf("can't query 'posts' table: %w", err)
+		return post, false, fmt.Errorf("can't query 'posts' table: %w", classify(err))
 	}
 
 	comments := []*entity.Comment{}
 	rows, err := pg.db.QueryContext(ctx, "SELECT uuid, body, likes FROM comments WHERE post_uuid = $1", postID)
 	if err != nil {
-		return nil, false, fmt.Errorf("can't query 'comments' table: %w", err)
+		return nil, false, fmt.Errorf("can't query 'comments' table: %w", classify(err))
 	}
 	defer rows.Close()
 	for rows.Next() {
 		comment := &entity.Comment{}
 		err = rows.Scan(&comment.UUID, &comment.Body, &comment.Likes)
 		if err != nil {
-			return nil, false, fmt.Errorf("can't process query result: %w", err)
+			return nil, false, fmt.Errorf("can't process query result: %w", classify(err))
 		}
 		comments = append(comments, comment)
 	}
 
 	err = rows.Err()
 	if err != nil {
-		return nil, false, fmt.Errorf("error during query result iteration: %w", err)
+		return nil, false, fmt.Errorf("error during query result iteration: %w", classify(err))
 	}
 
 	post.Comments = comments
 	return post, true, nil
 }
 
-func (pg *pgRepo) Delete(ctx context.Context, postID string) (found bool, err error) {
-	res, err := pg.db.ExecContext(ctx, "DELETE FROM posts WHERE uuid = $1", postID)
+func (pg *pgRepo) Revision(ctx context.Context, postID string) (rev handler.Revision, found bool, err error) {
+	defer logCall(ctx, pg.logger, "posts.Revision", time.Now(), &err, slog.String(logging.KeyPostID, postID))
+
+	row := pg.db.QueryRowContext(ctx, "SELECT version, updated_at FROM posts WHERE uuid = $1", postID)
+	err = row.Scan(&rev.Version, &rev.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return rev, false, nil
+	} else if err != nil {
+		return rev, false, fmt.Errorf("can't query 'posts' table: %w", classify(err))
+	}
+	return rev, true, nil
+}
+
+func (pg *pgRepo) Delete(ctx context.Context, postID string, version uint64) (found bool, err error) {
+	defer logCall(ctx, pg.logger, "posts.Delete", time.Now(), &err, slog.String(logging.KeyPostID, postID))
+
+	res, err := pg.db.ExecContext(ctx, "DELETE FROM posts WHERE uuid = $1 AND ($2::bigint = 0 OR version = $2)", postID, version)
 	if err != nil {
-		return false, fmt.Errorf("can't delete post: %w", err)
+		return false, fmt.Errorf("can't delete post: %w", classify(err))
 	}
 	num, err := res.RowsAffected()
 	if err != nil {
-		return false, fmt.Errorf("can't determine affected rows: %w", err)
+		return false, fmt.Errorf("can't determine affected rows: %w", classify(err))
 	}
 	if num == 0 {
-		return false, nil
+		return versionMiss(ctx, pg.db, "SELECT EXISTS (SELECT 1 FROM posts WHERE uuid = $1)", postID, version)
 	} else {
 		return true, nil
 	}
 }
+
+// List uses keyset pagination over the posts primary key, so the cost of a page
+// doesn't depend on how deep into the table it is.
+func (pg *pgRepo) List(ctx context.Context, afterID string, limit int) (posts []*entity.RedditPost, err error) {
+	defer logCall(ctx, pg.logger, "posts.List", time.Now(), &err)
+
+	rows, err := pg.db.QueryContext(ctx, "SELECT uuid, title, likes, version, updated_at FROM posts WHERE uuid > $1 ORDER BY uuid LIMIT $2", afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't query 'posts' table: %w", classify(err))
+	}
+	defer rows.Close()
+
+	posts = []*entity.RedditPost{}
+	byID := map[string]*entity.RedditPost{}
+	postIDs := []string{}
+	for rows.Next() {
+		post := &entity.RedditPost{Comments: []*entity.Comment{}}
+		err = rows.Scan(&post.UUID, &post.Title, &post.Likes, &post.Version, &post.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("can't process query result: %w", classify(err))
+		}
+		posts = append(posts, post)
+		byID[post.UUID] = post
+		postIDs = append(postIDs, post.UUID)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error during query result iteration: %w", classify(err))
+	}
+	if len(posts) == 0 {
+		return posts, nil
+	}
+
+	commentRows, err := pg.db.QueryContext(ctx, "SELECT post_uuid, uuid, body, likes FROM comments WHERE post_uuid = ANY($1)", postIDs)
+	if err != nil {
+		return nil, fmt.Errorf("can't query 'comments' table: %w", classify(err))
+	}
+	defer commentRows.Close()
+	for commentRows.Next() {
+		var postID string
+		comment := &entity.Comment{}
+		err = commentRows.Scan(&postID, &comment.UUID, &comment.Body, &comment.Likes)
+		if err != nil {
+			return nil, fmt.Errorf("can't process query result: %w", classify(err))
+		}
+		byID[postID].Comments = append(byID[postID].Comments, comment)
+	}
+	err = commentRows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error during query result iteration: %w", classify(err))
+	}
+	return posts, nil
+}
+
+// pgUpdateCommentBodiesSQL sets bodies of comments of a post in one statement,
+// its arrays of comment UUIDs and bodies are of the same length.
+const pgUpdateCommentBodiesSQL = `
+	UPDATE comments c SET body = u.body
+	FROM unnest($1::varchar[], $2::varchar[]) AS u(uuid, body)
+	WHERE c.uuid = u.uuid AND c.post_uuid = $3`
+
+// Update replaces post's title and reconciles its comments: new comments are inserted,
+// ones with changed body updated and missing ones deleted. Likes are left untouched.
+// The post is compare-and-swapped on its version first, so a concurrent write of the same
+// version waits for the row lock and then fails with ErrVersionMismatch.
+func (pg *pgRepo) Update(ctx context.Context, post *entity.RedditPost, version uint64) (found bool, err error) {
+	defer logCall(ctx, pg.logger, "posts.Update", time.Now(), &err, slog.String(logging.KeyPostID, post.UUID))
+
+	tx, err := pg.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelDefault, ReadOnly: false})
+	if err != nil {
+		return false, fmt.Errorf("can't create tx: %w", classify(err))
+	}
+
+	row := tx.QueryRowContext(ctx, `
+		UPDATE posts SET title = $2, version = version + 1, updated_at = now()
+		WHERE uuid = $1 AND ($3::bigint = 0 OR version = $3)
+		RETURNING version, updated_at`, post.UUID, post.Title, version)
+	err = row.Scan(&post.Version, &post.UpdatedAt)
+	if err == sql.ErrNoRows {
+		found, err := versionMiss(ctx, tx, "SELECT EXISTS (SELECT 1 FROM posts WHERE uuid = $1)", post.UUID, version)
+		return found, rollback(tx, err)
+	} else if err != nil {
+		return false, rollback(tx, fmt.Errorf("can't update post: %w", classify(err)))
+	}
+
+	existing := map[string]entity.Comment{}
+	rows, err := tx.QueryContext(ctx, "SELECT uuid, body, likes FROM comments WHERE post_uuid = $1 FOR UPDATE", post.UUID)
+	if err != nil {
+		return false, rollback(tx, fmt.Errorf("can't query 'comments' table: %w", classify(err)))
+	}
+	for rows.Next() {
+		comment := entity.Comment{}
+		if err := rows.Scan(&comment.UUID, &comment.Body, &comment.Likes); err != nil {
+			rows.Close()
+			return false, rollback(tx, fmt.Errorf("can't process query result: %w", classify(err)))
+		}
+		existing[comment.UUID] = comment
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, rollback(tx, fmt.Errorf("error during query result iteration: %w", classify(err)))
+	}
+
+	added := []*entity.Comment{}
+	var changedIDs, changedBodies []string
+	for _, c := range post.Comments {
+		old, ok := existing[c.UUID]
+		delete(existing, c.UUID)
+		switch {
+		case !ok:
+			added = append(added, c)
+		case old.Body != c.Body:
+			changedIDs, changedBodies = append(changedIDs, c.UUID), append(changedBodies, c.Body)
+		}
+	}
+	if len(changedIDs) > 0 {
+		_, err = tx.ExecContext(ctx, pgUpdateCommentBodiesSQL, changedIDs, changedBodies, post.UUID)
+		if err != nil {
+			return false, rollback(tx, fmt.Errorf("can't update comments: %w", classify(err)))
+		}
+	}
+
+	if err := insertComments(ctx, tx, post.UUID, added, ""); err != nil {
+		return false, rollback(tx, err)
+	}
+
+	if len(existing) > 0 {
+		missing := make([]string, 0, len(existing))
+		for uuid := range existing {
+			missing = append(missing, uuid)
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM comments WHERE uuid = ANY($1)", missing)
+		if err != nil {
+			return false, rollback(tx, fmt.Errorf("can't delete missing comments: %w", classify(err)))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("can't commit updating post: %w", classify(err))
+	}
+	return true, nil
+}
+
+func (pg *pgRepo) Like(ctx context.Context, postID string, delta int) (likes uint32, found bool, err error) {
+	defer logCall(ctx, pg.logger, "posts.Like", time.Now(), &err, slog.String(logging.KeyPostID, postID))
+
+	row := pg.db.QueryRowContext(ctx, `
+		UPDATE posts SET likes = COALESCE(likes, 0)::integer + $2::integer, version = version + 1, updated_at = now()
+		WHERE uuid = $1 AND COALESCE(likes, 0)::integer + $2::integer BETWEEN 0 AND $3
+		RETURNING likes`, postID, delta, maxLikes)
+	err = row.Scan(&likes)
+	if err == sql.ErrNoRows {
+		return likesMiss(ctx, pg.db, "SELECT EXISTS (SELECT 1 FROM posts WHERE uuid = $1)", postID)
+	} else if err != nil {
+		return 0, false, fmt.Errorf("can't update post likes: %w", classify(err))
+	}
+	return likes, true, nil
+}
+
+// likesMiss tells apart a missing row from a likes update that went out of range.
+func likesMiss(ctx context.Context, db *sql.DB, existsQuery string, args ...any) (likes uint32, found bool, err error) {
+	var exists bool
+	err = db.QueryRowContext(ctx, existsQuery, args...).Scan(&exists)
+	if err != nil {
+		return 0, false, fmt.Errorf("can't check row existence: %w", classify(err))
+	}
+	if exists {
+		return 0, true, handler.ErrLikesOutOfRange
+	}
+	return 0, false, nil
+}
+
+// versionMiss tells apart a missing post from one changed since the version a conditional
+// write is based on.
+func versionMiss(ctx context.Context, q rowQuerier, existsQuery string, postID string, version uint64) (found bool, err error) {
+	if version == 0 {
+		return false, nil
+	}
+	var exists bool
+	err = q.QueryRowContext(ctx, existsQuery, postID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("can't check post existence: %w", classify(err))
+	}
+	if exists {
+		return true, versionMismatch(postID, version)
+	}
+	return false, nil
+}
+
+// commentMiss is versionMiss for a conditional comment write that changed nothing, which
+// may also be caused by a missing comment of a post at the expected version. otherVersionQuery
+// tells whether post $1 exists at another version than $2.
+func commentMiss(ctx context.Context, q rowQuerier, otherVersionQuery string, postID string, version uint64) (found bool, err error) {
+	if version == 0 {
+		return false, nil
+	}
+	var otherVersion bool
+	err = q.QueryRowContext(ctx, otherVersionQuery, postID, version).Scan(&otherVersion)
+	if err != nil {
+		return false, fmt.Errorf("can't check post version: %w", classify(err))
+	}
+	if otherVersion {
+		return true, versionMismatch(postID, version)
+	}
+	return false, nil
+}
+
+func versionMismatch(postID string, version uint64) error {
+	return fmt.Errorf("%w: post uuid=%v isn't at version %v", handler.ErrVersionMismatch, postID, version)
+}
+
+// rowQuerier is implemented by both *sql.DB and *sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// rollback rolls tx back and returns err, joined with the rollback error if any.
+func rollback(tx *sql.Tx, err error) error {
+	if rbErr := tx.Rollback(); rbErr != nil {
+		if err == nil {
+			return fmt.Errorf("can't rollback tx: %w", rbErr)
+		}
+		return fmt.Errorf("can't rollback tx: %w, err: %w", rbErr, err)
+	}
+	return err
+}
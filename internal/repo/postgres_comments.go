@@ -0,0 +1,141 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/logging"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type pgCommentsRepo struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// NewPGCommentsRepo returns a repository logging its calls to logger, see logCall.
+func NewPGCommentsRepo(db *sql.DB, logger *slog.Logger) handler.CommentsRepo {
+	return &pgCommentsRepo{db, logger}
+}
+
+// Comment writes shared by the database/sql and pgxpool repositories. Each one increases
+// the version of the comment's post in the same statement and returns the new version.
+// Save, Update and Delete change the comment only when the post is at the version given
+// by their last parameter, zero means any: the post row is locked by a data-modifying
+// or FOR UPDATE CTE, and the changed comment is returned by another one, so the post
+// is updated only when the comment was.
+const (
+	pgSaveCommentSQL = `
+		WITH p AS (
+			UPDATE posts SET version = version + 1, updated_at = now()
+			WHERE uuid = $2 AND ($5::bigint = 0 OR version = $5::bigint)
+			RETURNING uuid, version
+		), c AS (INSERT INTO comments SELECT $1::varchar, p.uuid, $3::varchar, $4::smallint FROM p)
+		SELECT version FROM p`
+	pgUpdateCommentSQL = `
+		WITH p AS (SELECT uuid FROM posts WHERE uuid = $2 AND ($4::bigint = 0 OR version = $4::bigint) FOR UPDATE),
+		c AS (UPDATE comments SET body = $3 WHERE uuid = $1 AND post_uuid IN (SELECT uuid FROM p) RETURNING post_uuid)
+		UPDATE posts SET version = version + 1, updated_at = now() WHERE uuid IN (SELECT post_uuid FROM c)
+		RETURNING version`
+	pgDeleteCommentSQL = `
+		WITH p AS (SELECT uuid FROM posts WHERE uuid = $2 AND ($3::bigint = 0 OR version = $3::bigint) FOR UPDATE),
+		c AS (DELETE FROM comments WHERE uuid = $1 AND post_uuid IN (SELECT uuid FROM p) RETURNING post_uuid)
+		UPDATE posts SET version = version + 1, updated_at = now() WHERE uuid IN (SELECT post_uuid FROM c)
+		RETURNING version`
+	// pgOtherVersionSQL tells a post at another version from a missing post or comment
+	// when a conditional comment write changed nothing, see commentMiss
+	pgOtherVersionSQL = "SELECT EXISTS (SELECT 1 FROM posts WHERE uuid = $1 AND version <> $2)"
+	pgLikeCommentSQL  = `
+		WITH c AS (
+			UPDATE comments SET likes = COALESCE(likes, 0)::integer + $3::integer
+			WHERE uuid = $1 AND post_uuid = $2 AND COALESCE(likes, 0)::integer + $3::integer BETWEEN 0 AND $4
+			RETURNING post_uuid, likes
+		), p AS (UPDATE posts SET version = version + 1, updated_at = now() WHERE uuid IN (SELECT post_uuid FROM c))
+		SELECT likes FROM c`
+)
+
+func (pg *pgCommentsRepo) Save(ctx context.Context, postID string, comment *entity.Comment, version uint64) (postVersion uint64, found bool, err error) {
+	defer logCall(ctx, pg.logger, "comments.Save", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, comment.UUID))
+
+	row := pg.db.QueryRowContext(ctx, pgSaveCommentSQL, comment.UUID, postID, comment.Body, comment.Likes, version)
+	err = row.Scan(&postVersion)
+	if err == sql.ErrNoRows {
+		found, err = commentMiss(ctx, pg.db, pgOtherVersionSQL, postID, version)
+		return 0, found, err
+	} else if err != nil {
+		return 0, false, fmt.Errorf("can't insert comment: %w", classify(err))
+	}
+	return postVersion, true, nil
+}
+
+func (pg *pgCommentsRepo) Get(ctx context.Context, postID string, commentID string) (comment *entity.Comment, found bool, err error) {
+	defer logCall(ctx, pg.logger, "comments.Get", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, commentID))
+
+	comment = &entity.Comment{}
+
+	row := pg.db.QueryRowContext(ctx, "SELECT uuid, body, likes FROM comments WHERE uuid = $1 AND post_uuid = $2", commentID, postID)
+	err = row.Scan(&comment.UUID, &comment.Body, &comment.Likes)
+	if err == sql.ErrNoRows {
+		return comment, false, nil
+	} else if err != nil {
+		return comment, false, fmt.Errorf("can't query 'comments' table: %w", classify(err))
+	}
+	return comment, true, nil
+}
+
+func (pg *pgCommentsRepo) Update(ctx context.Context, postID string, comment *entity.Comment, version uint64) (postVersion uint64, found bool, err error) {
+	defer logCall(ctx, pg.logger, "comments.Update", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, comment.UUID))
+
+	row := pg.db.QueryRowContext(ctx, pgUpdateCommentSQL, comment.UUID, postID, comment.Body, version)
+	err = row.Scan(&postVersion)
+	if err == sql.ErrNoRows {
+		found, err = commentMiss(ctx, pg.db, pgOtherVersionSQL, postID, version)
+		return 0, found, err
+	} else if err != nil {
+		return 0, false, fmt.Errorf("can't update comment: %w", classify(err))
+	}
+	return postVersion, true, nil
+}
+
+func (pg *pgCommentsRepo) Delete(ctx context.Context, postID string, commentID string, version uint64) (postVersion uint64, found bool, err error) {
+	defer logCall(ctx, pg.logger, "comments.Delete", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, commentID))
+
+	row := pg.db.QueryRowContext(ctx, pgDeleteCommentSQL, commentID, postID, version)
+	err = row.Scan(&postVersion)
+	if err == sql.ErrNoRows {
+		found, err = commentMiss(ctx, pg.db, pgOtherVersionSQL, postID, version)
+		return 0, found, err
+	} else if err != nil {
+		return 0, false, fmt.Errorf("can't delete comment: %w", classify(err))
+	}
+	return postVersion, true, nil
+}
+
+func (pg *pgCommentsRepo) Like(ctx context.Context, postID string, commentID string, delta int) (likes uint32, found bool, err error) {
+	defer logCall(ctx, pg.logger, "comments.Like", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, commentID))
+
+	row := pg.db.QueryRowContext(ctx, pgLikeCommentSQL, commentID, postID, delta, maxLikes)
+	err = row.Scan(&likes)
+	if err == sql.ErrNoRows {
+		return likesMiss(ctx, pg.db, "SELECT EXISTS (SELECT 1 FROM comments WHERE uuid = $1 AND post_uuid = $2)", commentID, postID)
+	} else if err != nil {
+		return 0, false, fmt.Errorf("can't update comment likes: %w", classify(err))
+	}
+	return likes, true, nil
+}
+
+func affected(res sql.Result) (found bool, err error) {
+	num, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("can't determine affected rows: %w", classify(err))
+	}
+	return num > 0, nil
+}
@@ -0,0 +1,507 @@
+// Package repotest is a conformance suite for handler.RedditPostsRepo implementations,
+// so every storage backend is verified against identical behavior.
+package repotest
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Factory returns an empty repository. It's called once per test case.
+type Factory func(t *testing.T) handler.RedditPostsRepo
+
+// Run runs the whole suite against repositories made by newRepo.
+func Run(t *testing.T, newRepo Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo handler.RedditPostsRepo)
+	}{
+		{"SaveThenGet", testSaveThenGet},
+		{"GetMissing", testGetMissing},
+		{"EmptyComments", testEmptyComments},
+		{"DuplicatePostID", testDuplicatePostID},
+		{"DuplicateCommentID", testDuplicateCommentID},
+		{"SaveOverwrite", testSaveOverwrite},
+		{"SaveMerge", testSaveMerge},
+		{"UpsertCreates", testUpsertCreates},
+		{"UpsertForeignComment", testUpsertForeignComment},
+		{"Delete", testDelete},
+		{"DeleteCascadesComments", testDeleteCascadesComments},
+		{"Update", testUpdate},
+		{"UpdateMissing", testUpdateMissing},
+		{"Versions", testVersions},
+		{"VersionMismatch", testVersionMismatch},
+		{"Revision", testRevision},
+		{"ConcurrentVersionedUpdates", testConcurrentVersionedUpdates},
+		{"ListOrdering", testListOrdering},
+		{"Like", testLike},
+		{"ConcurrentSaves", testConcurrentSaves},
+		{"ConcurrentLikes", testConcurrentLikes},
+		{"CanceledContext", testCanceledContext},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, newRepo(t))
+		})
+	}
+}
+
+// Save saves a post rejecting conflicts, for tests setting up stored posts.
+func Save(ctx context.Context, repo handler.RedditPostsRepo, post *entity.RedditPost) error {
+	_, err := repo.Save(ctx, post, handler.ConflictReject, 0)
+	return err
+}
+
+func newPost(id string, commentIDs ...string) *entity.RedditPost {
+	post := &entity.RedditPost{UUID: id, Title: "Title of " + id, Likes: 3, Comments: []*entity.Comment{}}
+	for i, commentID := range commentIDs {
+		post.Comments = append(post.Comments, &entity.Comment{UUID: commentID, Body: "Body of " + commentID, Likes: uint32(i)})
+	}
+	return post
+}
+
+// mustGet returns the stored post, failing the test if it's missing.
+func mustGet(t *testing.T, repo handler.RedditPostsRepo, postID string) *entity.RedditPost {
+	t.Helper()
+	post, found, err := repo.Get(context.Background(), postID)
+	if err != nil {
+		t.Fatalf("can't get post uuid=%v: %s", postID, err)
+	}
+	if !found {
+		t.Fatalf("post uuid=%v isn't found", postID)
+	}
+	return post
+}
+
+// assertPost compares posts ignoring the order of comments, which isn't part of the contract.
+func assertPost(t *testing.T, expected *entity.RedditPost, actual *entity.RedditPost) {
+	t.Helper()
+	assert.Equal(t, expected.UUID, actual.UUID)
+	assert.Equal(t, expected.Title, actual.Title)
+	assert.Equal(t, expected.Likes, actual.Likes)
+	assert.ElementsMatch(t, expected.Comments, actual.Comments)
+}
+
+func testSaveThenGet(t *testing.T, repo handler.RedditPostsRepo) {
+	post := newPost("p1", "c1", "c2")
+	assert.Nil(t, Save(context.Background(), repo, post))
+
+	assertPost(t, newPost("p1", "c1", "c2"), mustGet(t, repo, "p1"))
+}
+
+func testGetMissing(t *testing.T, repo handler.RedditPostsRepo) {
+	_, found, err := repo.Get(context.Background(), "missing")
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+func testEmptyComments(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	withNil := newPost("p1")
+	withNil.Comments = nil
+	assert.Nil(t, Save(ctx, repo, withNil))
+	assert.Nil(t, Save(ctx, repo, newPost("p2")))
+
+	for _, id := range []string{"p1", "p2"} {
+		post := mustGet(t, repo, id)
+		assert.NotNil(t, post.Comments, "empty comments must be encoded as [] rather than null")
+		assert.Empty(t, post.Comments)
+	}
+}
+
+func testDuplicatePostID(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	assert.Nil(t, Save(ctx, repo, newPost("p1", "c1")))
+
+	duplicate := newPost("p1", "c2")
+	duplicate.Title = "Another title"
+	assert.ErrorIs(t, Save(ctx, repo, duplicate), handler.ErrConflict)
+	assertPost(t, newPost("p1", "c1"), mustGet(t, repo, "p1"))
+}
+
+func testDuplicateCommentID(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	assert.Nil(t, Save(ctx, repo, newPost("p1", "c1")))
+
+	assert.ErrorIs(t, Save(ctx, repo, newPost("p2", "c1")), handler.ErrConflict, "comment uuids are unique across posts")
+	assert.ErrorIs(t, Save(ctx, repo, newPost("p3", "c3", "c3")), handler.ErrConflict)
+	for _, id := range []string{"p2", "p3"} {
+		_, found, err := repo.Get(ctx, id)
+		assert.Nil(t, err)
+		assert.False(t, found, "failed save of post uuid=%v must not store anything", id)
+	}
+}
+
+// likedPost saves p1 with comments c1 and c2 and likes it twice, so it has 5 likes.
+func likedPost(t *testing.T, repo handler.RedditPostsRepo) {
+	t.Helper()
+	ctx := context.Background()
+	assert.Nil(t, Save(ctx, repo, newPost("p1", "c1", "c2")))
+	_, _, err := repo.Like(ctx, "p1", 2)
+	assert.Nil(t, err)
+}
+
+func testSaveOverwrite(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	likedPost(t, repo)
+
+	overwrite := &entity.RedditPost{
+		UUID:  "p1",
+		Title: "Overwritten title",
+		Comments: []*entity.Comment{
+			{UUID: "c2", Body: "Overwritten body"},
+			{UUID: "c3", Body: "New body"},
+		},
+	}
+	created, err := repo.Save(ctx, overwrite, handler.ConflictOverwrite, 0)
+	assert.Nil(t, err)
+	assert.False(t, created)
+	assertPost(t, overwrite, mustGet(t, repo, "p1"))
+
+	// c1 is gone with the overwritten comment set
+	assert.Nil(t, Save(ctx, repo, newPost("p2", "c1")))
+}
+
+func testSaveMerge(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	likedPost(t, repo)
+
+	merge := &entity.RedditPost{
+		UUID:  "p1",
+		Title: "Merged title",
+		Comments: []*entity.Comment{
+			{UUID: "c2", Body: "Merged body", Likes: 100},
+			{UUID: "c3", Body: "New body"},
+		},
+	}
+	created, err := repo.Save(ctx, merge, handler.ConflictMerge, 0)
+	assert.Nil(t, err)
+	assert.False(t, created)
+
+	expected := &entity.RedditPost{
+		UUID:  "p1",
+		Title: "Merged title",
+		Likes: 5,
+		Comments: []*entity.Comment{
+			{UUID: "c1", Body: "Body of c1"},
+			{UUID: "c2", Body: "Merged body", Likes: 1},
+			{UUID: "c3", Body: "New body"},
+		},
+	}
+	assertPost(t, expected, mustGet(t, repo, "p1"))
+}
+
+func testUpsertCreates(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	for i, policy := range []handler.ConflictPolicy{handler.ConflictOverwrite, handler.ConflictMerge} {
+		post := newPost(fmt.Sprintf("p%v", i), fmt.Sprintf("c%v", i))
+		created, err := repo.Save(ctx, post, policy, 0)
+		assert.Nil(t, err)
+		assert.True(t, created, "policy %v", policy)
+		assertPost(t, post, mustGet(t, repo, post.UUID))
+	}
+}
+
+func testUpsertForeignComment(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	assert.Nil(t, Save(ctx, repo, newPost("p1", "c1")))
+	assert.Nil(t, Save(ctx, repo, newPost("p2", "c2")))
+
+	for _, policy := range []handler.ConflictPolicy{handler.ConflictOverwrite, handler.ConflictMerge} {
+		for _, post := range []*entity.RedditPost{newPost("p2", "c1"), newPost("p3", "c1"), newPost("p2", "c3", "c3")} {
+			_, err := repo.Save(ctx, post, policy, 0)
+			assert.ErrorIs(t, err, handler.ErrConflict, "policy %v, post %v", policy, post.UUID)
+		}
+	}
+	assertPost(t, newPost("p1", "c1"), mustGet(t, repo, "p1"))
+	assertPost(t, newPost("p2", "c2"), mustGet(t, repo, "p2"))
+	_, found, err := repo.Get(ctx, "p3")
+	assert.Nil(t, err)
+	assert.False(t, found, "failed upsert must not store anything")
+}
+
+func testDelete(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	assert.Nil(t, Save(ctx, repo, newPost("p1", "c1")))
+
+	found, err := repo.Delete(ctx, "p1", 0)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	_, found, err = repo.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	found, err = repo.Delete(ctx, "p1", 0)
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+func testDeleteCascadesComments(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	assert.Nil(t, Save(ctx, repo, newPost("p1", "c1", "c2")))
+	_, err := repo.Delete(ctx, "p1", 0)
+	assert.Nil(t, err)
+
+	// comments of the deleted post are gone, so their uuids can be used again
+	assert.Nil(t, Save(ctx, repo, newPost("p2", "c1", "c2")))
+	assertPost(t, newPost("p2", "c1", "c2"), mustGet(t, repo, "p2"))
+	assert.Nil(t, Save(ctx, repo, newPost("p1")))
+	assert.Empty(t, mustGet(t, repo, "p1").Comments)
+}
+
+func testUpdate(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	assert.Nil(t, Save(ctx, repo, newPost("p1", "c1", "c2")))
+
+	updated := &entity.RedditPost{
+		UUID:  "p1",
+		Title: "Updated title",
+		Likes: 100,
+		Comments: []*entity.Comment{
+			{UUID: "c2", Body: "Updated body", Likes: 100},
+			{UUID: "c3", Body: "New body"},
+		},
+	}
+	found, err := repo.Update(ctx, updated, 0)
+	assert.Nil(t, err)
+	assert.True(t, found)
+
+	expected := &entity.RedditPost{
+		UUID:  "p1",
+		Title: "Updated title",
+		Likes: 3,
+		Comments: []*entity.Comment{
+			{UUID: "c2", Body: "Updated body", Likes: 1},
+			{UUID: "c3", Body: "New body"},
+		},
+	}
+	assertPost(t, expected, mustGet(t, repo, "p1"))
+}
+
+func testUpdateMissing(t *testing.T, repo handler.RedditPostsRepo) {
+	found, err := repo.Update(context.Background(), newPost("missing", "c1"), 0)
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+func testVersions(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	post := newPost("p1", "c1")
+	assert.Nil(t, Save(ctx, repo, post))
+	assert.Equal(t, uint64(1), post.Version, "Save sets the version of created post")
+	assert.Equal(t, uint64(1), mustGet(t, repo, "p1").Version)
+
+	updated := newPost("p1", "c1", "c2")
+	found, err := repo.Update(ctx, updated, 1)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, uint64(2), updated.Version)
+
+	_, _, err = repo.Like(ctx, "p1", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), mustGet(t, repo, "p1").Version, "likes change the post representation")
+
+	merged := newPost("p1")
+	created, err := repo.Save(ctx, merged, handler.ConflictMerge, 3)
+	assert.Nil(t, err)
+	assert.False(t, created)
+	assert.Equal(t, uint64(4), merged.Version)
+
+	posts, err := repo.List(ctx, "", 1)
+	assert.Nil(t, err)
+	if assert.Len(t, posts, 1) {
+		assert.Equal(t, uint64(4), posts[0].Version)
+	}
+}
+
+func testVersionMismatch(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	assert.Nil(t, Save(ctx, repo, newPost("p1", "c1")))
+	found, err := repo.Update(ctx, newPost("p1", "c1"), 1)
+	assert.Nil(t, err)
+	assert.True(t, found)
+
+	found, err = repo.Update(ctx, &entity.RedditPost{UUID: "p1", Title: "Stale title"}, 1)
+	assert.ErrorIs(t, err, handler.ErrVersionMismatch)
+	assert.True(t, found)
+	_, err = repo.Save(ctx, &entity.RedditPost{UUID: "p1", Title: "Stale title"}, handler.ConflictOverwrite, 1)
+	assert.ErrorIs(t, err, handler.ErrVersionMismatch)
+	found, err = repo.Delete(ctx, "p1", 1)
+	assert.ErrorIs(t, err, handler.ErrVersionMismatch)
+	assert.True(t, found)
+	stored := mustGet(t, repo, "p1")
+	assertPost(t, newPost("p1", "c1"), stored)
+	assert.Equal(t, uint64(2), stored.Version, "rejected writes must not change the post")
+
+	_, err = repo.Save(ctx, newPost("p2"), handler.ConflictOverwrite, 1)
+	assert.ErrorIs(t, err, handler.ErrVersionMismatch, "expected version of a missing post")
+	found, err = repo.Update(ctx, newPost("p2"), 1)
+	assert.Nil(t, err)
+	assert.False(t, found)
+	found, err = repo.Delete(ctx, "p2", 1)
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	found, err = repo.Delete(ctx, "p1", 2)
+	assert.Nil(t, err)
+	assert.True(t, found)
+}
+
+func testRevision(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	post := newPost("p1", "c1")
+	assert.Nil(t, Save(ctx, repo, post))
+	assert.False(t, post.UpdatedAt.IsZero(), "Save sets the modification time")
+
+	rev, found, err := repo.Revision(ctx, "p1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	stored := mustGet(t, repo, "p1")
+	assert.Equal(t, stored.Version, rev.Version)
+	assert.True(t, stored.UpdatedAt.Equal(rev.UpdatedAt), "Get and Revision report the same time")
+	assert.True(t, post.UpdatedAt.Equal(rev.UpdatedAt), "Save reports the stored time")
+
+	updated := newPost("p1")
+	_, err = repo.Update(ctx, updated, 0)
+	assert.Nil(t, err)
+	rev, _, err = repo.Revision(ctx, "p1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), rev.Version)
+	assert.False(t, rev.UpdatedAt.Before(stored.UpdatedAt))
+	assert.True(t, updated.UpdatedAt.Equal(rev.UpdatedAt), "Update reports the stored time")
+
+	_, found, err = repo.Revision(ctx, "missing")
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+// testConcurrentVersionedUpdates checks updates based on the same version are
+// compare-and-swapped: exactly one of them wins.
+func testConcurrentVersionedUpdates(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	assert.Nil(t, Save(ctx, repo, newPost("p1", "c1")))
+
+	const writers = 10
+	errs := make(chan error, writers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := repo.Update(ctx, &entity.RedditPost{UUID: "p1", Title: fmt.Sprintf("Title %v", i)}, 1)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, handler.ErrVersionMismatch)
+	}
+	assert.Equal(t, 1, succeeded)
+	assert.Equal(t, uint64(2), mustGet(t, repo, "p1").Version)
+}
+
+func testListOrdering(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	for _, id := range []string{"p3", "p1", "p4", "p2"} {
+		assert.Nil(t, Save(ctx, repo, newPost(id, "c"+id)))
+	}
+
+	listIDs := func(afterID string, limit int) []string {
+		posts, err := repo.List(ctx, afterID, limit)
+		assert.Nil(t, err)
+		ids := []string{}
+		for _, p := range posts {
+			assertPost(t, newPost(p.UUID, "c"+p.UUID), p)
+			ids = append(ids, p.UUID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"p1", "p2", "p3"}, listIDs("", 3))
+	assert.Equal(t, []string{"p3", "p4"}, listIDs("p2", 3))
+	assert.Equal(t, []string{}, listIDs("p4", 3))
+}
+
+func testLike(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx := context.Background()
+	assert.Nil(t, Save(ctx, repo, newPost("p1")))
+
+	likes, found, err := repo.Like(ctx, "p1", 1)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, uint32(4), likes)
+
+	_, _, err = repo.Like(ctx, "p1", -5)
+	assert.ErrorIs(t, err, handler.ErrLikesOutOfRange)
+	assert.Equal(t, uint32(4), mustGet(t, repo, "p1").Likes)
+
+	_, found, err = repo.Like(ctx, "missing", 1)
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+func testConcurrentSaves(t *testing.T, repo handler.RedditPostsRepo) {
+	const writers = 10
+	errs := make(chan error, writers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- Save(context.Background(), repo, newPost("p1", fmt.Sprintf("c%v", i)))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	saved := 0
+	for err := range errs {
+		if err == nil {
+			saved++
+		} else {
+			assert.ErrorIs(t, err, handler.ErrConflict)
+		}
+	}
+	assert.Equal(t, 1, saved, "exactly one of concurrent saves of a post must win")
+	assert.Len(t, mustGet(t, repo, "p1").Comments, 1)
+}
+
+func testConcurrentLikes(t *testing.T, repo handler.RedditPostsRepo) {
+	const likers = 20
+	assert.Nil(t, Save(context.Background(), repo, newPost("p1")))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < likers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := repo.Like(context.Background(), "p1", 1)
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, uint32(3+likers), mustGet(t, repo, "p1").Likes)
+}
+
+func testCanceledContext(t *testing.T, repo handler.RedditPostsRepo) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, Save(ctx, repo, newPost("p1")), handler.ErrCanceled)
+	_, _, err := repo.Get(ctx, "p1")
+	assert.ErrorIs(t, err, handler.ErrCanceled)
+	_, err = repo.List(ctx, "", 10)
+	assert.ErrorIs(t, err, handler.ErrCanceled)
+}
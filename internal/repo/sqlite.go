@@ -0,0 +1,497 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/logging"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// sqliteNow is the current time in Unix milliseconds, the unit posts.updated_at is stored in.
+const sqliteNow = "CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)"
+
+type sqliteRepo struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// NewSQLiteRepo returns a posts repository over a database opened with OpenSQLite
+// and migrated with migrate.SQLite, logging its calls to logger, see logCall.
+func NewSQLiteRepo(db *sql.DB, logger *slog.Logger) handler.RedditPostsRepo {
+	return &sqliteRepo{db, logger}
+}
+
+// Save uses the ON CONFLICT clauses of pgRepo.Save. The write lock is taken when the
+// transaction begins, so the post can't appear between checking and upserting it.
+func (lite *sqliteRepo) Save(ctx context.Context, post *entity.RedditPost, onConflict handler.ConflictPolicy, version uint64) (created bool, err error) {
+	defer logCall(ctx, lite.logger, "posts.Save", time.Now(), &err, slog.String(logging.KeyPostID, post.UUID))
+
+	if id, ok := repeatedComment(post.Comments); ok && onConflict != handler.ConflictReject {
+		// upserts would silently keep the last of them
+		return false, fmt.Errorf("can't insert post's comments: %w: comment uuid=%v is repeated", handler.ErrConflict, id)
+	}
+	tx, err := lite.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("can't create tx: %w", classify(err))
+	}
+
+	// versions start at 1, so zero tells the post doesn't exist
+	var stored uint64
+	err = tx.QueryRowContext(ctx, "SELECT version FROM posts WHERE uuid = ?", post.UUID).Scan(&stored)
+	if err != nil && err != sql.ErrNoRows {
+		return false, rollback(tx, fmt.Errorf("can't query post version: %w", classify(err)))
+	}
+	if version != 0 && stored != version {
+		return false, rollback(tx, versionMismatch(post.UUID, version))
+	}
+	created = stored == 0
+	var updatedAt int64
+	row := tx.QueryRowContext(ctx, "INSERT INTO posts (uuid, title, likes, updated_at) VALUES (?, ?, ?, "+sqliteNow+")"+postConflictSQL[onConflict]+" RETURNING version, updated_at",
+		post.UUID, post.Title, post.Likes)
+	if err := row.Scan(&post.Version, &updatedAt); err != nil {
+		return false, rollback(tx, fmt.Errorf("can't insert new post: %w", classify(err)))
+	}
+	post.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+	if !created && onConflict == handler.ConflictOverwrite {
+		if err := deleteSQLiteCommentsExcept(ctx, tx, post.UUID, post.Comments); err != nil {
+			return false, rollback(tx, err)
+		}
+	}
+	// SQLite statements are cheap to reuse within a transaction, so comments are inserted
+	// one by one instead of hitting the bound parameters limit with a multi-row insert
+	if err := insertSQLiteComments(ctx, tx, post.UUID, post.Comments, commentConflictSQL[onConflict]); err != nil {
+		return false, rollback(tx, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("can't commit inserting post: %w", classify(err))
+	}
+	return created, nil
+}
+
+// insertSQLiteComments appends onConflict to the insert statement, comments it skips
+// fail the insert with ErrConflict.
+func insertSQLiteComments(ctx context.Context, tx *sql.Tx, postID string, comments []*entity.Comment, onConflict string) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO comments VALUES (?, ?, ?, ?)"+onConflict)
+	if err != nil {
+		return fmt.Errorf("can't prepare comments insert: %w", classify(err))
+	}
+	defer stmt.Close()
+	for _, c := range comments {
+		res, err := stmt.ExecContext(ctx, c.UUID, postID, c.Body, c.Likes)
+		if err != nil {
+			return fmt.Errorf("can't insert comment uuid=%v: %w", c.UUID, classify(err))
+		}
+		if err := checkInserted(res, 1); err != nil {
+			return fmt.Errorf("can't insert comment uuid=%v: %w", c.UUID, err)
+		}
+	}
+	return nil
+}
+
+// deleteSQLiteCommentsExcept deletes comments of the post missing from kept.
+func deleteSQLiteCommentsExcept(ctx context.Context, tx *sql.Tx, postID string, kept []*entity.Comment) error {
+	keep := map[string]bool{}
+	for _, c := range kept {
+		keep[c.UUID] = true
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT uuid FROM comments WHERE post_uuid = ?", postID)
+	if err != nil {
+		return fmt.Errorf("can't query 'comments' table: %w", classify(err))
+	}
+	missing := []string{}
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			rows.Close()
+			return fmt.Errorf("can't process query result: %w", classify(err))
+		}
+		if !keep[uuid] {
+			missing = append(missing, uuid)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error during query result iteration: %w", classify(err))
+	}
+	for _, uuid := range missing {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM comments WHERE uuid = ?", uuid); err != nil {
+			return fmt.Errorf("can't delete missing comment uuid=%v: %w", uuid, classify(err))
+		}
+	}
+	return nil
+}
+
+// repeatedComment returns the first comment uuid repeated within comments.
+func repeatedComment(comments []*entity.Comment) (string, bool) {
+	seen := map[string]bool{}
+	for _, c := range comments {
+		if seen[c.UUID] {
+			return c.UUID, true
+		}
+		seen[c.UUID] = true
+	}
+	return "", false
+}
+
+func (lite *sqliteRepo) Get(ctx context.Context, postID string) (post *entity.RedditPost, found bool, err error) {
+	defer logCall(ctx, lite.logger, "posts.Get", time.Now(), &err, slog.String(logging.KeyPostID, postID))
+
+	post = &entity.RedditPost{}
+
+	var updatedAt int64
+	row := lite.db.QueryRowContext(ctx, "SELECT uuid, title, likes, version, updated_at FROM posts WHERE uuid = ?", postID)
+	err = row.Scan(&post.UUID, &post.Title, &post.Likes, &post.Version, &updatedAt)
+	if err == sql.ErrNoRows {
+		return post, false, nil
+	} else if err != nil {
+		return post, false, fmt.Errorf("can't query 'posts' table: %w", classify(err))
+	}
+	post.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+
+	byID := map[string]*entity.RedditPost{postID: post}
+	if err := lite.queryComments(ctx, byID, []string{postID}); err != nil {
+		return nil, false, err
+	}
+	return post, true, nil
+}
+
+// queryComments appends comments of posts with postIDs to their entries in byID,
+// in the order they were inserted.
+func (lite *sqliteRepo) queryComments(ctx context.Context, byID map[string]*entity.RedditPost, postIDs []string) error {
+	for _, id := range postIDs {
+		byID[id].Comments = []*entity.Comment{}
+	}
+	query := "SELECT post_uuid, uuid, body, likes FROM comments WHERE post_uuid IN (" + placeholders(len(postIDs)) + ") ORDER BY rowid"
+	rows, err := lite.db.QueryContext(ctx, query, anys(postIDs)...)
+	if err != nil {
+		return fmt.Errorf("can't query 'comments' table: %w", classify(err))
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var postID string
+		comment := &entity.Comment{}
+		err = rows.Scan(&postID, &comment.UUID, &comment.Body, &comment.Likes)
+		if err != nil {
+			return fmt.Errorf("can't process query result: %w", classify(err))
+		}
+		byID[postID].Comments = append(byID[postID].Comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error during query result iteration: %w", classify(err))
+	}
+	return nil
+}
+
+func (lite *sqliteRepo) Revision(ctx context.Context, postID string) (rev handler.Revision, found bool, err error) {
+	defer logCall(ctx, lite.logger, "posts.Revision", time.Now(), &err, slog.String(logging.KeyPostID, postID))
+
+	var updatedAt int64
+	row := lite.db.QueryRowContext(ctx, "SELECT version, updated_at FROM posts WHERE uuid = ?", postID)
+	err = row.Scan(&rev.Version, &updatedAt)
+	if err == sql.ErrNoRows {
+		return rev, false, nil
+	} else if err != nil {
+		return rev, false, fmt.Errorf("can't query 'posts' table: %w", classify(err))
+	}
+	rev.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+	return rev, true, nil
+}
+
+// Delete relies on the foreign key, enabled for every connection by OpenSQLite, to delete comments.
+func (lite *sqliteRepo) Delete(ctx context.Context, postID string, version uint64) (found bool, err error) {
+	defer logCall(ctx, lite.logger, "posts.Delete", time.Now(), &err, slog.String(logging.KeyPostID, postID))
+
+	res, err := lite.db.ExecContext(ctx, "DELETE FROM posts WHERE uuid = ?1 AND (?2 = 0 OR version = ?2)", postID, version)
+	if err != nil {
+		return false, fmt.Errorf("can't delete post: %w", classify(err))
+	}
+	found, err = affected(res)
+	if err != nil || found {
+		return found, err
+	}
+	return versionMiss(ctx, lite.db, "SELECT EXISTS (SELECT 1 FROM posts WHERE uuid = ?)", postID, version)
+}
+
+func (lite *sqliteRepo) List(ctx context.Context, afterID string, limit int) (posts []*entity.RedditPost, err error) {
+	defer logCall(ctx, lite.logger, "posts.List", time.Now(), &err)
+
+	rows, err := lite.db.QueryContext(ctx, "SELECT uuid, title, likes, version, updated_at FROM posts WHERE uuid > ? ORDER BY uuid LIMIT ?", afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't query 'posts' table: %w", classify(err))
+	}
+	defer rows.Close()
+
+	posts = []*entity.RedditPost{}
+	byID := map[string]*entity.RedditPost{}
+	postIDs := []string{}
+	for rows.Next() {
+		post := &entity.RedditPost{}
+		var updatedAt int64
+		err = rows.Scan(&post.UUID, &post.Title, &post.Likes, &post.Version, &updatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("can't process query result: %w", classify(err))
+		}
+		post.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+		posts = append(posts, post)
+		byID[post.UUID] = post
+		postIDs = append(postIDs, post.UUID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during query result iteration: %w", classify(err))
+	}
+	rows.Close()
+	if len(posts) == 0 {
+		return posts, nil
+	}
+
+	if err := lite.queryComments(ctx, byID, postIDs); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// Update reconciles comments the same way pgRepo.Update does. The write lock is taken
+// when the transaction begins, so comments can't change between reading and writing them.
+func (lite *sqliteRepo) Update(ctx context.Context, post *entity.RedditPost, version uint64) (found bool, err error) {
+	defer logCall(ctx, lite.logger, "posts.Update", time.Now(), &err, slog.String(logging.KeyPostID, post.UUID))
+
+	tx, err := lite.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("can't create tx: %w", classify(err))
+	}
+
+	var updatedAt int64
+	row := tx.QueryRowContext(ctx, `
+		UPDATE posts SET title = ?2, version = version + 1, updated_at = `+sqliteNow+`
+		WHERE uuid = ?1 AND (?3 = 0 OR version = ?3)
+		RETURNING version, updated_at`, post.UUID, post.Title, version)
+	err = row.Scan(&post.Version, &updatedAt)
+	if err == sql.ErrNoRows {
+		found, err := versionMiss(ctx, tx, "SELECT EXISTS (SELECT 1 FROM posts WHERE uuid = ?)", post.UUID, version)
+		return found, rollback(tx, err)
+	} else if err != nil {
+		return false, rollback(tx, fmt.Errorf("can't update post: %w", classify(err)))
+	}
+	post.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+
+	existing := map[string]string{}
+	rows, err := tx.QueryContext(ctx, "SELECT uuid, body FROM comments WHERE post_uuid = ?", post.UUID)
+	if err != nil {
+		return false, rollback(tx, fmt.Errorf("can't query 'comments' table: %w", classify(err)))
+	}
+	for rows.Next() {
+		var uuid, body string
+		if err := rows.Scan(&uuid, &body); err != nil {
+			rows.Close()
+			return false, rollback(tx, fmt.Errorf("can't process query result: %w", classify(err)))
+		}
+		existing[uuid] = body
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, rollback(tx, fmt.Errorf("error during query result iteration: %w", classify(err)))
+	}
+
+	added := []*entity.Comment{}
+	for _, c := range post.Comments {
+		body, ok := existing[c.UUID]
+		delete(existing, c.UUID)
+		switch {
+		case !ok:
+			added = append(added, c)
+		case body != c.Body:
+			_, err = tx.ExecContext(ctx, "UPDATE comments SET body = ? WHERE uuid = ?", c.Body, c.UUID)
+			if err != nil {
+				return false, rollback(tx, fmt.Errorf("can't update comment uuid=%v: %w", c.UUID, classify(err)))
+			}
+		}
+	}
+	if err := insertSQLiteComments(ctx, tx, post.UUID, added, ""); err != nil {
+		return false, rollback(tx, err)
+	}
+	for uuid := range existing {
+		_, err = tx.ExecContext(ctx, "DELETE FROM comments WHERE uuid = ?", uuid)
+		if err != nil {
+			return false, rollback(tx, fmt.Errorf("can't delete missing comment uuid=%v: %w", uuid, classify(err)))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("can't commit updating post: %w", classify(err))
+	}
+	return true, nil
+}
+
+func (lite *sqliteRepo) Like(ctx context.Context, postID string, delta int) (likes uint32, found bool, err error) {
+	defer logCall(ctx, lite.logger, "posts.Like", time.Now(), &err, slog.String(logging.KeyPostID, postID))
+
+	row := lite.db.QueryRowContext(ctx, `
+		UPDATE posts SET likes = COALESCE(likes, 0) + ?2, version = version + 1, updated_at = `+sqliteNow+`
+		WHERE uuid = ?1 AND COALESCE(likes, 0) + ?2 BETWEEN 0 AND ?3
+		RETURNING likes`, postID, delta, maxLikes)
+	err = row.Scan(&likes)
+	if err == sql.ErrNoRows {
+		return likesMiss(ctx, lite.db, "SELECT EXISTS (SELECT 1 FROM posts WHERE uuid = ?)", postID)
+	} else if err != nil {
+		return 0, false, fmt.Errorf("can't update post likes: %w", classify(err))
+	}
+	return likes, true, nil
+}
+
+type sqliteCommentsRepo struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// NewSQLiteCommentsRepo returns a repository logging its calls to logger, see logCall.
+func NewSQLiteCommentsRepo(db *sql.DB, logger *slog.Logger) handler.CommentsRepo {
+	return &sqliteCommentsRepo{db, logger}
+}
+
+// Comment writes increase the version of the post in the same transaction, as SQLite
+// has no data-modifying CTEs pgCommentsRepo does that with.
+func (lite *sqliteCommentsRepo) Save(ctx context.Context, postID string, comment *entity.Comment, version uint64) (postVersion uint64, found bool, err error) {
+	defer logCall(ctx, lite.logger, "comments.Save", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, comment.UUID))
+
+	tx, err := lite.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("can't create tx: %w", classify(err))
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO comments VALUES (?, ?, ?, ?)", comment.UUID, postID, comment.Body, comment.Likes)
+	err = classify(err)
+	if errors.Is(err, handler.ErrNotFound) {
+		return 0, false, rollback(tx, nil)
+	} else if err != nil {
+		return 0, false, rollback(tx, fmt.Errorf("can't insert comment: %w", err))
+	}
+	return lite.commitComment(ctx, tx, postID, version)
+}
+
+// commitComment increases the version of the post of a changed comment and commits tx.
+// The change is rolled back when the post isn't at the non-zero version.
+func (lite *sqliteCommentsRepo) commitComment(ctx context.Context, tx *sql.Tx, postID string, version uint64) (postVersion uint64, found bool, err error) {
+	row := tx.QueryRowContext(ctx,
+		"UPDATE posts SET version = version + 1, updated_at = "+sqliteNow+" WHERE uuid = ?1 AND (?2 = 0 OR version = ?2) RETURNING version",
+		postID, version)
+	err = row.Scan(&postVersion)
+	if err == sql.ErrNoRows {
+		if err := rollback(tx, nil); err != nil {
+			return 0, false, err
+		}
+		found, err = commentMiss(ctx, lite.db, "SELECT EXISTS (SELECT 1 FROM posts WHERE uuid = ? AND version <> ?)", postID, version)
+		return 0, found, err
+	} else if err != nil {
+		return 0, false, rollback(tx, fmt.Errorf("can't update post version: %w", classify(err)))
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("can't commit changing comment: %w", classify(err))
+	}
+	return postVersion, true, nil
+}
+
+func (lite *sqliteCommentsRepo) Get(ctx context.Context, postID string, commentID string) (comment *entity.Comment, found bool, err error) {
+	defer logCall(ctx, lite.logger, "comments.Get", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, commentID))
+
+	comment = &entity.Comment{}
+
+	row := lite.db.QueryRowContext(ctx, "SELECT uuid, body, likes FROM comments WHERE uuid = ? AND post_uuid = ?", commentID, postID)
+	err = row.Scan(&comment.UUID, &comment.Body, &comment.Likes)
+	if err == sql.ErrNoRows {
+		return comment, false, nil
+	} else if err != nil {
+		return comment, false, fmt.Errorf("can't query 'comments' table: %w", classify(err))
+	}
+	return comment, true, nil
+}
+
+func (lite *sqliteCommentsRepo) Update(ctx context.Context, postID string, comment *entity.Comment, version uint64) (postVersion uint64, found bool, err error) {
+	defer logCall(ctx, lite.logger, "comments.Update", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, comment.UUID))
+
+	tx, err := lite.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("can't create tx: %w", classify(err))
+	}
+	res, err := tx.ExecContext(ctx,
+		"UPDATE comments SET body = ? WHERE uuid = ? AND post_uuid = ?",
+		comment.Body, comment.UUID, postID)
+	if err != nil {
+		return 0, false, rollback(tx, fmt.Errorf("can't update comment: %w", classify(err)))
+	}
+	found, err = affected(res)
+	if err != nil || !found {
+		return 0, false, rollback(tx, err)
+	}
+	return lite.commitComment(ctx, tx, postID, version)
+}
+
+func (lite *sqliteCommentsRepo) Delete(ctx context.Context, postID string, commentID string, version uint64) (postVersion uint64, found bool, err error) {
+	defer logCall(ctx, lite.logger, "comments.Delete", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, commentID))
+
+	tx, err := lite.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("can't create tx: %w", classify(err))
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM comments WHERE uuid = ? AND post_uuid = ?", commentID, postID)
+	if err != nil {
+		return 0, false, rollback(tx, fmt.Errorf("can't delete comment: %w", classify(err)))
+	}
+	found, err = affected(res)
+	if err != nil || !found {
+		return 0, false, rollback(tx, err)
+	}
+	return lite.commitComment(ctx, tx, postID, version)
+}
+
+func (lite *sqliteCommentsRepo) Like(ctx context.Context, postID string, commentID string, delta int) (likes uint32, found bool, err error) {
+	defer logCall(ctx, lite.logger, "comments.Like", time.Now(), &err,
+		slog.String(logging.KeyPostID, postID), slog.String(logging.KeyCommentID, commentID))
+
+	tx, err := lite.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("can't create tx: %w", classify(err))
+	}
+	row := tx.QueryRowContext(ctx, `
+		UPDATE comments SET likes = COALESCE(likes, 0) + ?3
+		WHERE uuid = ?1 AND post_uuid = ?2 AND COALESCE(likes, 0) + ?3 BETWEEN 0 AND ?4
+		RETURNING likes`, commentID, postID, delta, maxLikes)
+	err = row.Scan(&likes)
+	if err == sql.ErrNoRows {
+		if err := rollback(tx, nil); err != nil {
+			return 0, false, err
+		}
+		return likesMiss(ctx, lite.db, "SELECT EXISTS (SELECT 1 FROM comments WHERE uuid = ? AND post_uuid = ?)", commentID, postID)
+	} else if err != nil {
+		return 0, false, rollback(tx, fmt.Errorf("can't update comment likes: %w", classify(err)))
+	}
+	if _, _, err := lite.commitComment(ctx, tx, postID, 0); err != nil {
+		return 0, false, err
+	}
+	return likes, true, nil
+}
+
+// placeholders returns n comma separated ? placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func anys(values []string) []any {
+	args := make([]any, 0, len(values))
+	for _, v := range values {
+		args = append(args, v)
+	}
+	return args
+}
@@ -0,0 +1,117 @@
+package repo_test
+
+import (
+	"context"
+	"database/sql"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/handler"
+	"dmmak/simple-rest-crud/internal/migrate"
+	"dmmak/simple-rest-crud/internal/repo"
+	"dmmak/simple-rest-crud/internal/repo/repotest"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// openSQLite returns a migrated database in a file removed after the test.
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	ctx := context.Background()
+	db, driver, err := repo.Open(ctx, "sqlite://"+filepath.Join(t.TempDir(), "posts.db"), repo.Pool{MaxOpenConns: 4, MaxIdleConns: 4})
+	if err != nil {
+		t.Fatalf("can't open db: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	assert.Equal(t, repo.DriverSQLite, driver)
+
+	migrator, err := migrate.New(db, migrate.SQLite)
+	if err != nil {
+		t.Fatalf("can't create migrator: %s", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("can't migrate db: %s", err)
+	}
+	return db
+}
+
+func TestSQLiteRepoContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) handler.RedditPostsRepo {
+		return repo.NewSQLiteRepo(openSQLite(t), slog.Default())
+	})
+}
+
+func TestSQLiteCommentsRepo(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	posts := repo.NewSQLiteRepo(db, slog.Default())
+	comments := repo.NewSQLiteCommentsRepo(db, slog.Default())
+	assert.Nil(t, repotest.Save(ctx, posts, &entity.RedditPost{UUID: "p1", Title: "Post"}))
+
+	_, found, err := comments.Save(ctx, "missing", &entity.Comment{UUID: "c1", Body: "Body"}, 1)
+	assert.Nil(t, err)
+	assert.False(t, found)
+	version, found, err := comments.Save(ctx, "p1", &entity.Comment{UUID: "c1", Body: "Body"}, 1)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, uint64(2), version)
+	_, _, err = comments.Save(ctx, "p1", &entity.Comment{UUID: "c1", Body: "Body"}, 0)
+	assert.ErrorIs(t, err, handler.ErrConflict)
+	_, found, err = comments.Save(ctx, "p1", &entity.Comment{UUID: "c2", Body: "Body"}, 1)
+	assert.ErrorIs(t, err, handler.ErrVersionMismatch)
+	assert.True(t, found)
+
+	_, found, err = comments.Update(ctx, "p1", &entity.Comment{UUID: "c1", Body: "Stale"}, 1)
+	assert.ErrorIs(t, err, handler.ErrVersionMismatch)
+	assert.True(t, found)
+	version, found, err = comments.Update(ctx, "p1", &entity.Comment{UUID: "c1", Body: "Updated"}, 2)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, uint64(3), version)
+	likes, found, err := comments.Like(ctx, "p1", "c1", 2)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, uint32(2), likes)
+	_, _, err = comments.Like(ctx, "p1", "c1", -3)
+	assert.ErrorIs(t, err, handler.ErrLikesOutOfRange)
+
+	comment, found, err := comments.Get(ctx, "p1", "c1")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, &entity.Comment{UUID: "c1", Body: "Updated", Likes: 2}, comment)
+	_, found, err = comments.Get(ctx, "p2", "c1")
+	assert.Nil(t, err)
+	assert.False(t, found, "comment must belong to the post")
+
+	_, found, err = comments.Delete(ctx, "p1", "c1", 0)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	_, found, err = comments.Delete(ctx, "p1", "c1", 5)
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	post, _, err := posts.Get(ctx, "p1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), post.Version, "every successful comment write increases the post version")
+}
+
+func TestSQLiteRepoErrors(t *testing.T) {
+	ctx := context.Background()
+	posts := repo.NewSQLiteRepo(openSQLite(t), slog.Default())
+
+	err := repotest.Save(ctx, posts, &entity.RedditPost{UUID: "p1", Title: strings.Repeat("a", 257)})
+	assert.ErrorIs(t, err, handler.ErrValidation)
+	err = repotest.Save(ctx, posts, &entity.RedditPost{UUID: "p1", Title: "Post", Comments: []*entity.Comment{{UUID: "c1", Body: strings.Repeat("a", 4001)}}})
+	assert.ErrorIs(t, err, handler.ErrValidation)
+	_, found, _ := posts.Get(ctx, "p1")
+	assert.False(t, found, "failed save must not store anything")
+}
+
+func TestSQLiteOpenErrors(t *testing.T) {
+	_, _, err := repo.Open(context.Background(), "mysql://localhost/posts", repo.Pool{MaxOpenConns: 1})
+	assert.Error(t, err)
+	_, _, err = repo.Open(context.Background(), "sqlite://"+filepath.Join(t.TempDir(), "missing", "posts.db"), repo.Pool{MaxOpenConns: 1})
+	assert.ErrorIs(t, err, handler.ErrUnavailable)
+}
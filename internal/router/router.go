@@ -0,0 +1,200 @@
+// Package router dispatches requests by method and path pattern. Patterns are made of
+// literal segments and {name} parameters, e.g. /post/{postID}/comments/{commentID}.
+// A path matches a pattern when it has as many segments, literals are equal and every
+// parameter parses as its declared type.
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ParamType is implemented by Param, it declares how segments of a parameter are parsed.
+type ParamType interface {
+	paramName() string
+	parseAny(segment string) (any, error)
+}
+
+// Param is a typed path parameter, its value is read by handlers of matching routes.
+type Param[T any] struct {
+	name  string
+	parse func(segment string) (T, error)
+}
+
+// NewParam declares the {name} parameter, paths whose segment parse fails don't match.
+func NewParam[T any](name string, parse func(segment string) (T, error)) Param[T] {
+	return Param[T]{name: name, parse: parse}
+}
+
+func (p Param[T]) paramName() string {
+	return p.name
+}
+
+func (p Param[T]) parseAny(segment string) (any, error) {
+	return p.parse(segment)
+}
+
+// Value returns the parameter of the route r was dispatched to,
+// the zero value when its pattern has no such parameter.
+func (p Param[T]) Value(r *http.Request) T {
+	value, _ := paramsOf(r)[p.name].(T)
+	return value
+}
+
+type paramsKey struct{}
+
+func paramsOf(r *http.Request) map[string]any {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]any)
+	return params
+}
+
+// Router is an http.Handler, routes are added before it starts serving.
+type Router struct {
+	// NotFound answers requests no pattern matches, http.NotFound by default.
+	NotFound http.HandlerFunc
+	// MethodNotAllowed answers requests whose path matches but method doesn't,
+	// the Allow header is set beforehand.
+	MethodNotAllowed http.HandlerFunc
+
+	params map[string]ParamType
+	routes []*route
+}
+
+type route struct {
+	pattern  string
+	segments []segment
+	handlers map[string]http.Handler
+}
+
+// segment is either a literal or a parameter.
+type segment struct {
+	literal string
+	param   ParamType
+}
+
+// New returns a router whose patterns may use params.
+func New(params ...ParamType) *Router {
+	rt := &Router{
+		NotFound: http.NotFound,
+		MethodNotAllowed: func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		},
+		params: map[string]ParamType{},
+	}
+	for _, p := range params {
+		rt.params[p.paramName()] = p
+	}
+	return rt
+}
+
+// Handle routes requests of method matching pattern to h. It panics on malformed patterns,
+// undeclared parameters and routes registered twice, like http.ServeMux does.
+func (rt *Router) Handle(method string, pattern string, h http.Handler) {
+	for _, rte := range rt.routes {
+		if rte.pattern != pattern {
+			continue
+		}
+		if _, ok := rte.handlers[method]; ok {
+			panic(fmt.Sprintf("router: %v %v is already registered", method, pattern))
+		}
+		rte.handlers[method] = h
+		return
+	}
+	rte := &route{pattern: pattern, handlers: map[string]http.Handler{method: h}}
+	for _, s := range splitPath(pattern) {
+		if s == "" {
+			panic(fmt.Sprintf("router: pattern %q has an empty segment", pattern))
+		}
+		if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+			rte.segments = append(rte.segments, segment{literal: s})
+			continue
+		}
+		param, ok := rt.params[s[1:len(s)-1]]
+		if !ok {
+			panic(fmt.Sprintf("router: parameter %v of pattern %q isn't declared", s, pattern))
+		}
+		rte.segments = append(rte.segments, segment{param: param})
+	}
+	rt.routes = append(rt.routes, rte)
+}
+
+func (rt *Router) HandleFunc(method string, pattern string, h http.HandlerFunc) {
+	rt.Handle(method, pattern, h)
+}
+
+// ServeHTTP dispatches r to the first route matching its path and method. HEAD requests
+// fall back to the GET handler of the route, net/http drops the body they write.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := splitPath(r.URL.Path)
+	allowed := map[string]bool{}
+	for _, rte := range rt.routes {
+		params, ok := rte.match(segments)
+		if !ok {
+			continue
+		}
+		h, ok := rte.handler(r.Method)
+		if !ok {
+			for method := range rte.handlers {
+				allowed[method] = true
+			}
+			if _, ok := rte.handlers[http.MethodGet]; ok {
+				allowed[http.MethodHead] = true
+			}
+			continue
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), paramsKey{}, params)))
+		return
+	}
+	if len(allowed) == 0 {
+		rt.NotFound(w, r)
+		return
+	}
+	methods := make([]string, 0, len(allowed))
+	for method := range allowed {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	rt.MethodNotAllowed(w, r)
+}
+
+func (rte *route) handler(method string) (http.Handler, bool) {
+	h, ok := rte.handlers[method]
+	if !ok && method == http.MethodHead {
+		h, ok = rte.handlers[http.MethodGet]
+	}
+	return h, ok
+}
+
+func (rte *route) match(segments []string) (map[string]any, bool) {
+	if len(segments) != len(rte.segments) {
+		return nil, false
+	}
+	params := map[string]any{}
+	for i, s := range rte.segments {
+		if s.param == nil {
+			if segments[i] != s.literal {
+				return nil, false
+			}
+			continue
+		}
+		value, err := s.param.parseAny(segments[i])
+		if err != nil {
+			return nil, false
+		}
+		params[s.param.paramName()] = value
+	}
+	return params, true
+}
+
+// splitPath returns segments of path, a single trailing slash is ignored.
+func splitPath(path string) []string {
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,104 @@
+package router_test
+
+import (
+	"dmmak/simple-rest-crud/internal/router"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	userID = router.NewParam("userID", func(s string) (int, error) {
+		return strconv.Atoi(s)
+	})
+	slug = router.NewParam("slug", func(s string) (string, error) {
+		if len(s) > 8 {
+			return "", errors.New("slug is too long")
+		}
+		return s, nil
+	})
+)
+
+func newRouter() *router.Router {
+	rt := router.New(userID, slug)
+	respond := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%v user=%v slug=%v", name, userID.Value(r), slug.Value(r))
+		}
+	}
+	rt.HandleFunc(http.MethodGet, "/users", respond("list"))
+	rt.HandleFunc(http.MethodPost, "/users", respond("create"))
+	rt.HandleFunc(http.MethodGet, "/users/{userID}", respond("get"))
+	rt.HandleFunc(http.MethodDelete, "/users/{userID}", respond("delete"))
+	rt.HandleFunc(http.MethodPut, "/users/{userID}/posts/{slug}", respond("put post"))
+	return rt
+}
+
+func TestRouter(t *testing.T) {
+	tests := []struct {
+		method        string
+		path          string
+		expStatusCode int
+		expBody       string
+		expAllow      string
+	}{
+		{method: http.MethodGet, path: "/users", expStatusCode: http.StatusOK, expBody: "list user=0 slug="},
+		{method: http.MethodPost, path: "/users/", expStatusCode: http.StatusOK, expBody: "create user=0 slug="},
+		{method: http.MethodGet, path: "/users/42", expStatusCode: http.StatusOK, expBody: "get user=42 slug="},
+		{method: http.MethodPut, path: "/users/42/posts/hello", expStatusCode: http.StatusOK, expBody: "put post user=42 slug=hello"},
+		{method: http.MethodHead, path: "/users/42", expStatusCode: http.StatusOK, expBody: "get user=42 slug="},
+		{method: http.MethodHead, path: "/users/42/posts/hello", expStatusCode: http.StatusMethodNotAllowed, expAllow: "PUT"},
+		{method: http.MethodDelete, path: "/users", expStatusCode: http.StatusMethodNotAllowed, expAllow: "GET, HEAD, POST"},
+		{method: http.MethodPost, path: "/users/42", expStatusCode: http.StatusMethodNotAllowed, expAllow: "DELETE, GET, HEAD"},
+		{method: http.MethodGet, path: "/users/42/posts/hello", expStatusCode: http.StatusMethodNotAllowed, expAllow: "PUT"},
+		{method: http.MethodGet, path: "/users/x42", expStatusCode: http.StatusNotFound},
+		{method: http.MethodPut, path: "/users/42/posts/too-long-slug", expStatusCode: http.StatusNotFound},
+		{method: http.MethodGet, path: "/users/42/extra", expStatusCode: http.StatusNotFound},
+		{method: http.MethodGet, path: "/users//", expStatusCode: http.StatusNotFound},
+		{method: http.MethodGet, path: "/", expStatusCode: http.StatusNotFound},
+	}
+	rt := newRouter()
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			rt.ServeHTTP(rr, httptest.NewRequest(test.method, test.path, nil))
+
+			assert.Equal(t, test.expStatusCode, rr.Code)
+			assert.Equal(t, test.expAllow, rr.Header().Get("Allow"))
+			if test.expBody != "" {
+				assert.Equal(t, test.expBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouterCustomResponses(t *testing.T) {
+	rt := newRouter()
+	rt.NotFound = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+	rt.MethodNotAllowed = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}
+
+	rr := httptest.NewRecorder()
+	rt.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusTeapot, rr.Code)
+
+	rr = httptest.NewRecorder()
+	rt.ServeHTTP(rr, httptest.NewRequest(http.MethodPatch, "/users/1", nil))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, "DELETE, GET, HEAD", rr.Header().Get("Allow"))
+}
+
+func TestRouterPanics(t *testing.T) {
+	rt := newRouter()
+	assert.Panics(t, func() { rt.HandleFunc(http.MethodGet, "/users", nil) })
+	assert.Panics(t, func() { rt.HandleFunc(http.MethodGet, "/groups/{groupID}", nil) })
+	assert.Panics(t, func() { rt.HandleFunc(http.MethodGet, "/groups//members", nil) })
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// abortTimeout bounds how long Run waits for handlers cut off by Close when draining
+// timed out. Their request contexts are canceled, so they return at their next repository call.
+const abortTimeout = 5 * time.Second
+
+// Server runs an http.Server until its context is done, then drains in-flight requests
+// and closes registered resources in reverse order of registration, so resources
+// requests depend on (like the DB pool) outlive both the requests and the workers using them.
+type Server struct {
+	srv          *http.Server
+	drainTimeout time.Duration
+	certFile     string
+	keyFile      string
+	closers      []closer
+
+	// handlers counts running handlers, mu guards adding to it once Run waits for them
+	mu       sync.RWMutex
+	handlers sync.WaitGroup
+	closing  bool
+}
+
+type closer struct {
+	name  string
+	close func(ctx context.Context) error
+}
+
+// New wraps the handler of srv to track running handlers, so Run closes resources only
+// after they returned.
+func New(srv *http.Server, drainTimeout time.Duration) *Server {
+	s := &Server{srv: srv, drainTimeout: drainTimeout}
+	h := srv.Handler
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		if s.closing {
+			s.mu.RUnlock()
+			w.Header().Set("Connection", "close")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		s.handlers.Add(1)
+		s.mu.RUnlock()
+		defer s.handlers.Done()
+		h.ServeHTTP(w, r)
+	})
+	return s
+}
+
+// WithTLS makes Run serve HTTPS with the given certificate and key files.
+func (s *Server) WithTLS(certFile string, keyFile string) *Server {
+	s.certFile, s.keyFile = certFile, keyFile
+	return s
+}
+
+// OnShutdown registers close to be called after the server stopped serving requests.
+// Closers run in reverse order of registration, so a resource is registered before
+// the ones using it.
+func (s *Server) OnShutdown(name string, close func(ctx context.Context) error) {
+	s.closers = append(s.closers, closer{name: name, close: close})
+}
+
+// Run serves ln until ctx is done or serving fails. Either way it shuts the server down
+// gracefully within the drain timeout and then runs the registered closers with
+// the time left, returning every error encountered. When draining times out, connections
+// are closed and the closers run once the cut off handlers returned, or after abortTimeout.
+func (s *Server) Run(ctx context.Context, ln net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.certFile != "" {
+			serveErr <- s.srv.ServeTLS(ln, s.certFile, s.keyFile)
+		} else {
+			serveErr <- s.srv.Serve(ln)
+		}
+	}()
+
+	var errs []error
+	select {
+	case err := <-serveErr:
+		errs = append(errs, fmt.Errorf("server stopped: %w", err))
+	case <-ctx.Done():
+		slog.Info("shutting down, draining in-flight requests", "drain_timeout", s.drainTimeout)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+	defer cancel()
+	if err := s.srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("can't drain in-flight requests: %w", err))
+		// connections still running handlers are cut off before their resources are closed
+		s.srv.Close()
+		if err := s.waitHandlers(abortTimeout); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		c := s.closers[i]
+		if err := c.close(shutdownCtx); err != nil {
+			errs = append(errs, fmt.Errorf("can't close %v: %w", c.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// waitHandlers waits up to timeout for running handlers to return, new requests are
+// answered with 503 from then on.
+func (s *Server) waitHandlers(timeout time.Duration) error {
+	s.mu.Lock()
+	s.closing = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("handlers still running %v after closing connections", timeout)
+	}
+}
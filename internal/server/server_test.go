@@ -0,0 +1,140 @@
+package server_test
+
+import (
+	"context"
+	"dmmak/simple-rest-crud/internal/server"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunDrainsRequestsThenClosesInReverseOrder(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can't listen: %s", err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	srv := server.New(&http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		record("request done")
+		w.WriteHeader(http.StatusOK)
+	})}, 5*time.Second)
+	srv.OnShutdown("db", func(ctx context.Context) error {
+		record("db closed")
+		return nil
+	})
+	srv.OnShutdown("worker", func(ctx context.Context) error {
+		record("worker stopped")
+		return errors.New("worker failed")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- srv.Run(ctx, ln) }()
+
+	respStatus := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			respStatus <- 0
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		respStatus <- resp.StatusCode
+	}()
+
+	<-started
+	cancel()
+	// the in-flight request is released only after shutdown began
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	assert.Equal(t, http.StatusOK, <-respStatus)
+	err = <-runErr
+	assert.ErrorContains(t, err, "can't close worker: worker failed")
+	assert.Equal(t, []string{"request done", "worker stopped", "db closed"}, events)
+
+	_, err = http.Get("http://" + ln.Addr().String())
+	assert.Error(t, err, "server must not accept requests after shutdown")
+}
+
+func TestRunClosesResourcesAfterAbortedHandlersReturned(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can't listen: %s", err)
+	}
+
+	started := make(chan struct{})
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	srv := server.New(&http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		// e.g. a repository call noticing the cancellation
+		time.Sleep(50 * time.Millisecond)
+		record("request aborted")
+	})}, 50*time.Millisecond)
+	srv.OnShutdown("db", func(ctx context.Context) error {
+		record("db closed")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- srv.Run(ctx, ln) }()
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+	cancel()
+
+	assert.ErrorContains(t, <-runErr, "can't drain in-flight requests")
+	assert.Equal(t, []string{"request aborted", "db closed"}, events)
+}
+
+func TestRunReportsServeError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can't listen: %s", err)
+	}
+	ln.Close()
+
+	closed := false
+	srv := server.New(&http.Server{}, time.Second)
+	srv.OnShutdown("db", func(ctx context.Context) error {
+		closed = true
+		return nil
+	})
+
+	err = srv.Run(context.Background(), ln)
+	assert.ErrorContains(t, err, "server stopped")
+	assert.True(t, closed, "resources must be closed when serving fails")
+}
@@ -0,0 +1,250 @@
+package validation
+
+import (
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/idgen"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rules limit posts and comments accepted from clients. Default lengths match
+// the varchar columns of the posts and comments tables.
+type Rules struct {
+	MaxTitleLen        int
+	MaxBodyLen         int
+	MaxCommentsPerPost int
+}
+
+func DefaultRules() Rules {
+	return Rules{
+		MaxTitleLen:        256,
+		MaxBodyLen:         4000,
+		MaxCommentsPerPost: 1000,
+	}
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors holds every field error found in a payload.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *Errors) add(field string, format string, args ...any) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e Errors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+type Validator struct {
+	rules Rules
+	ids   idgen.Generator
+	// stored IDs are accepted whatever their format, see Stored
+	stored map[string]bool
+}
+
+func New(rules Rules, ids idgen.Generator) *Validator {
+	return &Validator{rules: rules, ids: ids}
+}
+
+// Stored returns a copy of v that accepts ids as they are. Those are IDs of stored posts
+// and comments, which were valid when stored but may be in a format used before
+// a change of the ID format, so they must not fail a patch of the resource.
+func (v *Validator) Stored(ids ...string) *Validator {
+	stored := make(map[string]bool, len(v.stored)+len(ids))
+	for id := range v.stored {
+		stored[id] = true
+	}
+	for _, id := range ids {
+		stored[id] = true
+	}
+	return &Validator{rules: v.rules, ids: v.ids, stored: stored}
+}
+
+// validID accepts IDs of the generator's format, stored ones and empty ones, which are minted by the server.
+func (v *Validator) validID(id string) bool {
+	return id == "" || v.stored[id] || v.ids.Valid(id)
+}
+
+// Post returns Errors with all problems of post and its comments, or nil if there are none.
+// Empty IDs are allowed since they're minted by the server.
+func (v *Validator) Post(post *entity.RedditPost) error {
+	errs := Errors{}
+	if !v.validID(post.UUID) {
+		errs.add("UUID", "has invalid format")
+	}
+	v.text(&errs, "Title", post.Title, v.rules.MaxTitleLen)
+	if len(post.Comments) > v.rules.MaxCommentsPerPost {
+		errs.add("Comments", "must have at most %v items", v.rules.MaxCommentsPerPost)
+	}
+
+	seen := map[string]bool{}
+	for i, c := range post.Comments {
+		field := fmt.Sprintf("Comments[%v]", i)
+		if c == nil {
+			errs.add(field, "must not be null")
+			continue
+		}
+		if c.UUID != "" && seen[c.UUID] {
+			errs.add(field+".UUID", "duplicates uuid=%v", c.UUID)
+		}
+		seen[c.UUID] = true
+		v.comment(&errs, field+".", c)
+	}
+	return errs.orNil()
+}
+
+// Comment returns Errors with all problems of comment, or nil if there are none.
+func (v *Validator) Comment(comment *entity.Comment) error {
+	errs := Errors{}
+	v.comment(&errs, "", comment)
+	return errs.orNil()
+}
+
+func (v *Validator) comment(errs *Errors, prefix string, comment *entity.Comment) {
+	if !v.validID(comment.UUID) {
+		errs.add(prefix+"UUID", "has invalid format")
+	}
+	v.text(errs, prefix+"Body", comment.Body, v.rules.MaxBodyLen)
+}
+
+func (v *Validator) text(errs *Errors, field string, value string, maxLen int) {
+	switch {
+	case strings.TrimSpace(value) == "":
+		errs.add(field, "must not be empty")
+	case !utf8.ValidString(value):
+		errs.add(field, "must be valid UTF-8")
+	case utf8.RuneCountInString(value) > maxLen:
+		errs.add(field, "must be at most %v characters long", maxLen)
+	}
+}
+
+// DecodePost decodes a post from r and validates it. Unknown fields are reported
+// together with all other field errors.
+func (v *Validator) DecodePost(r io.Reader) (*entity.RedditPost, error) {
+	post := &entity.RedditPost{}
+	errs, err := decode(r, post)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.Post(post); err != nil {
+		errs = append(errs, err.(Errors)...)
+	}
+	return post, errs.orNil()
+}
+
+// DecodeComment decodes a comment from r and validates it, see DecodePost.
+func (v *Validator) DecodeComment(r io.Reader) (*entity.Comment, error) {
+	comment := &entity.Comment{}
+	errs, err := decode(r, comment)
+	if err != nil {
+		return nil, err
+	}
+	v.comment(&errs, "", comment)
+	return comment, errs.orNil()
+}
+
+// decode decodes JSON from r into v and lists the fields v has no place for.
+// err is set only when the payload isn't valid JSON or doesn't match v's types.
+func decode(r io.Reader, v any) (unknown Errors, err error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("can't read payload: %w", err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, err
+	}
+	var raw any
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+	unknown = Errors{}
+	unknownFields(&unknown, "", raw, reflect.TypeOf(v))
+	return unknown, nil
+}
+
+func unknownFields(errs *Errors, path string, value any, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			f, ok := jsonField(t, k)
+			if !ok {
+				errs.add(joinPath(path, k), "is unknown")
+				continue
+			}
+			unknownFields(errs, joinPath(path, f.Name), obj[k], f.Type)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := value.([]any)
+		if !ok {
+			return
+		}
+		for i, item := range arr {
+			unknownFields(errs, fmt.Sprintf("%s[%v]", path, i), item, t.Elem())
+		}
+	}
+}
+
+// jsonField finds the struct field encoding/json would decode key into.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// AsErrors returns field errors carried by err, if any.
+func AsErrors(err error) (Errors, bool) {
+	var errs Errors
+	ok := errors.As(err, &errs)
+	return errs, ok
+}
@@ -0,0 +1,142 @@
+package validation_test
+
+import (
+	"bytes"
+	"dmmak/simple-rest-crud/internal/entity"
+	"dmmak/simple-rest-crud/internal/idgen"
+	"dmmak/simple-rest-crud/internal/validation"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPost(t *testing.T) {
+	rules := validation.Rules{MaxTitleLen: 10, MaxBodyLen: 20, MaxCommentsPerPost: 2}
+	v := validation.New(rules, idgen.NewBase36())
+
+	tests := []struct {
+		name      string
+		post      *entity.RedditPost
+		expFields []string
+	}{
+		{
+			name: "valid",
+			post: &entity.RedditPost{
+				UUID:  "p1000000",
+				Title: "Title",
+				Comments: []*entity.Comment{
+					{UUID: "c0000001", Body: "Body"},
+					{Body: "Body without id"},
+				},
+			},
+		},
+		{
+			name: "valid multibyte title",
+			post: &entity.RedditPost{Title: strings.Repeat("ж", 10)},
+		},
+		{
+			name:      "empty title",
+			post:      &entity.RedditPost{Title: " "},
+			expFields: []string{"Title"},
+		},
+		{
+			name:      "too long title",
+			post:      &entity.RedditPost{Title: strings.Repeat("t", 11)},
+			expFields: []string{"Title"},
+		},
+		{
+			name: "all at once",
+			post: &entity.RedditPost{
+				UUID:  "P-1",
+				Title: "",
+				Comments: []*entity.Comment{
+					{UUID: "c0000001", Body: strings.Repeat("b", 21)},
+					{UUID: "c0000001", Body: "Body"},
+					nil,
+				},
+			},
+			expFields: []string{"UUID", "Title", "Comments", "Comments[0].Body", "Comments[1].UUID", "Comments[2]"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := v.Post(test.post)
+			if test.expFields == nil {
+				assert.NoError(t, err)
+				return
+			}
+			errs, ok := validation.AsErrors(err)
+			assert.True(t, ok)
+			actualFields := []string{}
+			for _, fe := range errs {
+				actualFields = append(actualFields, fe.Field)
+			}
+			assert.ElementsMatch(t, test.expFields, actualFields)
+		})
+	}
+}
+
+func TestComment(t *testing.T) {
+	v := validation.New(validation.DefaultRules(), idgen.NewBase36())
+
+	assert.NoError(t, v.Comment(&entity.Comment{Body: strings.Repeat("b", 4000)}))
+
+	errs, ok := validation.AsErrors(v.Comment(&entity.Comment{UUID: "c1", Body: strings.Repeat("b", 4001)}))
+	assert.True(t, ok)
+	assert.Len(t, errs, 2)
+}
+
+func TestDecodePost(t *testing.T) {
+	v := validation.New(validation.DefaultRules(), idgen.NewBase36())
+
+	post, err := v.DecodePost(bytes.NewReader([]byte(`{"Title": "Title", "Comments": [{"Body": "Body"}]}`)))
+	assert.NoError(t, err)
+	assert.Equal(t, "Title", post.Title)
+
+	_, err = v.DecodePost(bytes.NewReader([]byte(`{"Title": "", "Views": 5, "Comments": [{"Body": "Body", "Author": "a"}]}`)))
+	errs, ok := validation.AsErrors(err)
+	assert.True(t, ok)
+	assert.Equal(t, validation.Errors{
+		{Field: "Comments[0].Author", Message: "is unknown"},
+		{Field: "Views", Message: "is unknown"},
+		{Field: "Title", Message: "must not be empty"},
+	}, errs)
+
+	_, err = v.DecodePost(bytes.NewReader([]byte(`{"Title": `)))
+	assert.Error(t, err)
+	_, ok = validation.AsErrors(err)
+	assert.False(t, ok)
+}
+
+func TestDecodeComment(t *testing.T) {
+	v := validation.New(validation.DefaultRules(), idgen.NewBase36())
+
+	comment, err := v.DecodeComment(bytes.NewReader([]byte(`{"body": "Body"}`)))
+	assert.NoError(t, err)
+	assert.Equal(t, "Body", comment.Body)
+
+	_, err = v.DecodeComment(bytes.NewReader([]byte(`{"Body": "Body", "Post": "p1000000"}`)))
+	errs, ok := validation.AsErrors(err)
+	assert.True(t, ok)
+	assert.Equal(t, validation.Errors{{Field: "Post", Message: "is unknown"}}, errs)
+}
+
+func TestStored(t *testing.T) {
+	v := validation.New(validation.DefaultRules(), idgen.NewULID())
+	post := &entity.RedditPost{UUID: "p1000000", Title: "Title", Comments: []*entity.Comment{{UUID: "c1000000", Body: "Body"}}}
+
+	errs, ok := validation.AsErrors(v.Post(post))
+	assert.True(t, ok)
+	assert.Len(t, errs, 2)
+
+	assert.NoError(t, v.Stored("p1000000", "c1000000").Post(post))
+	assert.NoError(t, v.Stored("c1000000").Comment(post.Comments[0]))
+	// the copy doesn't change v
+	assert.Error(t, v.Comment(post.Comments[0]))
+
+	errs, ok = validation.AsErrors(v.Stored("p1000000").Post(post))
+	assert.True(t, ok)
+	assert.Equal(t, validation.Errors{{Field: "Comments[0].UUID", Message: "has invalid format"}}, errs)
+}